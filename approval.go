@@ -1,77 +1,169 @@
 package main
 
 import (
-	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"os"
-	"regexp"
 	"strings"
+	"time"
 
 	"github.com/google/go-github/v43/github"
+
+	"github.com/trstringer/manual-approval/pkg/approval"
 )
 
-type approvalEnvironment struct {
-	client                *github.Client
+// approvalOptions are the settings of an approval request, as read from the
+// inputs. They don't change once the request is made.
+type approvalOptions struct {
 	repoFullName          string
-	repo                  string
 	repoOwner             string
 	runID                 int
-	approvalIssue         *github.Issue
-	approvalIssueNumber   int
 	issueTitle            string
 	issueBody             string
 	issueLabels           []string
 	issueApprovers        []string
+	requiredApprovers     []string
+	areas                 []approval.Area
 	minimumApprovals      int
 	targetRepoOwner       string
 	targetRepoName        string
 	failOnDenial          bool
 	closeIssueMeansDenial bool
+	editedCommentPolicy   editedCommentPolicy
+	commentSyntax         approval.CommentSyntax
+	// approvedWords and deniedWords approve and deny the request in
+	// comments. Empty means the default words.
+	approvedWords       []string
+	deniedWords         []string
+	reactionMapping     map[string]approval.Action
+	closeIssueAsVote    bool
+	issueClosers        []string
+	checklist           []string
+	target              approvalTarget
+	existingIssueNumber int
+	closeExistingIssue  bool
+	discussionCategory  string
+	// workflowRunURL links to the run waiting for approval. Empty means the
+	// run on github.com.
+	workflowRunURL string
+	policy         string
+	policyReason   string
+	timeout        time.Duration
+	// log receives the progress of the request. Nil discards it.
+	log io.Writer
+}
+
+// approvalEnvironment is an approval request: its options and the state of
+// the request as it is made and decided.
+type approvalEnvironment struct {
+	approvalOptions
+
+	repo string
+	// evaluator decides the request under the options' policy, and reads
+	// the votes from comments.
+	evaluator           *approval.Evaluator
+	approvalIssue       *github.Issue
+	approvalIssueNumber int
+	ignoredCommentIDs   []int64
+	decision            approval.Decision
+	issueAuthor         string
+	checklistState      []checklistItem
+	outputs             map[string]string
 }
 
-func newApprovalEnvironment(client *github.Client, repoFullName, repoOwner string, runID int, approvers []string, minimumApprovals int, issueTitle, issueBody string, targetRepoOwner string, targetRepoName string, failOnDenial bool, closeIssueMeansDenial bool, issueLabels []string) (*approvalEnvironment, error) {
-	repoOwnerAndName := strings.Split(repoFullName, "/")
-	if len(repoOwnerAndName) != 2 {
-		return nil, fmt.Errorf("repo owner and name in unexpected format: %s", repoFullName)
+func newApprovalEnvironment(opts approvalOptions) (*approvalEnvironment, error) {
+	// GitLab projects can be nested in subgroups, so the name is whatever
+	// follows the last slash.
+	separator := strings.LastIndex(opts.repoFullName, "/")
+	if separator <= 0 || separator == len(opts.repoFullName)-1 {
+		return nil, fmt.Errorf("repo owner and name in unexpected format: %s", opts.repoFullName)
+	}
+
+	if len(opts.approvedWords) == 0 {
+		opts.approvedWords = approval.DefaultApprovedWords
+	}
+	if len(opts.deniedWords) == 0 {
+		opts.deniedWords = approval.DefaultDeniedWords
+	}
+	keywords, err := approval.NewKeywordMatcher(opts.approvedWords, opts.deniedWords)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing approved and denied words: %w", err)
+	}
+	evaluator, err := approval.NewEvaluator(approval.Policy{
+		Approvers:         opts.issueApprovers,
+		MinimumApprovals:  opts.minimumApprovals,
+		RequiredApprovers: opts.requiredApprovers,
+		Areas:             opts.areas,
+		CommentSyntax:     opts.commentSyntax,
+		Keywords:          keywords,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error creating approval policy: %w", err)
+	}
+
+	if opts.log == nil {
+		opts.log = io.Discard
 	}
-	repo := repoOwnerAndName[1]
 
 	return &approvalEnvironment{
-		client:                client,
-		repoFullName:          repoFullName,
-		repo:                  repo,
-		repoOwner:             repoOwner,
-		runID:                 runID,
-		issueApprovers:        approvers,
-		minimumApprovals:      minimumApprovals,
-		issueTitle:            issueTitle,
-		issueBody:             issueBody,
-		targetRepoOwner:       targetRepoOwner,
-		targetRepoName:        targetRepoName,
-		failOnDenial:          failOnDenial,
-		closeIssueMeansDenial: closeIssueMeansDenial,
-		issueLabels:           issueLabels,
+		approvalOptions: opts,
+		repo:            opts.repoFullName[separator+1:],
+		evaluator:       evaluator,
 	}, nil
 }
 
+// canCloseAsDenial reports whether closing the issue by user counts as a
+// denial under close-issue-means-denial.
+func (a approvalEnvironment) canCloseAsDenial(user string) bool {
+	if user == "" {
+		return false
+	}
+	return approversIndex(a.issueApprovers, user) >= 0 || approversIndex(a.issueClosers, user) >= 0
+}
+
+// runURL links to the workflow run waiting for approval.
 func (a approvalEnvironment) runURL() string {
-	serverUrl := os.Getenv("GITHUB_SERVER_URL")
+	if a.workflowRunURL != "" {
+		return a.workflowRunURL
+	}
+	return githubRunURL("", a.repoFullName, a.runID)
+}
+
+func githubRunURL(serverUrl, repoFullName string, runID int) string {
 	if serverUrl == "" {
 		serverUrl = "https://github.com"
 	}
-	return fmt.Sprintf("%s/%s/actions/runs/%d", strings.TrimRight(serverUrl, "/"), a.repoFullName, a.runID)
+	return fmt.Sprintf("%s/%s/actions/runs/%d", strings.TrimRight(serverUrl, "/"), repoFullName, runID)
 }
 
-func (a *approvalEnvironment) createApprovalIssue(ctx context.Context) error {
-	issueTitle := fmt.Sprintf("Manual approval required for workflow run %d", a.runID)
-
+func (a approvalEnvironment) approvalRequestTitle() string {
 	if a.issueTitle != "" {
-		issueTitle = a.issueTitle
+		return a.issueTitle
+	}
+	if a.runID == 0 {
+		return "Manual approval required"
 	}
+	return fmt.Sprintf("Manual approval required for workflow run %d", a.runID)
+}
+
+func (a approvalEnvironment) approvalRequestBody() string {
+	return a.approvalRequestBodyMentioning(func(approver string) string {
+		return "@" + approver
+	})
+}
 
+// approvalRequestBodyMentioning is approvalRequestBody for trackers that
+// don't mention users as @login, with mention writing an approver's mention.
+func (a approvalEnvironment) approvalRequestBodyMentioning(mention func(approver string) string) string {
 	approversBody := ""
 	for _, approver := range a.issueApprovers {
-		approversBody = fmt.Sprintf("%s> * @%s\n", approversBody, approver)
+		if approversIndex(a.requiredApprovers, approver) >= 0 {
+			approversBody = fmt.Sprintf("%s> * %s (required)\n", approversBody, mention(approver))
+			continue
+		}
+		approversBody = fmt.Sprintf("%s> * %s\n", approversBody, mention(approver))
 	}
 
 	issueBody := fmt.Sprintf(`> Workflow is pending manual review.
@@ -82,69 +174,67 @@ func (a *approvalEnvironment) createApprovalIssue(ctx context.Context) error {
 %s
 
 > [!TIP]
-> Respond %s to continue workflow or %s to cancel.`,
+> %s`,
 		a.runURL(),
 		approversBody,
-		formatAcceptedWords(approvedWords),
-		formatAcceptedWords(deniedWords),
+		a.responseInstructions(),
 	)
 
 	issueBody = fmt.Sprintf(">[!NOTE]\n%s", issueBody)
 
-	var err error
-	fmt.Printf(
-		"Creating issue in repo %s/%s with the following content:\nTitle: %s\nApprovers: %s\nBody:\n%s\n",
-		a.targetRepoOwner,
-		a.targetRepoName,
-		issueTitle,
-		a.issueApprovers,
-		issueBody,
-	)
-	// Use NewRequest+Do with a minimal response struct rather than client.Issues.Create.
-	// Forgejo's issue response includes "repository.owner" as a plain string, but
-	// go-github's Repository.Owner is a *User struct, causing an unmarshal error.
-	// Our minimal struct omits Repository entirely, so the field is ignored.
-	type createIssueResponse struct {
-		Number  int    `json:"number"`
-		HTMLURL string `json:"html_url"`
-	}
-	req, err := a.client.NewRequest("POST",
-		fmt.Sprintf("repos/%s/%s/issues", a.targetRepoOwner, a.targetRepoName),
-		&github.IssueRequest{
-			Title:     &issueTitle,
-			Body:      &issueBody,
-			Assignees: &a.issueApprovers,
-			Labels:    &a.issueLabels,
-		},
-	)
-	if err != nil {
-		return err
-	}
-	var created createIssueResponse
-	if _, err = a.client.Do(ctx, req, &created); err != nil {
-		return err
+	if len(a.areas) > 0 {
+		issueBody = fmt.Sprintf("%s\n\n%s", issueBody, formatAreas(a.areas, mention))
 	}
-	a.approvalIssueNumber = created.Number
-	a.approvalIssue = &github.Issue{
-		Number:  &created.Number,
-		HTMLURL: &created.HTMLURL,
+
+	if len(a.checklist) > 0 {
+		issueBody = fmt.Sprintf("%s\n\n%s", issueBody, formatChecklist(a.checklist))
 	}
+	return issueBody
+}
 
-	bodyChunks := splitLongString(a.issueBody)
-	for _, chunk := range bodyChunks {
-		_, _, err = a.client.Issues.CreateComment(ctx, a.targetRepoOwner, a.targetRepoName, created.Number, &github.IssueComment{
-			Body: &chunk,
-		})
-		if err != nil {
-			return fmt.Errorf("failed to add comment chunk to issue: %w", err)
+// formatAreas lists the areas that each need an approval, with the approvers
+// who can give it.
+func formatAreas(areas []approval.Area, mention func(approver string) string) string {
+	lines := []string{"> [!IMPORTANT]", "> An approval is needed for each of these areas:"}
+	for _, area := range areas {
+		mentions := make([]string, 0, len(area.Approvers))
+		for _, approver := range area.Approvers {
+			mentions = append(mentions, mention(approver))
 		}
+		lines = append(lines, fmt.Sprintf("> * `%s`: %s", area.Name, strings.Join(mentions, ", ")))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (a approvalEnvironment) responseInstructions() string {
+	if a.target == approvalTargetPullRequestReview {
+		return "Approve this pull request to continue workflow or request changes to cancel."
 	}
 
-	fmt.Printf("Issue created: %s\n", a.approvalIssue.GetHTMLURL())
-	return nil
+	commands := "Comment /approve or /deny on the first line, optionally followed by a reason. Use /hold and /unhold to pause the approval, or /revoke to withdraw your approval."
+	keywordsText := fmt.Sprintf("Respond %s to continue workflow or %s to cancel.", formatAcceptedWords(a.approvedWords), formatAcceptedWords(a.deniedWords))
+
+	switch a.commentSyntax {
+	case approval.CommentSyntaxCommands:
+		return commands
+	case approval.CommentSyntaxBoth:
+		return fmt.Sprintf("%s\n> %s", commands, keywordsText)
+	default:
+		return keywordsText
+	}
 }
 
+// SetActionOutputs writes outputs to the GITHUB_OUTPUT file, if set. The
+// outputs are also kept on the environment, to be printed from the command
+// line.
 func (a *approvalEnvironment) SetActionOutputs(outputs map[string]string) (bool, error) {
+	if a.outputs == nil {
+		a.outputs = map[string]string{}
+	}
+	for key, value := range outputs {
+		a.outputs[key] = value
+	}
+
 	outputFile := os.Getenv("GITHUB_OUTPUT")
 	if outputFile == "" {
 		return false, nil
@@ -162,7 +252,17 @@ func (a *approvalEnvironment) SetActionOutputs(outputs map[string]string) (bool,
 	var pairs []string
 
 	for key, value := range outputs {
-		pairs = append(pairs, fmt.Sprintf("%s=%s", key, value))
+		if !strings.Contains(value, "\n") {
+			pairs = append(pairs, fmt.Sprintf("%s=%s", key, value))
+			continue
+		}
+		// Multiline values have to use the heredoc style syntax, with a
+		// delimiter that can't appear in the value itself.
+		delimiter, err := outputDelimiter(value)
+		if err != nil {
+			return false, err
+		}
+		pairs = append(pairs, fmt.Sprintf("%s<<%s\n%s\n%s", key, delimiter, value, delimiter))
 	}
 
 	// Add a newline before writing the new outputs if the file is not empty. This prevents
@@ -184,45 +284,31 @@ func (a *approvalEnvironment) SetActionOutputs(outputs map[string]string) (bool,
 	return true, nil
 }
 
-func approvalFromComments(comments []*github.IssueComment, approvers []string, minimumApprovals int) (approvalStatus, error) {
-	remainingApprovers := make([]string, len(approvers))
-	copy(remainingApprovers, approvers)
-
-	if minimumApprovals == 0 {
-		minimumApprovals = len(approvers)
-	}
-
-	for _, comment := range comments {
-		commentUser := comment.User.GetLogin()
-		approverIdx := approversIndex(remainingApprovers, commentUser)
-		if approverIdx < 0 {
-			continue
+func outputDelimiter(value string) (string, error) {
+	for {
+		raw := make([]byte, 8)
+		if _, err := rand.Read(raw); err != nil {
+			return "", err
 		}
-
-		commentBody := comment.GetBody()
-		isApprovalComment, err := isApproved(commentBody)
-		if err != nil {
-			return approvalStatusPending, err
-		}
-		if isApprovalComment {
-			if len(remainingApprovers) == len(approvers)-minimumApprovals+1 {
-				return approvalStatusApproved, nil
-			}
-			remainingApprovers[approverIdx] = remainingApprovers[len(remainingApprovers)-1]
-			remainingApprovers = remainingApprovers[:len(remainingApprovers)-1]
-			continue
-		}
-
-		isDenialComment, err := isDenied(commentBody)
-		if err != nil {
-			return approvalStatusPending, err
-		}
-		if isDenialComment {
-			return approvalStatusDenied, nil
+		delimiter := fmt.Sprintf("ghadelimiter_%s", hex.EncodeToString(raw))
+		if !strings.Contains(value, delimiter) {
+			return delimiter, nil
 		}
 	}
+}
 
-	return approvalStatusPending, nil
+// approvalComments converts the comments of a request to the comments the
+// evaluator reads votes from.
+func approvalComments(comments []*github.IssueComment) []approval.Comment {
+	converted := make([]approval.Comment, 0, len(comments))
+	for _, comment := range comments {
+		converted = append(converted, approval.Comment{
+			User:      comment.User.GetLogin(),
+			Body:      comment.GetBody(),
+			CreatedAt: comment.GetCreatedAt(),
+		})
+	}
+	return converted
 }
 
 func approversIndex(approvers []string, name string) int {
@@ -234,40 +320,6 @@ func approversIndex(approvers []string, name string) int {
 	return -1
 }
 
-func isApproved(commentBody string) (bool, error) {
-	for _, approvedWord := range approvedWords {
-		re, err := regexp.Compile(fmt.Sprintf("(?i)^%s[.!]*\n*\\s*$", approvedWord))
-		if err != nil {
-			fmt.Printf("Error parsing. %v", err)
-			return false, err
-		}
-
-		matched := re.MatchString(commentBody)
-
-		if matched {
-			return true, nil
-		}
-	}
-
-	return false, nil
-}
-
-func isDenied(commentBody string) (bool, error) {
-	for _, deniedWord := range deniedWords {
-		re, err := regexp.Compile(fmt.Sprintf("(?i)^%s[.!]*\n*\\s*$", deniedWord))
-		if err != nil {
-			fmt.Printf("Error parsing. %v", err)
-			return false, err
-		}
-		matched := re.MatchString(commentBody)
-		if matched {
-			return true, nil
-		}
-	}
-
-	return false, nil
-}
-
 func formatAcceptedWords(words []string) string {
 	var quotedWords []string
 
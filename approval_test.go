@@ -3,10 +3,13 @@ package main
 import (
 	"errors"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/google/go-github/v43/github"
+
+	"github.com/trstringer/manual-approval/pkg/approval"
 )
 
 func TestApprovalFromComments(t *testing.T) {
@@ -24,7 +27,7 @@ func TestApprovalFromComments(t *testing.T) {
 		comments         []*github.IssueComment
 		approvers        []string
 		minimumApprovals int
-		expectedStatus   approvalStatus
+		expectedStatus   approval.Status
 	}{
 		{
 			name: "single_approver_single_comment_approved",
@@ -35,7 +38,7 @@ func TestApprovalFromComments(t *testing.T) {
 				},
 			},
 			approvers:      []string{login1},
-			expectedStatus: approvalStatusApproved,
+			expectedStatus: approval.StatusApproved,
 		},
 		{
 			name: "single_approver_single_comment_denied",
@@ -46,7 +49,7 @@ func TestApprovalFromComments(t *testing.T) {
 				},
 			},
 			approvers:      []string{login1},
-			expectedStatus: approvalStatusDenied,
+			expectedStatus: approval.StatusDenied,
 		},
 		{
 			name: "single_approver_single_comment_pending",
@@ -57,7 +60,7 @@ func TestApprovalFromComments(t *testing.T) {
 				},
 			},
 			approvers:      []string{login1},
-			expectedStatus: approvalStatusPending,
+			expectedStatus: approval.StatusPending,
 		},
 		{
 			name: "single_approver_multi_comment_approved",
@@ -72,7 +75,7 @@ func TestApprovalFromComments(t *testing.T) {
 				},
 			},
 			approvers:      []string{login1},
-			expectedStatus: approvalStatusApproved,
+			expectedStatus: approval.StatusApproved,
 		},
 		{
 			name: "multi_approver_approved",
@@ -87,7 +90,7 @@ func TestApprovalFromComments(t *testing.T) {
 				},
 			},
 			approvers:      []string{login1, login2},
-			expectedStatus: approvalStatusApproved,
+			expectedStatus: approval.StatusApproved,
 		},
 		{
 			name: "multi_approver_mixed",
@@ -102,7 +105,7 @@ func TestApprovalFromComments(t *testing.T) {
 				},
 			},
 			approvers:      []string{login1, login2},
-			expectedStatus: approvalStatusPending,
+			expectedStatus: approval.StatusPending,
 		},
 		{
 			name: "multi_approver_denied",
@@ -117,7 +120,7 @@ func TestApprovalFromComments(t *testing.T) {
 				},
 			},
 			approvers:      []string{login1, login2},
-			expectedStatus: approvalStatusDenied,
+			expectedStatus: approval.StatusDenied,
 		},
 		{
 			name: "multi_approver_minimum_one_approval",
@@ -132,7 +135,7 @@ func TestApprovalFromComments(t *testing.T) {
 				},
 			},
 			approvers:        []string{login1, login2},
-			expectedStatus:   approvalStatusApproved,
+			expectedStatus:   approval.StatusApproved,
 			minimumApprovals: 1,
 		},
 		{
@@ -148,7 +151,7 @@ func TestApprovalFromComments(t *testing.T) {
 				},
 			},
 			approvers:        []string{login1, login2, login3},
-			expectedStatus:   approvalStatusApproved,
+			expectedStatus:   approval.StatusApproved,
 			minimumApprovals: 2,
 		},
 		{
@@ -160,7 +163,7 @@ func TestApprovalFromComments(t *testing.T) {
 				},
 			},
 			approvers:        []string{login1, login2, login3},
-			expectedStatus:   approvalStatusPending,
+			expectedStatus:   approval.StatusPending,
 			minimumApprovals: 2,
 		},
 		{
@@ -172,19 +175,22 @@ func TestApprovalFromComments(t *testing.T) {
 				},
 			},
 			approvers:      []string{login1},
-			expectedStatus: approvalStatusApproved,
+			expectedStatus: approval.StatusApproved,
 		},
 	}
 
 	for _, testCase := range testCases {
 		t.Run(testCase.name, func(t *testing.T) {
-			actual, err := approvalFromComments(testCase.comments, testCase.approvers, testCase.minimumApprovals)
+			evaluator, err := approval.NewEvaluator(approval.Policy{
+				Approvers:        testCase.approvers,
+				MinimumApprovals: testCase.minimumApprovals,
+			})
 			if err != nil {
-				t.Fatalf("error getting approval from comments: %v", err)
+				t.Fatalf("error creating evaluator: %v", err)
 			}
-
-			if actual != testCase.expectedStatus {
-				t.Fatalf("actual %s, expected %s", actual, testCase.expectedStatus)
+			actual := evaluator.Evaluate(evaluator.VotesFromComments(approvalComments(testCase.comments)))
+			if actual.Status != testCase.expectedStatus {
+				t.Fatalf("actual %s, expected %s", actual.Status, testCase.expectedStatus)
 			}
 		})
 	}
@@ -305,28 +311,205 @@ func TestApprovedCommentBody(t *testing.T) {
 			isSuccess:          true,
 			customApprovalWord: "✅",
 		},
+		{
+			name:               "approved_with_plus_one",
+			commentBody:        "+1",
+			isSuccess:          true,
+			customApprovalWord: "+1",
+		},
+		{
+			name:               "plus_one_is_literal",
+			commentBody:        "11",
+			isSuccess:          false,
+			customApprovalWord: "+1",
+		},
+		{
+			name:               "approved_with_c_plus_plus",
+			commentBody:        "c++",
+			isSuccess:          true,
+			customApprovalWord: "c++",
+		},
+		{
+			name:               "dot_is_literal",
+			commentBody:        "shipXit",
+			isSuccess:          false,
+			customApprovalWord: "ship.it",
+		},
+		{
+			name:               "approved_with_regex_word",
+			commentBody:        "ship it",
+			isSuccess:          true,
+			customApprovalWord: "regex:ship ?it",
+		},
+		{
+			name:               "regex_word_is_anchored",
+			commentBody:        "don't ship it",
+			isSuccess:          false,
+			customApprovalWord: "regex:ship ?it",
+		},
+		{
+			name:               "approved_with_unicode_for_shortcode_word",
+			commentBody:        "🚀",
+			isSuccess:          true,
+			customApprovalWord: ":rocket:",
+		},
+		{
+			name:               "approved_with_shortcode_for_unicode_word",
+			commentBody:        ":white_check_mark:",
+			isSuccess:          true,
+			customApprovalWord: "✅",
+		},
+		{
+			name:               "approved_with_shortcode_alias",
+			commentBody:        ":thumbsup:",
+			isSuccess:          true,
+			customApprovalWord: "👍",
+		},
+		{
+			name:               "approved_with_emoji_variation_selector",
+			commentBody:        "✔️",
+			isSuccess:          true,
+			customApprovalWord: ":heavy_check_mark:",
+		},
 	}
 
 	for _, testCase := range testCases {
 		t.Run(testCase.name, func(t *testing.T) {
-			// before each
-			word := testCase.customApprovalWord
-			if len(word) > 0 {
-				approvedWords = append(approvedWords, word)
+			words := approval.DefaultApprovedWords
+			if len(testCase.customApprovalWord) > 0 {
+				words = append(append([]string{}, approval.DefaultApprovedWords...), testCase.customApprovalWord)
 			}
-
-			// test
-			actual, err := isApproved(testCase.commentBody)
+			matcher, err := approval.NewKeywordMatcher(words, approval.DefaultDeniedWords)
 			if err != nil {
-				t.Fatalf("error getting approval: %v", err)
+				t.Fatalf("error creating keyword matcher: %v", err)
 			}
+
+			actual := matcher.IsApproved(testCase.commentBody)
 			if actual != testCase.isSuccess {
 				t.Fatalf("expected %v but got %v", testCase.isSuccess, actual)
 			}
+		})
+	}
+}
+
+func TestApprovedCommentBodyMarkdown(t *testing.T) {
+	testCases := []struct {
+		name           string
+		commentBody    string
+		syntax         approval.CommentSyntax
+		isVote         bool
+		expectedAction approval.Action
+		expectedReason string
+	}{
+		{
+			name:        "quoted_approval_only",
+			commentBody: "> approve",
+			isVote:      false,
+		},
+		{
+			name:           "quoted_approval_with_own_approval",
+			commentBody:    "> approve\n\napprove",
+			isVote:         true,
+			expectedAction: approval.ActionApprove,
+		},
+		{
+			name:           "quoted_denial_with_own_approval",
+			commentBody:    "> deny\nlgtm",
+			isVote:         true,
+			expectedAction: approval.ActionApprove,
+		},
+		{
+			name:           "nested_quote",
+			commentBody:    "> > approve\n> deny\nno",
+			isVote:         true,
+			expectedAction: approval.ActionDeny,
+		},
+		{
+			name:        "fenced_code_block",
+			commentBody: "```\napprove\n```",
+			isVote:      false,
+		},
+		{
+			name:        "fenced_code_block_with_info_string",
+			commentBody: "```text\napprove\n```\n",
+			isVote:      false,
+		},
+		{
+			name:           "tilde_fence_then_approval",
+			commentBody:    "~~~~\ndeny\n~~~\nstill code\n~~~~\napproved",
+			isVote:         true,
+			expectedAction: approval.ActionApprove,
+		},
+		{
+			name:        "inline_code",
+			commentBody: "`approve`",
+			isVote:      false,
+		},
+		{
+			name:        "double_backtick_inline_code",
+			commentBody: "``approve ` lgtm``",
+			isVote:      false,
+		},
+		{
+			name:           "html_comment",
+			commentBody:    "approve <!-- pasted from the runbook -->",
+			isVote:         true,
+			expectedAction: approval.ActionApprove,
+		},
+		{
+			name:        "html_comment_hiding_keyword",
+			commentBody: "<!--\napprove\n-->",
+			isVote:      false,
+		},
+		{
+			name:           "email_reply_trailer",
+			commentBody:    "approve\n\nOn Mon, Jan 1, 2024 at 10:00 AM Some Bot <notifications@github.com> wrote:\n> Respond \"deny\" to cancel.",
+			isVote:         true,
+			expectedAction: approval.ActionApprove,
+		},
+		{
+			name:           "email_signature",
+			commentBody:    "yes\n-- \nSent from my phone",
+			isVote:         true,
+			expectedAction: approval.ActionApprove,
+		},
+		{
+			name:        "email_reply_without_own_text",
+			commentBody: "On Mon, Jan 1, 2024 at 10:00 AM Someone <someone@example.com> wrote:\napprove",
+			isVote:      false,
+		},
+		{
+			name:        "quoted_command",
+			commentBody: "> /approve",
+			syntax:      approval.CommentSyntaxCommands,
+			isVote:      false,
+		},
+		{
+			name:           "command_reason_excludes_quote",
+			commentBody:    "> /hold\n/approve hold was lifted\n> earlier thread",
+			syntax:         approval.CommentSyntaxCommands,
+			isVote:         true,
+			expectedAction: approval.ActionApprove,
+			expectedReason: "hold was lifted",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			syntax := testCase.syntax
+			if syntax == "" {
+				syntax = approval.CommentSyntaxKeywords
+			}
 
-			// after each
-			if len(word) > 0 {
-				approvedWords = approvedWords[:len(approvedWords)-1]
+			action, reason, ok := approval.ParseComment(testCase.commentBody, syntax, nil)
+			if ok != testCase.isVote {
+				t.Fatalf("expected vote %v but got %v", testCase.isVote, ok)
+			}
+			if action != testCase.expectedAction {
+				t.Fatalf("expected action %q but got %q", testCase.expectedAction, action)
+			}
+			if reason != testCase.expectedReason {
+				t.Fatalf("expected reason %q but got %q", testCase.expectedReason, reason)
 			}
 		})
 	}
@@ -421,25 +604,19 @@ func TestDeniedCommentBody(t *testing.T) {
 
 	for _, testCase := range testCases {
 		t.Run(testCase.name, func(t *testing.T) {
-			// before each
-			word := testCase.customDenialWord
-			if len(word) > 0 {
-				deniedWords = append(deniedWords, word)
+			words := approval.DefaultDeniedWords
+			if len(testCase.customDenialWord) > 0 {
+				words = append(append([]string{}, approval.DefaultDeniedWords...), testCase.customDenialWord)
 			}
-
-			// test
-			actual, err := isDenied(testCase.commentBody)
+			matcher, err := approval.NewKeywordMatcher(approval.DefaultApprovedWords, words)
 			if err != nil {
-				t.Fatalf("error getting approval: %v", err)
+				t.Fatalf("error creating keyword matcher: %v", err)
 			}
+
+			actual := matcher.IsDenied(testCase.commentBody)
 			if actual != testCase.isSuccess {
 				t.Fatalf("expected %v but got %v", testCase.isSuccess, actual)
 			}
-
-			// after each
-			if len(word) > 0 {
-				deniedWords = deniedWords[:len(deniedWords)-1]
-			}
 		})
 	}
 }
@@ -469,16 +646,17 @@ func TestSaveOutput(t *testing.T) {
 		t.Run(testCase.name, func(t *testing.T) {
 			t.Setenv("GITHUB_OUTPUT", testCase.env_github_output)
 			a := approvalEnvironment{
-				client:              nil,
-				repoFullName:        "",
+				approvalOptions: approvalOptions{
+					repoFullName:     "",
+					repoOwner:        "",
+					runID:            -1,
+					issueTitle:       "",
+					issueBody:        "",
+					issueApprovers:   nil,
+					minimumApprovals: 0,
+				},
 				repo:                "",
-				repoOwner:           "",
-				runID:               -1,
 				approvalIssueNumber: testCase.approvalIssueNumber,
-				issueTitle:          "",
-				issueBody:           "",
-				issueApprovers:      nil,
-				minimumApprovals:    0,
 			}
 
 			if err := os.Remove(testCase.env_github_output); err != nil && !os.IsNotExist(err) {
@@ -503,3 +681,56 @@ func TestSaveOutput(t *testing.T) {
 		})
 	}
 }
+
+func TestSaveOutputMultiline(t *testing.T) {
+	outputFile := filepath.Join(t.TempDir(), "output.txt")
+	t.Setenv("GITHUB_OUTPUT", outputFile)
+
+	a := approvalEnvironment{}
+	if _, err := a.SetActionOutputs(map[string]string{"decision-reason": "login1: first line\nsecond line"}); err != nil {
+		t.Fatalf("error saving output: %v", err)
+	}
+
+	raw, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatalf("error reading output file: %v", err)
+	}
+	lines := strings.Split(string(raw), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("expected 4 lines but got %d: %q", len(lines), raw)
+	}
+	delimiter := strings.TrimPrefix(lines[0], "decision-reason<<")
+	if delimiter == lines[0] || lines[3] != delimiter {
+		t.Fatalf("unexpected multiline output: %q", raw)
+	}
+	if lines[1] != "login1: first line" || lines[2] != "second line" {
+		t.Fatalf("unexpected multiline value: %q", raw)
+	}
+}
+
+func TestCanCloseAsDenial(t *testing.T) {
+	a := approvalEnvironment{approvalOptions: approvalOptions{
+		issueApprovers: []string{"login1", "login2"},
+		issueClosers:   []string{"release-bot"},
+	}}
+
+	testCases := []struct {
+		name     string
+		closer   string
+		expected bool
+	}{
+		{name: "approver", closer: "login1", expected: true},
+		{name: "approver_case_insensitive", closer: "LOGIN2", expected: true},
+		{name: "configured_closer", closer: "release-bot", expected: true},
+		{name: "triager", closer: "triager", expected: false},
+		{name: "unknown_closer", closer: "", expected: false},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			if actual := a.canCloseAsDenial(testCase.closer); actual != testCase.expected {
+				t.Fatalf("expected %v but got %v", testCase.expected, actual)
+			}
+		})
+	}
+}
@@ -3,78 +3,169 @@ package main
 import (
 	"context"
 	"fmt"
-	"os"
+	"io"
 	"strconv"
 	"strings"
 
 	"github.com/google/go-github/v43/github"
 )
 
-func retrieveApprovers(client *github.Client, repoOwner string) ([]string, error) {
-	workflowInitiator := os.Getenv(envVarWorkflowInitiator)
-	shouldExcludeWorkflowInitiatorRaw := os.Getenv(envVarExcludeWorkflowInitiatorAsApprover)
-	shouldExcludeWorkflowInitiator, parseBoolErr := strconv.ParseBool(shouldExcludeWorkflowInitiatorRaw)
-	if parseBoolErr != nil {
-		return nil, fmt.Errorf("error parsing exclude-workflow-initiator-as-approver flag: %w", parseBoolErr)
+// groupExpander expands an approver that names a group of users, such as a
+// GitHub team, into its members. It returns nil if the approver isn't a
+// group.
+type groupExpander func(userOrTeam, workflowInitiator string, shouldExcludeWorkflowInitiator bool) []string
+
+// excludeWorkflowInitiator parses the exclude-workflow-initiator-as-approver
+// input.
+func excludeWorkflowInitiator(in inputs) (bool, error) {
+	shouldExcludeWorkflowInitiatorRaw := in.get(envVarExcludeWorkflowInitiatorAsApprover)
+	if shouldExcludeWorkflowInitiatorRaw == "" {
+		return false, nil
+	}
+	shouldExcludeWorkflowInitiator, err := strconv.ParseBool(shouldExcludeWorkflowInitiatorRaw)
+	if err != nil {
+		return false, fmt.Errorf("error parsing exclude-workflow-initiator-as-approver flag: %w", err)
+	}
+	return shouldExcludeWorkflowInitiator, nil
+}
+
+// retrieveApprovers resolves the approvers input. A plain name is tried as a
+// group through expandGroup and is otherwise a user. user:<login> is always a
+// user, and @org/team always a team, expanded through expandTeams. A
+// role:<role> approver selects the collaborators with that role, through
+// expandRole. expandTeams and expandRole are nil where they aren't supported.
+// The approvers that are only selected by a role are returned with their
+// lowest role.
+func retrieveApprovers(in inputs, log io.Writer, expandGroup groupExpander, expandTeams teamsExpander, expandRole roleExpander, workflowInitiator string) ([]string, map[string]repositoryRole, error) {
+	shouldExcludeWorkflowInitiator, err := excludeWorkflowInitiator(in)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	approvers := []string{}
-	requiredApproversRaw := os.Getenv(envVarApprovers)
+	requiredApproversRaw := in.get(envVarApprovers)
 	requiredApprovers := strings.Split(requiredApproversRaw, ",")
 
 	for i := range requiredApprovers {
 		requiredApprovers[i] = strings.TrimSpace(requiredApprovers[i])
 	}
 
+	// Teams are expanded all at once, so that they can be listed
+	// concurrently.
+	var teams []teamRef
+	for _, approverUser := range requiredApprovers {
+		team, isTeam, err := parseTeamRef(approverUser)
+		if err != nil {
+			return nil, nil, err
+		}
+		if isTeam {
+			if expandTeams == nil {
+				return nil, nil, fmt.Errorf("approver %q: @org/team approvers are not supported with this backend", approverUser)
+			}
+			teams = append(teams, team)
+		}
+	}
+	var teamMembers map[teamRef][]string
+	if len(teams) > 0 {
+		teamMembers, err = expandTeams(teams)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	roleApprovers := map[string]repositoryRole{}
+	explicitApprovers := map[string]bool{}
+	addUser := func(user, source string) {
+		if strings.EqualFold(workflowInitiator, user) && shouldExcludeWorkflowInitiator {
+			fmt.Fprintf(log, "Not adding user '%s'%s as an approver as they are the workflow initiator\n", user, source)
+			return
+		}
+		approvers = append(approvers, user)
+		explicitApprovers[strings.ToLower(user)] = true
+	}
 	for _, approverUser := range requiredApprovers {
-		expandedUsers := expandGroupFromUser(client, repoOwner, approverUser, workflowInitiator, shouldExcludeWorkflowInitiator)
+		if team, isTeam, _ := parseTeamRef(approverUser); isTeam {
+			for _, member := range teamMembers[team] {
+				addUser(member, fmt.Sprintf(" from team '%s'", team))
+			}
+			continue
+		}
+		if login, isUser := cutUserPrefix(approverUser); isUser {
+			addUser(login, "")
+			continue
+		}
+
+		role, isRole, err := parseRoleSelector(approverUser)
+		if err != nil {
+			return nil, nil, err
+		}
+		if isRole {
+			if expandRole == nil {
+				return nil, nil, fmt.Errorf("approver %q: roles are only supported with GitHub", approverUser)
+			}
+			users, err := expandRole(role, workflowInitiator, shouldExcludeWorkflowInitiator)
+			if err != nil {
+				return nil, nil, err
+			}
+			for _, user := range users {
+				if current, ok := roleApprovers[strings.ToLower(user)]; !ok || roleRanks[string(role)] < roleRanks[string(current)] {
+					roleApprovers[strings.ToLower(user)] = role
+				}
+			}
+			approvers = append(approvers, users...)
+			continue
+		}
+
+		expandedUsers := expandGroup(approverUser, workflowInitiator, shouldExcludeWorkflowInitiator)
 		if expandedUsers != nil {
 			approvers = append(approvers, expandedUsers...)
-		} else if strings.EqualFold(workflowInitiator, approverUser) && shouldExcludeWorkflowInitiator {
-			fmt.Printf("Not adding user '%s' as an approver as they are the workflow initiator\n", approverUser)
+			for _, user := range expandedUsers {
+				explicitApprovers[strings.ToLower(user)] = true
+			}
 		} else {
-			approvers = append(approvers, approverUser)
+			addUser(approverUser, "")
 		}
 	}
+	for user := range explicitApprovers {
+		delete(roleApprovers, user)
+	}
 
 	approvers = deduplicateUsers(approvers)
 
-	minimumApprovalsRaw := os.Getenv(envVarMinimumApprovals)
+	minimumApprovalsRaw := in.get(envVarMinimumApprovals)
 	minimumApprovals := len(approvers)
-	var err error
 	if minimumApprovalsRaw != "" {
 		minimumApprovals, err = strconv.Atoi(minimumApprovalsRaw)
 		if err != nil {
-			return nil, fmt.Errorf("error parsing minimum number of approvals: %w", err)
+			return nil, nil, fmt.Errorf("error parsing minimum number of approvals: %w", err)
 		}
 	}
 
 	if minimumApprovals > len(approvers) {
-		return nil, fmt.Errorf("error: minimum required approvals (%d) is greater than the total number of approvers (%d)", minimumApprovals, len(approvers))
+		return nil, nil, fmt.Errorf("error: minimum required approvals (%d) is greater than the total number of approvers (%d)", minimumApprovals, len(approvers))
 	}
 
-	return approvers, nil
+	return approvers, roleApprovers, nil
 }
 
-func expandGroupFromUser(client *github.Client, org, userOrTeam string, workflowInitiator string, shouldExcludeWorkflowInitiator bool) []string {
-	fmt.Printf("Attempting to expand user %s/%s as a group (may not succeed)\n", org, userOrTeam)
+func expandGroupFromUser(log io.Writer, client *github.Client, org, userOrTeam string, workflowInitiator string, shouldExcludeWorkflowInitiator bool) []string {
+	fmt.Fprintf(log, "Attempting to expand user %s/%s as a group (may not succeed)\n", org, userOrTeam)
 
 	// GitHub replaces periods in the team name with hyphens. If a period is
 	// passed to the request it would result in a 404. So we need to replace
 	// and occurrences with a hyphen.
 	formattedUserOrTeam := strings.ReplaceAll(userOrTeam, ".", "-")
 
-	users, _, err := client.Teams.ListTeamMembersBySlug(context.Background(), org, formattedUserOrTeam, &github.TeamListTeamMembersOptions{})
+	logins, err := listGitHubTeamMembers(context.Background(), client, org, formattedUserOrTeam)
 	if err != nil {
-		fmt.Printf("%v\n", err)
+		fmt.Fprintf(log, "%v\n", err)
 		return nil
 	}
 
-	userNames := make([]string, 0, len(users))
-	for _, user := range users {
-		userName := user.GetLogin()
+	userNames := make([]string, 0, len(logins))
+	for _, userName := range logins {
 		if strings.EqualFold(userName, workflowInitiator) && shouldExcludeWorkflowInitiator {
-			fmt.Printf("Not adding user '%s' from group '%s' as an approver as they are the workflow initiator\n", userName, userOrTeam)
+			fmt.Fprintf(log, "Not adding user '%s' from group '%s' as an approver as they are the workflow initiator\n", userName, userOrTeam)
 		} else {
 			userNames = append(userNames, userName)
 		}
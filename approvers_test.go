@@ -1,6 +1,7 @@
 package main
 
 import (
+	"io"
 	"reflect"
 	"testing"
 )
@@ -36,3 +37,63 @@ func TestDeduplicateUsers(t *testing.T) {
 		})
 	}
 }
+
+func TestRetrieveApproversWithRoles(t *testing.T) {
+	t.Setenv(envVarApprovers, "role:write, login2, role:admin")
+	t.Setenv(envVarMinimumApprovals, "")
+	t.Setenv(envVarExcludeWorkflowInitiatorAsApprover, "")
+	expandGroup := func(string, string, bool) []string { return nil }
+	expandRole := func(role repositoryRole, workflowInitiator string, shouldExcludeWorkflowInitiator bool) ([]string, error) {
+		if role == roleAdmin {
+			return []string{"login1"}, nil
+		}
+		return []string{"login1", "login2", "login3"}, nil
+	}
+
+	approvers, roleApprovers, err := retrieveApprovers(inputs{}, io.Discard, expandGroup, nil, expandRole, "")
+	if err != nil {
+		t.Fatalf("error retrieving approvers: %v", err)
+	}
+	if expected := []string{"login1", "login2", "login3"}; !reflect.DeepEqual(approvers, expected) {
+		t.Fatalf("approvers %v, expected %v", approvers, expected)
+	}
+	expectedRoles := map[string]repositoryRole{"login1": roleWrite, "login3": roleWrite}
+	if !reflect.DeepEqual(roleApprovers, expectedRoles) {
+		t.Fatalf("role approvers %v, expected %v", roleApprovers, expectedRoles)
+	}
+
+	if _, _, err := retrieveApprovers(inputs{}, io.Discard, expandGroup, nil, nil, ""); err == nil {
+		t.Fatalf("expected an error for roles without a role expander")
+	}
+}
+
+func TestRetrieveApproversWithPrefixes(t *testing.T) {
+	t.Setenv(envVarApprovers, "user:myteam, @Other-Org/SRE, login2")
+	t.Setenv(envVarMinimumApprovals, "")
+	t.Setenv(envVarExcludeWorkflowInitiatorAsApprover, "true")
+	expandGroup := func(userOrTeam, workflowInitiator string, shouldExcludeWorkflowInitiator bool) []string {
+		if userOrTeam == "myteam" {
+			t.Errorf("user:myteam was expanded as a group")
+		}
+		return nil
+	}
+	expandTeams := func(teams []teamRef) (map[teamRef][]string, error) {
+		expected := []teamRef{{org: "other-org", name: "sre"}}
+		if !reflect.DeepEqual(teams, expected) {
+			t.Errorf("teams %v, expected %v", teams, expected)
+		}
+		return map[teamRef][]string{{org: "other-org", name: "sre"}: {"login3", "login4"}}, nil
+	}
+
+	approvers, _, err := retrieveApprovers(inputs{}, io.Discard, expandGroup, expandTeams, nil, "login4")
+	if err != nil {
+		t.Fatalf("error retrieving approvers: %v", err)
+	}
+	if expected := []string{"myteam", "login3", "login2"}; !reflect.DeepEqual(approvers, expected) {
+		t.Fatalf("approvers %v, expected %v", approvers, expected)
+	}
+
+	if _, _, err := retrieveApprovers(inputs{}, io.Discard, expandGroup, nil, nil, ""); err == nil {
+		t.Fatalf("expected an error for teams without a teams expander")
+	}
+}
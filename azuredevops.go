@@ -0,0 +1,278 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v43/github"
+
+	"github.com/trstringer/manual-approval/pkg/approval"
+)
+
+const (
+	azureDevOpsAPIVersion         string = "7.1"
+	azureDevOpsCommentsAPIVersion string = "7.1-preview.4"
+)
+
+// azureDevOpsClient is a minimal client for the Azure DevOps REST API of a
+// single project, authenticated with a personal access token.
+type azureDevOpsClient struct {
+	restClient
+}
+
+// newAzureDevOpsClient connects to the project SYSTEM_TEAMPROJECT in the
+// collection at SYSTEM_COLLECTIONURI, e.g. https://dev.azure.com/org/.
+func newAzureDevOpsClient(in inputs) *azureDevOpsClient {
+	projectURL := fmt.Sprintf("%s/%s", strings.TrimRight(in.get(envVarAzureCollectionURI), "/"), url.PathEscape(in.get(envVarAzureTeamProject)))
+	authorization := "Basic " + base64.StdEncoding.EncodeToString([]byte(":"+in.get(envVarToken)))
+	return &azureDevOpsClient{
+		restClient: newRESTClient("azure devops", projectURL, func(req *http.Request) {
+			req.Header.Set("Authorization", authorization)
+		}),
+	}
+}
+
+func validateAzureDevOpsInput(in inputs) error {
+	missingEnvVars := []string{}
+	for _, envVar := range []string{envVarAzureCollectionURI, envVarAzureTeamProject, envVarAzureBuildID, envVarToken} {
+		if in.get(envVar) == "" {
+			missingEnvVars = append(missingEnvVars, envVar)
+		}
+	}
+
+	if len(missingEnvVars) > 0 {
+		return fmt.Errorf("missing env vars: %v", missingEnvVars)
+	}
+	return nil
+}
+
+// azureDevOpsRunURL links to the results of the build waiting for approval.
+func azureDevOpsRunURL(collectionURI, project, buildID string) string {
+	return fmt.Sprintf("%s/%s/_build/results?buildId=%s", strings.TrimRight(collectionURI, "/"), url.PathEscape(project), url.QueryEscape(buildID))
+}
+
+type azureDevOpsPatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value"`
+}
+
+type azureDevOpsIdentity struct {
+	DisplayName string `json:"displayName"`
+	UniqueName  string `json:"uniqueName"`
+}
+
+type azureDevOpsWorkItem struct {
+	ID     int `json:"id"`
+	Fields struct {
+		State     string              `json:"System.State"`
+		CreatedBy azureDevOpsIdentity `json:"System.CreatedBy"`
+	} `json:"fields"`
+	Links struct {
+		HTML struct {
+			Href string `json:"href"`
+		} `json:"html"`
+	} `json:"_links"`
+}
+
+type azureDevOpsComment struct {
+	ID           int64               `json:"id"`
+	Text         string              `json:"text"`
+	IsDeleted    bool                `json:"isDeleted"`
+	CreatedBy    azureDevOpsIdentity `json:"createdBy"`
+	CreatedDate  time.Time           `json:"createdDate"`
+	ModifiedDate time.Time           `json:"modifiedDate"`
+}
+
+// azureDevOpsWorkItems is the issue backend of Azure Boards. Requests are
+// made as work items of workItemType in the client's project, and closed
+// into approvedState or deniedState.
+type azureDevOpsWorkItems struct {
+	client        *azureDevOpsClient
+	workItemType  string
+	approvedState string
+	deniedState   string
+}
+
+func newAzureDevOpsChannel(target approvalTarget, apprv *approvalEnvironment, client *azureDevOpsClient, workItemType, approvedState, deniedState string) (approval.Channel, error) {
+	if target != approvalTargetIssue {
+		return nil, fmt.Errorf("target %q is not supported with the %s backend", target, backendAzureDevOps)
+	}
+	if apprv.existingIssueNumber > 0 {
+		return nil, fmt.Errorf("issue-number is not supported with the %s backend", backendAzureDevOps)
+	}
+	if apprv.reactionMapping != nil {
+		return nil, fmt.Errorf("allow-reactions is not supported with the %s backend", backendAzureDevOps)
+	}
+	if err := checkIssueOnlyInputs(apprv, fmt.Sprintf("the %s backend", backendAzureDevOps)); err != nil {
+		return nil, err
+	}
+	return &issueChannel{
+		apprv: apprv,
+		backend: azureDevOpsWorkItems{
+			client:        client,
+			workItemType:  workItemType,
+			approvedState: approvedState,
+			deniedState:   deniedState,
+		},
+	}, nil
+}
+
+func (b azureDevOpsWorkItems) workItemPath(number int) string {
+	return fmt.Sprintf("_apis/wit/workitems/%d?api-version=%s", number, azureDevOpsAPIVersion)
+}
+
+func (b azureDevOpsWorkItems) commentsPath(number int, query string) string {
+	return fmt.Sprintf("_apis/wit/workItems/%d/comments?api-version=%s%s", number, azureDevOpsCommentsAPIVersion, query)
+}
+
+func (b azureDevOpsWorkItems) CreateIssue(ctx context.Context, owner, repo string, request *github.IssueRequest) (*github.Issue, error) {
+	operations := []azureDevOpsPatchOperation{
+		{Op: "add", Path: "/fields/System.Title", Value: request.GetTitle()},
+		{Op: "add", Path: "/fields/System.Description", Value: request.GetBody()},
+		{Op: "add", Path: "/multilineFieldsFormat/System.Description", Value: "Markdown"},
+	}
+	// A work item has a single assignee. All approvers are listed in the
+	// description.
+	if assignees := request.GetAssignees(); len(assignees) > 0 {
+		operations = append(operations, azureDevOpsPatchOperation{Op: "add", Path: "/fields/System.AssignedTo", Value: assignees[0]})
+	}
+	if labels := request.GetLabels(); len(labels) > 0 {
+		operations = append(operations, azureDevOpsPatchOperation{Op: "add", Path: "/fields/System.Tags", Value: strings.Join(labels, "; ")})
+	}
+
+	var created azureDevOpsWorkItem
+	path := fmt.Sprintf("_apis/wit/workitems/$%s?api-version=%s", url.PathEscape(b.workItemType), azureDevOpsAPIVersion)
+	// Work items are created and updated with JSON patch documents.
+	if _, err := b.client.send(ctx, "POST", path, "application/json-patch+json", operations, &created); err != nil {
+		return nil, err
+	}
+	return b.issue(created), nil
+}
+
+func (b azureDevOpsWorkItems) GetIssue(ctx context.Context, owner, repo string, number int) (*github.Issue, error) {
+	var workItem azureDevOpsWorkItem
+	if err := b.client.do(ctx, "GET", b.workItemPath(number), nil, &workItem); err != nil {
+		return nil, err
+	}
+	return b.issue(workItem), nil
+}
+
+// issue converts a work item to an issue. A work item in the approved or
+// denied state is closed.
+func (b azureDevOpsWorkItems) issue(workItem azureDevOpsWorkItem) *github.Issue {
+	state := "open"
+	if workItem.Fields.State == b.approvedState || workItem.Fields.State == b.deniedState {
+		state = "closed"
+	}
+	return &github.Issue{
+		Number:  github.Int(workItem.ID),
+		HTMLURL: github.String(workItem.Links.HTML.Href),
+		State:   github.String(state),
+		User:    &github.User{Login: github.String(workItem.Fields.CreatedBy.UniqueName)},
+	}
+}
+
+func (b azureDevOpsWorkItems) ListComments(ctx context.Context, owner, repo string, number int) ([]*github.IssueComment, error) {
+	var azureComments []azureDevOpsComment
+	continuationToken := ""
+	for {
+		query := "&order=asc"
+		if continuationToken != "" {
+			query += "&continuationToken=" + url.QueryEscape(continuationToken)
+		}
+		var page struct {
+			Comments          []azureDevOpsComment `json:"comments"`
+			ContinuationToken string               `json:"continuationToken"`
+		}
+		if err := b.client.do(ctx, "GET", b.commentsPath(number, query), nil, &page); err != nil {
+			return nil, err
+		}
+		azureComments = append(azureComments, page.Comments...)
+		if page.ContinuationToken == "" {
+			return issueCommentsFromAzureDevOps(azureComments), nil
+		}
+		continuationToken = page.ContinuationToken
+	}
+}
+
+func (b azureDevOpsWorkItems) PostComment(ctx context.Context, owner, repo string, number int, body string) (*github.IssueComment, error) {
+	var comment azureDevOpsComment
+	if err := b.client.do(ctx, "POST", b.commentsPath(number, ""), map[string]string{"text": body}, &comment); err != nil {
+		return nil, err
+	}
+	return comment.comment(), nil
+}
+
+// ListReactions returns no reactions, as allow-reactions is rejected for
+// work items.
+func (b azureDevOpsWorkItems) ListReactions(ctx context.Context, owner, repo string, number int) ([]issueReaction, error) {
+	return nil, nil
+}
+
+// Close moves a work item to the approved state, or to the denied state if
+// the request wasn't approved.
+func (b azureDevOpsWorkItems) Close(ctx context.Context, owner, repo string, number int, approved bool) error {
+	state := b.deniedState
+	if approved {
+		state = b.approvedState
+	}
+	operations := []azureDevOpsPatchOperation{
+		{Op: "add", Path: "/fields/System.State", Value: state},
+	}
+	if _, err := b.client.send(ctx, "PATCH", b.workItemPath(number), "application/json-patch+json", operations, nil); err != nil {
+		return fmt.Errorf("error moving work item to %s: %w", state, err)
+	}
+	return nil
+}
+
+// Reopen always fails: a work item type's initial state isn't known, and
+// closing a work item is never a vote with this backend.
+func (b azureDevOpsWorkItems) Reopen(ctx context.Context, owner, repo string, number int) error {
+	return fmt.Errorf("reopening work items is not supported with the %s backend", backendAzureDevOps)
+}
+
+// issueCommentsFromAzureDevOps converts work item comments, which are stored
+// as HTML, to plain text issue comments. Commenters are identified by their
+// unique name, usually their sign in address.
+func issueCommentsFromAzureDevOps(azureComments []azureDevOpsComment) []*github.IssueComment {
+	comments := make([]*github.IssueComment, 0, len(azureComments))
+	for _, ac := range azureComments {
+		if ac.IsDeleted {
+			continue
+		}
+		comments = append(comments, ac.comment())
+	}
+	return comments
+}
+
+func (ac azureDevOpsComment) comment() *github.IssueComment {
+	return &github.IssueComment{
+		ID:        github.Int64(ac.ID),
+		Body:      github.String(textFromHTML(ac.Text)),
+		User:      &github.User{Login: github.String(ac.CreatedBy.UniqueName)},
+		CreatedAt: &ac.CreatedDate,
+		UpdatedAt: &ac.ModifiedDate,
+	}
+}
+
+var (
+	htmlLineBreakRegex = regexp.MustCompile(`(?i)<br\s*/?>|</(?:p|div|li|h[1-6]|blockquote|pre)>`)
+	htmlTagRegex       = regexp.MustCompile(`<[^>]*>`)
+)
+
+// textFromHTML reduces an HTML comment to its text, keeping line breaks.
+func textFromHTML(s string) string {
+	s = htmlLineBreakRegex.ReplaceAllString(s, "\n")
+	s = htmlTagRegex.ReplaceAllString(s, "")
+	s = html.UnescapeString(s)
+	s = strings.ReplaceAll(s, "\u00a0", " ")
+	return strings.TrimSpace(s)
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/trstringer/manual-approval/pkg/approval"
+)
+
+// fakeAzureDevOps is an in-memory fake of the parts of the Azure DevOps
+// work item tracking API used by the Azure DevOps backend.
+type fakeAzureDevOps struct {
+	fakeAPI
+
+	commentPolls   [][]azureDevOpsComment
+	comments       []azureDevOpsComment
+	fields         map[string]interface{}
+	format         string
+	postedComments []string
+}
+
+func (f *fakeAzureDevOps) route(w http.ResponseWriter, r *http.Request) bool {
+	switch r.Method + " " + r.URL.Path {
+	case "POST /org/My Project/_apis/wit/workitems/$Task":
+		f.patch(r)
+		f.writeJSON(w, map[string]interface{}{
+			"id":     7,
+			"fields": map[string]interface{}{"System.CreatedBy": map[string]string{"uniqueName": "build@example.com"}},
+			"_links": map[string]interface{}{"html": map[string]string{"href": "https://dev.azure.com/org/My%20Project/_workitems/edit/7"}},
+		})
+	case "PATCH /org/My Project/_apis/wit/workitems/7":
+		f.patch(r)
+		f.writeJSON(w, map[string]interface{}{"id": 7})
+	case "POST /org/My Project/_apis/wit/workItems/7/comments":
+		var comment struct {
+			Text string `json:"text"`
+		}
+		f.readJSON(r, &comment)
+		f.postedComments = append(f.postedComments, comment.Text)
+		f.writeJSON(w, map[string]interface{}{"id": 1000 + len(f.postedComments)})
+	case "GET /org/My Project/_apis/wit/workItems/7/comments":
+		if r.URL.Query().Get("continuationToken") == "" && len(f.commentPolls) > 0 {
+			f.comments = append(f.comments, f.commentPolls[0]...)
+			f.commentPolls = f.commentPolls[1:]
+		}
+		// One comment per page, to exercise the continuation token.
+		index := 0
+		if token := r.URL.Query().Get("continuationToken"); token != "" {
+			index = len(token)
+		}
+		page := map[string]interface{}{"comments": []azureDevOpsComment{}}
+		if index < len(f.comments) {
+			page["comments"] = f.comments[index : index+1]
+		}
+		if index+1 < len(f.comments) {
+			page["continuationToken"] = strings.Repeat("x", index+1)
+		}
+		f.writeJSON(w, page)
+	default:
+		return false
+	}
+	return true
+}
+
+// patch applies a work item JSON patch document to the fake's fields.
+func (f *fakeAzureDevOps) patch(r *http.Request) {
+	if contentType := r.Header.Get("Content-Type"); contentType != "application/json-patch+json" {
+		f.t.Errorf("content type %q, expected application/json-patch+json", contentType)
+	}
+	var operations []azureDevOpsPatchOperation
+	f.readJSON(r, &operations)
+	if f.fields == nil {
+		f.fields = map[string]interface{}{}
+	}
+	for _, operation := range operations {
+		if operation.Path == "/multilineFieldsFormat/System.Description" {
+			f.format, _ = operation.Value.(string)
+			continue
+		}
+		f.fields[strings.TrimPrefix(operation.Path, "/fields/")] = operation.Value
+	}
+}
+
+func TestTextFromHTML(t *testing.T) {
+	testCases := []struct {
+		name     string
+		html     string
+		expected string
+	}{
+		{
+			name:     "plain_text",
+			html:     "approved",
+			expected: "approved",
+		},
+		{
+			name:     "paragraph",
+			html:     "<div>LGTM&nbsp;</div>",
+			expected: "LGTM",
+		},
+		{
+			name:     "lines",
+			html:     "<p>/approve</p><p>looks good to me</p>",
+			expected: "/approve\nlooks good to me",
+		},
+		{
+			name:     "mention_and_entities",
+			html:     `<div><a href="#" data-vss-mention="version:2.0,1">@Login One</a> deny, it&#39;s &lt;broken&gt;<br></div>`,
+			expected: "@Login One deny, it's <broken>",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			actual := textFromHTML(testCase.html)
+			if actual != testCase.expected {
+				t.Fatalf("actual %q, expected %q", actual, testCase.expected)
+			}
+		})
+	}
+}
+
+func TestAzureDevOpsRunApproval(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	comment := func(id int64, uniqueName, text string, deleted bool) azureDevOpsComment {
+		c := azureDevOpsComment{ID: id, Text: text, IsDeleted: deleted, CreatedDate: start.Add(time.Duration(id) * time.Minute)}
+		c.ModifiedDate = c.CreatedDate
+		c.CreatedBy.UniqueName = uniqueName
+		return c
+	}
+
+	testCases := []struct {
+		name             string
+		commentPolls     [][]azureDevOpsComment
+		expectedExitCode int
+		expectedStatus   string
+		expectedState    string
+	}{
+		{
+			name: "approved_by_comments",
+			commentPolls: [][]azureDevOpsComment{
+				{comment(1, "login1@example.com", "<div>approved</div>", false)},
+				{comment(2, "build@example.com", "<p>lgtm</p>", false), comment(3, "Login2@example.com", "<p>LGTM&nbsp;</p>", false)},
+			},
+			expectedExitCode: 0,
+			expectedStatus:   "approval-status=approved",
+			expectedState:    "Closed",
+		},
+		{
+			name: "denied_by_comment",
+			commentPolls: [][]azureDevOpsComment{
+				{comment(1, "login1@example.com", "<div>approved</div>", false), comment(2, "login2@example.com", "<div>deny</div>", false)},
+			},
+			expectedExitCode: 1,
+			expectedStatus:   "approval-status=denied",
+			expectedState:    "Removed",
+		},
+		{
+			name: "deleted_denial_ignored",
+			commentPolls: [][]azureDevOpsComment{
+				{comment(1, "login2@example.com", "deny", true)},
+				{comment(2, "login1@example.com", "yes", false), comment(3, "login2@example.com", "yes", false)},
+			},
+			expectedExitCode: 0,
+			expectedStatus:   "approval-status=approved",
+			expectedState:    "Closed",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			fake := &fakeAzureDevOps{commentPolls: testCase.commentPolls}
+			serverURL := fake.serve(t, func(r *http.Request) bool {
+				// The PAT is sent as the password of basic auth, with an empty user.
+				user, password, ok := r.BasicAuth()
+				return ok && user == "" && password == "secret"
+			}, fake.route)
+			t.Setenv(envVarAzureCollectionURI, serverURL+"/org/")
+			t.Setenv(envVarAzureTeamProject, "My Project")
+			t.Setenv(envVarToken, "secret")
+			client := newAzureDevOpsClient(inputs{})
+
+			apprv, err := newApprovalEnvironment(approvalOptions{
+				repoFullName:        "My Project/repo",
+				repoOwner:           "My Project",
+				runID:               99,
+				issueApprovers:      []string{"login1@example.com", "login2@example.com"},
+				targetRepoOwner:     "My Project",
+				targetRepoName:      "repo",
+				failOnDenial:        true,
+				issueLabels:         []string{"deploy", "production"},
+				editedCommentPolicy: editedCommentPolicyReevaluate,
+				commentSyntax:       approval.CommentSyntaxKeywords,
+				target:              approvalTargetIssue,
+				workflowRunURL:      azureDevOpsRunURL("https://dev.azure.com/org/", "My Project", "99"),
+			})
+			if err != nil {
+				t.Fatalf("error creating approval environment: %v", err)
+			}
+			requestChannel, err := newAzureDevOpsChannel(approvalTargetIssue, apprv, client, defaultWorkItemType, defaultWorkItemApprovedState, defaultWorkItemDeniedState)
+			if err != nil {
+				t.Fatalf("error creating channel: %v", err)
+			}
+
+			runTestApproval(t, apprv, requestChannel, testCase.expectedExitCode, testCase.expectedStatus, "issue-number=7", "issue-url=https://dev.azure.com/org/My%20Project/_workitems/edit/7")
+
+			fake.mu.Lock()
+			defer fake.mu.Unlock()
+			if fake.fields["System.State"] != testCase.expectedState {
+				t.Fatalf("state %v, expected %s", fake.fields["System.State"], testCase.expectedState)
+			}
+			if fake.fields["System.AssignedTo"] != "login1@example.com" {
+				t.Fatalf("assigned to %v, expected login1@example.com", fake.fields["System.AssignedTo"])
+			}
+			if fake.fields["System.Tags"] != "deploy; production" {
+				t.Fatalf("tags %v, expected \"deploy; production\"", fake.fields["System.Tags"])
+			}
+			if fake.format != "Markdown" {
+				t.Fatalf("description format %q, expected Markdown", fake.format)
+			}
+			description, _ := fake.fields["System.Description"].(string)
+			if !strings.Contains(description, "https://dev.azure.com/org/My%20Project/_build/results?buildId=99") {
+				t.Fatalf("description %q doesn't link to the build", description)
+			}
+		})
+	}
+}
+
+func TestNewAzureDevOpsChannelRejectsIssueOnlyInputs(t *testing.T) {
+	apprv, err := newApprovalEnvironment(approvalOptions{
+		repoFullName:        "My Project/repo",
+		repoOwner:           "My Project",
+		runID:               99,
+		issueApprovers:      []string{"login1@example.com"},
+		targetRepoOwner:     "My Project",
+		targetRepoName:      "repo",
+		failOnDenial:        true,
+		editedCommentPolicy: editedCommentPolicyReevaluate,
+		commentSyntax:       approval.CommentSyntaxKeywords,
+		checklist:           []string{"DB backup verified"},
+		target:              approvalTargetIssue,
+	})
+	if err != nil {
+		t.Fatalf("error creating approval environment: %v", err)
+	}
+	if _, err := newAzureDevOpsChannel(approvalTargetIssue, apprv, &azureDevOpsClient{}, defaultWorkItemType, defaultWorkItemApprovedState, defaultWorkItemDeniedState); err == nil {
+		t.Fatalf("expected an error for checklist")
+	}
+}
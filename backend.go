@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/google/go-github/v43/github"
+
+	"github.com/trstringer/manual-approval/pkg/approval"
+)
+
+// backend selects the tracker the approval request is made in.
+type backend string
+
+const (
+	backendGitHub      backend = "github"
+	backendGitLab      backend = "gitlab"
+	backendForgejo     backend = "forgejo"
+	backendAzureDevOps backend = "azure-devops"
+	backendJira        backend = "jira"
+	backendServiceNow  backend = "servicenow"
+)
+
+// parseBackend parses the backend input. Without one, the backend is
+// detected from the CI environment, see detectBackend.
+func parseBackend(log io.Writer, raw string) (backend, error) {
+	switch b := backend(strings.ToLower(strings.TrimSpace(raw))); b {
+	case "":
+		detected, reason := detectBackend()
+		fmt.Fprintf(log, "Using the %s backend, as %s. Set the backend input to use another one.\n", detected, reason)
+		return detected, nil
+	case "gitea":
+		return backendForgejo, nil
+	case backendGitHub, backendGitLab, backendForgejo, backendAzureDevOps, backendJira, backendServiceNow:
+		return b, nil
+	default:
+		return "", fmt.Errorf("unknown backend %q, expected %q, %q, %q, %q, %q or %q", raw, backendGitHub, backendGitLab, backendForgejo, backendAzureDevOps, backendJira, backendServiceNow)
+	}
+}
+
+// detectBackend picks the backend from the variables CI systems set, and
+// says which one it went by. Runners that set none of them, like older
+// Gitea runners, fall back to GitHub, so they need backend: forgejo.
+func detectBackend() (backend, string) {
+	switch {
+	case os.Getenv(envVarGitLabCI) == "true":
+		return backendGitLab, "GITLAB_CI is true"
+	case os.Getenv(envVarForgejoActions) == "true":
+		return backendForgejo, "FORGEJO_ACTIONS is true"
+	case os.Getenv(envVarGiteaActions) == "true":
+		return backendForgejo, "GITEA_ACTIONS is true"
+	case strings.EqualFold(os.Getenv(envVarAzureTFBuild), "true"):
+		return backendAzureDevOps, "TF_BUILD is true"
+	default:
+		return backendGitHub, "no other CI system was detected"
+	}
+}
+
+// backendConnection is how the approval uses the selected backend: how
+// approvers are expanded and how the request is made.
+type backendConnection struct {
+	// client is the GitHub or Forgejo client, which also reads the config
+	// file and CODEOWNERS. It is nil for the other backends.
+	client      *github.Client
+	expandGroup groupExpander
+	expandTeams teamsExpander
+	expandRole  roleExpander
+	// permission returns the current permission of a user on the
+	// repository, for approvers selected by a role.
+	permission func(ctx context.Context, user string) (string, error)
+	// runURL links to the run waiting for approval on backends whose runs
+	// don't live on GitHub.
+	runURL     string
+	newChannel func(apprv *approvalEnvironment) (approval.Channel, error)
+}
+
+// backendConnector connects to the selected backend for the repository the
+// workflow runs in.
+type backendConnector func(ctx context.Context, in inputs, log io.Writer, selected backend, repoOwner, repoFullName string) (*backendConnection, error)
+
+// connectBackend connects to the selected backend with the credentials and
+// settings of the inputs. Backends without groups don't expand
+// approvers, and those whose requests carry their own approvers, like
+// ServiceNow, leave expandGroup nil.
+func connectBackend(ctx context.Context, in inputs, log io.Writer, selected backend, repoOwner, repoFullName string) (*backendConnection, error) {
+	_, repoName, _ := strings.Cut(repoFullName, "/")
+	switch selected {
+	case backendServiceNow:
+		return &backendConnection{
+			newChannel: func(apprv *approvalEnvironment) (approval.Channel, error) {
+				changeType, err := parseServiceNowChangeType(in.get(envVarServiceNowChangeType))
+				if err != nil {
+					return nil, fmt.Errorf("error parsing servicenow-change-type: %w", err)
+				}
+				return newServiceNowChannel(apprv.target, apprv, newServiceNowClient(in), changeType, strings.TrimSpace(in.get(envVarServiceNowStandardChangeTemplate)), strings.TrimSpace(in.get(envVarServiceNowAssignmentGroup)))
+			},
+		}, nil
+	case backendAzureDevOps:
+		// Approvers are identities, not groups, so there is nothing to
+		// expand.
+		azureDevOps := newAzureDevOpsClient(in)
+		return &backendConnection{
+			expandGroup: func(string, string, bool) []string { return nil },
+			runURL:      azureDevOpsRunURL(in.get(envVarAzureCollectionURI), in.get(envVarAzureTeamProject), in.get(envVarAzureBuildID)),
+			newChannel: func(apprv *approvalEnvironment) (approval.Channel, error) {
+				return newAzureDevOpsChannel(apprv.target, apprv, azureDevOps, in.getOrDefault(envVarWorkItemType, defaultWorkItemType), in.getOrDefault(envVarWorkItemApprovedState, defaultWorkItemApprovedState), in.getOrDefault(envVarWorkItemDeniedState, defaultWorkItemDeniedState))
+			},
+		}, nil
+	case backendGitLab:
+		gitLab := newGitLabClient(in)
+		project := gitLabProject(in.get(envVarGitLabProjectID), in.get(envVarTargetRepoOwner), in.get(envVarTargetRepo))
+		return &backendConnection{
+			expandGroup: func(userOrTeam, workflowInitiator string, shouldExcludeWorkflowInitiator bool) []string {
+				return gitLab.groupMembers(ctx, log, userOrTeam, workflowInitiator, shouldExcludeWorkflowInitiator)
+			},
+			runURL: in.get(envVarGitLabPipelineURL),
+			newChannel: func(apprv *approvalEnvironment) (approval.Channel, error) {
+				return newGitLabChannel(apprv.target, apprv, gitLab, project)
+			},
+		}, nil
+	}
+
+	client, err := newGithubClient(ctx, in)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to server: %w", err)
+	}
+	if selected == backendForgejo {
+		return &backendConnection{
+			client: client,
+			expandGroup: func(userOrTeam, workflowInitiator string, shouldExcludeWorkflowInitiator bool) []string {
+				return forgejoTeamMembers(ctx, log, client, repoOwner, userOrTeam, workflowInitiator, shouldExcludeWorkflowInitiator)
+			},
+			// Forgejo teams aren't nested, so each is listed on its own.
+			expandTeams: func(teams []teamRef) (map[teamRef][]string, error) {
+				members := map[teamRef][]string{}
+				for _, team := range teams {
+					users := forgejoTeamMembers(ctx, log, client, team.org, team.name, "", false)
+					if users == nil {
+						return nil, fmt.Errorf("team %s not found", team)
+					}
+					members[team] = users
+				}
+				return members, nil
+			},
+			runURL: forgejoRunURL(in.get(envVarServerURL), repoFullName, in.get(envVarRunNumber)),
+			newChannel: func(apprv *approvalEnvironment) (approval.Channel, error) {
+				return newForgejoChannel(apprv.target, apprv, client)
+			},
+		}, nil
+	}
+	// Jira requests are made from GitHub workflows, so their approvers are
+	// GitHub users.
+	connection := &backendConnection{
+		client: client,
+		expandGroup: func(userOrTeam, workflowInitiator string, shouldExcludeWorkflowInitiator bool) []string {
+			return expandGroupFromUser(log, client, repoOwner, userOrTeam, workflowInitiator, shouldExcludeWorkflowInitiator)
+		},
+		expandTeams: func(teams []teamRef) (map[teamRef][]string, error) {
+			return expandGitHubTeams(ctx, log, client, teams)
+		},
+		newChannel: func(apprv *approvalEnvironment) (approval.Channel, error) {
+			return newJiraChannelFromInputs(in, apprv)
+		},
+	}
+	if selected == backendGitHub {
+		connection.expandRole = func(role repositoryRole, workflowInitiator string, shouldExcludeWorkflowInitiator bool) ([]string, error) {
+			return collaboratorsWithRole(ctx, log, client, repoOwner, repoName, role, workflowInitiator, shouldExcludeWorkflowInitiator)
+		}
+		connection.permission = func(ctx context.Context, user string) (string, error) {
+			return collaboratorPermission(ctx, client, repoOwner, repoName, user)
+		}
+		connection.newChannel = func(apprv *approvalEnvironment) (approval.Channel, error) {
+			return newApprovalChannel(apprv.target, apprv, client)
+		}
+	}
+	return connection, nil
+}
+
+// checkIssueOnlyInputs returns an error if an input only the GitHub issue
+// channel supports is set, as other backends and targets would silently
+// ignore it. where names them in the error, e.g. "the gitlab backend".
+func checkIssueOnlyInputs(apprv *approvalEnvironment, where string) error {
+	switch {
+	case apprv.closeIssueMeansDenial:
+		return fmt.Errorf("close-issue-means-denial is not supported with %s", where)
+	case len(apprv.issueClosers) > 0:
+		return fmt.Errorf("issue-closers is not supported with %s", where)
+	case apprv.closeIssueAsVote:
+		return fmt.Errorf("close-issue-as-vote is not supported with %s", where)
+	case len(apprv.checklist) > 0:
+		return fmt.Errorf("checklist is not supported with %s", where)
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/trstringer/manual-approval/pkg/approval"
+)
+
+func TestDetectBackend(t *testing.T) {
+	testCases := []struct {
+		name     string
+		env      map[string]string
+		expected backend
+	}{
+		{name: "github", expected: backendGitHub},
+		{name: "gitlab", env: map[string]string{envVarGitLabCI: "true"}, expected: backendGitLab},
+		{name: "forgejo", env: map[string]string{envVarForgejoActions: "true"}, expected: backendForgejo},
+		{name: "gitea", env: map[string]string{envVarGiteaActions: "true"}, expected: backendForgejo},
+		{name: "azure_devops", env: map[string]string{envVarAzureTFBuild: "True"}, expected: backendAzureDevOps},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			for _, envVar := range []string{envVarGitLabCI, envVarForgejoActions, envVarGiteaActions, envVarAzureTFBuild} {
+				t.Setenv(envVar, testCase.env[envVar])
+			}
+			actual, reason := detectBackend()
+			if actual != testCase.expected {
+				t.Fatalf("backend %q, expected %q", actual, testCase.expected)
+			}
+			if reason == "" {
+				t.Fatalf("expected a reason for %q", actual)
+			}
+		})
+	}
+}
+
+func TestCheckIssueOnlyInputs(t *testing.T) {
+	testCases := []struct {
+		name      string
+		apprv     approvalEnvironment
+		isSuccess bool
+	}{
+		{name: "none", apprv: approvalEnvironment{}, isSuccess: true},
+		{name: "close_issue_means_denial", apprv: approvalEnvironment{approvalOptions: approvalOptions{closeIssueMeansDenial: true}}, isSuccess: false},
+		{name: "issue_closers", apprv: approvalEnvironment{approvalOptions: approvalOptions{issueClosers: []string{"release-bot"}}}, isSuccess: false},
+		{name: "close_issue_as_vote", apprv: approvalEnvironment{approvalOptions: approvalOptions{closeIssueAsVote: true}}, isSuccess: false},
+		{name: "checklist", apprv: approvalEnvironment{approvalOptions: approvalOptions{checklist: []string{"DB backup verified"}}}, isSuccess: false},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			err := checkIssueOnlyInputs(&testCase.apprv, "the gitlab backend")
+			if (err == nil) != testCase.isSuccess {
+				t.Fatalf("expected success %v, got error %v", testCase.isSuccess, err)
+			}
+		})
+	}
+}
+
+// issueOnlyInputs returns approval environments that each set one of the
+// inputs only the issue target supports.
+func issueOnlyInputs() map[string]*approvalEnvironment {
+	return map[string]*approvalEnvironment{
+		"allow_reactions":          {approvalOptions: approvalOptions{reactionMapping: map[string]approval.Action{"+1": approval.ActionApprove}}},
+		"checklist":                {approvalOptions: approvalOptions{checklist: []string{"DB backup verified"}}},
+		"close_issue_means_denial": {approvalOptions: approvalOptions{closeIssueMeansDenial: true}},
+		"close_issue_as_vote":      {approvalOptions: approvalOptions{closeIssueAsVote: true}},
+		"issue_closers":            {approvalOptions: approvalOptions{issueClosers: []string{"release-bot"}}},
+	}
+}
+
+// fakeAPI is embedded by the in-memory fakes of the backend APIs. It serves
+// their routes one request at a time, so tests lock mu to read what a fake
+// recorded.
+type fakeAPI struct {
+	t  *testing.T
+	mu sync.Mutex
+}
+
+// serve starts a server for the fake and returns its URL. Requests whose
+// credentials authorized rejects get a 401, and those route doesn't handle
+// fail the test.
+func (f *fakeAPI) serve(t *testing.T, authorized func(r *http.Request) bool, route func(w http.ResponseWriter, r *http.Request) bool) string {
+	f.t = t
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		if authorized != nil && !authorized(r) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if !route(w, r) {
+			f.t.Errorf("unexpected request %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func (f *fakeAPI) readJSON(r *http.Request, v interface{}) {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		f.t.Errorf("error decoding %s %s: %v", r.Method, r.URL, err)
+	}
+}
+
+func (f *fakeAPI) writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		f.t.Errorf("error encoding response: %v", err)
+	}
+}
+
+// runTestApproval polls requestChannel until the approval is decided, and
+// fails the test unless it exits with expectedExitCode and writes every
+// expected output.
+func runTestApproval(t *testing.T, apprv *approvalEnvironment, requestChannel approval.Channel, expectedExitCode int, expectedOutputs ...string) {
+	t.Helper()
+	outputFile := filepath.Join(t.TempDir(), "output.txt")
+	t.Setenv("GITHUB_OUTPUT", outputFile)
+
+	exitCode := runApproval(context.Background(), apprv, requestChannel, time.Millisecond, make(chan os.Signal))
+	if exitCode != expectedExitCode {
+		t.Fatalf("exit code %d, expected %d", exitCode, expectedExitCode)
+	}
+
+	outputs, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatalf("error reading outputs: %v", err)
+	}
+	for _, expected := range expectedOutputs {
+		if !strings.Contains(string(outputs), expected) {
+			t.Fatalf("outputs %q don't contain %q", outputs, expected)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/v43/github"
+
+	"github.com/trstringer/manual-approval/pkg/approval"
+)
+
+// approvalTarget selects where the approval request is made and where votes
+// are read from.
+type approvalTarget string
+
+const (
+	approvalTargetIssue             approvalTarget = "issue"
+	approvalTargetPullRequestReview approvalTarget = "pull-request-review"
+	approvalTargetPullRequest       approvalTarget = "pull-request"
+	approvalTargetDiscussion        approvalTarget = "discussion"
+)
+
+func parseApprovalTarget(raw string) (approvalTarget, error) {
+	switch target := approvalTarget(strings.ToLower(strings.TrimSpace(raw))); target {
+	case "":
+		return approvalTargetIssue, nil
+	case approvalTargetIssue, approvalTargetPullRequestReview, approvalTargetPullRequest, approvalTargetDiscussion:
+		return target, nil
+	default:
+		return "", fmt.Errorf("unknown target %q, expected %q, %q, %q or %q", raw, approvalTargetIssue, approvalTargetPullRequest, approvalTargetPullRequestReview, approvalTargetDiscussion)
+	}
+}
+
+func newApprovalChannel(target approvalTarget, apprv *approvalEnvironment, client *github.Client) (approval.Channel, error) {
+	switch target {
+	case approvalTargetIssue:
+		return &issueChannel{apprv: apprv, backend: githubIssues{client: client}, client: client}, nil
+	case approvalTargetPullRequestReview:
+		if err := checkIssueTargetInputs(apprv, target); err != nil {
+			return nil, err
+		}
+		return &pullRequestReviewChannel{apprv: apprv, client: client}, nil
+	case approvalTargetPullRequest:
+		if err := checkIssueTargetInputs(apprv, target); err != nil {
+			return nil, err
+		}
+		return &pullRequestCommentChannel{apprv: apprv, client: client}, nil
+	case approvalTargetDiscussion:
+		if err := checkIssueTargetInputs(apprv, target); err != nil {
+			return nil, err
+		}
+		return &discussionChannel{apprv: apprv, client: client, category: apprv.discussionCategory}, nil
+	default:
+		return nil, fmt.Errorf("unknown target %q", target)
+	}
+}
+
+// checkIssueTargetInputs returns an error if an input only the issue target
+// supports is set, as the other targets would silently ignore it.
+func checkIssueTargetInputs(apprv *approvalEnvironment, target approvalTarget) error {
+	if apprv.reactionMapping != nil {
+		return fmt.Errorf("allow-reactions is not supported with target %s", target)
+	}
+	return checkIssueOnlyInputs(apprv, fmt.Sprintf("target %s", target))
+}
+
+// denialSuffix completes a denial comment depending on whether the workflow
+// fails on denial.
+func denialSuffix(failOnDenial bool) string {
+	if !failOnDenial {
+		return "but continuing workflow."
+	}
+	return "and failing workflow."
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v43/github"
+)
+
+var taskListItemRegex = regexp.MustCompile(`^\s*[-*+] \[([ xX])\] (.+?)\s*$`)
+
+// checklistItem is one box of the pre-approval checklist and who ticked it.
+type checklistItem struct {
+	text      string
+	checkedBy string
+}
+
+// issueBodyRevision is the issue body as it was after an edit by editor.
+type issueBodyRevision struct {
+	editor   string
+	editedAt time.Time
+	body     string
+}
+
+func parseChecklist(raw string) []string {
+	var items []string
+	for _, line := range strings.Split(raw, "\n") {
+		item := strings.TrimSpace(line)
+		item = strings.TrimPrefix(item, "- [ ] ")
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// formatChecklist renders the checklist as a Markdown task list for the issue
+// body.
+func formatChecklist(items []string) string {
+	lines := []string{
+		"### Checklist",
+		"",
+		"An approval only counts once every item below has been ticked by an approver.",
+		"",
+	}
+	for _, item := range items {
+		lines = append(lines, fmt.Sprintf("- [ ] %s", item))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// checkedItems returns the checklist items that are ticked in body.
+func checkedItems(body string) map[string]bool {
+	checked := map[string]bool{}
+	for _, line := range strings.Split(strings.ReplaceAll(body, "\r\n", "\n"), "\n") {
+		match := taskListItemRegex.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		checked[match[2]] = match[1] != " "
+	}
+	return checked
+}
+
+// checklistFromRevisions replays the issue body revisions in order and
+// attributes each ticked item to the user whose edit ticked it. Unticking an
+// item clears the attribution.
+func checklistFromRevisions(items []string, revisions []issueBodyRevision) []checklistItem {
+	sorted := make([]issueBodyRevision, len(revisions))
+	copy(sorted, revisions)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].editedAt.Before(sorted[j].editedAt)
+	})
+
+	checklist := make([]checklistItem, len(items))
+	for idx, item := range items {
+		checklist[idx].text = item
+	}
+
+	for _, revision := range sorted {
+		checked := checkedItems(revision.body)
+		for idx := range checklist {
+			if !checked[checklist[idx].text] {
+				checklist[idx].checkedBy = ""
+				continue
+			}
+			if checklist[idx].checkedBy == "" {
+				checklist[idx].checkedBy = revision.editor
+			}
+		}
+	}
+	return checklist
+}
+
+// checklistComplete reports whether every item has been ticked by one of the
+// approvers.
+func checklistComplete(checklist []checklistItem, approvers []string) bool {
+	for _, item := range checklist {
+		if item.checkedBy == "" || approversIndex(approvers, item.checkedBy) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// listIssueBodyRevisions fetches the edit history of the issue body. The REST
+// API doesn't expose who edited an issue body, so this uses the GraphQL
+// userContentEdits connection, where each edit carries the full body after
+// the edit.
+func listIssueBodyRevisions(ctx context.Context, client *github.Client, owner, repo string, number int) ([]issueBodyRevision, error) {
+	const query = `query($owner: String!, $repo: String!, $number: Int!, $after: String) {
+  repository(owner: $owner, name: $repo) {
+    issue(number: $number) {
+      userContentEdits(first: 100, after: $after) {
+        pageInfo { hasNextPage endCursor }
+        nodes {
+          editedAt
+          diff
+          editor { login }
+        }
+      }
+    }
+  }
+}`
+
+	var revisions []issueBodyRevision
+	var after *string
+	for {
+		var result struct {
+			Repository struct {
+				Issue struct {
+					UserContentEdits struct {
+						PageInfo struct {
+							HasNextPage bool   `json:"hasNextPage"`
+							EndCursor   string `json:"endCursor"`
+						} `json:"pageInfo"`
+						Nodes []struct {
+							EditedAt time.Time `json:"editedAt"`
+							Diff     string    `json:"diff"`
+							Editor   struct {
+								Login string `json:"login"`
+							} `json:"editor"`
+						} `json:"nodes"`
+					} `json:"userContentEdits"`
+				} `json:"issue"`
+			} `json:"repository"`
+		}
+		err := doGraphQL(ctx, client, query, map[string]interface{}{
+			"owner":  owner,
+			"repo":   repo,
+			"number": number,
+			"after":  after,
+		}, &result)
+		if err != nil {
+			return nil, err
+		}
+
+		edits := result.Repository.Issue.UserContentEdits
+		for _, node := range edits.Nodes {
+			revisions = append(revisions, issueBodyRevision{
+				editor:   node.Editor.Login,
+				editedAt: node.EditedAt,
+				body:     node.Diff,
+			})
+		}
+		if !edits.PageInfo.HasNextPage {
+			return revisions, nil
+		}
+		after = &edits.PageInfo.EndCursor
+	}
+}
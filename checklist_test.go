@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v43/github"
+)
+
+func TestParseChecklist(t *testing.T) {
+	actual := parseChecklist("DB backup verified\n\n  - [ ] Change ticket linked  \n")
+	expected := []string{"DB backup verified", "Change ticket linked"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected %v but got %v", expected, actual)
+	}
+}
+
+func TestChecklistFromRevisions(t *testing.T) {
+	items := []string{"DB backup verified", "Change ticket linked"}
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	body := func(first, second bool) string {
+		box := func(checked bool) string {
+			if checked {
+				return "x"
+			}
+			return " "
+		}
+		return "> [!NOTE]\n> Workflow is pending manual review.\n\n### Checklist\n\n" +
+			"- [" + box(first) + "] DB backup verified\n" +
+			"- [" + box(second) + "] Change ticket linked"
+	}
+
+	testCases := []struct {
+		name             string
+		revisions        []issueBodyRevision
+		expectedCheckers []string
+		expectComplete   bool
+	}{
+		{
+			name:             "no_edits",
+			expectedCheckers: []string{"", ""},
+		},
+		{
+			name: "approvers_tick_both",
+			revisions: []issueBodyRevision{
+				{editor: "bot", editedAt: start, body: body(false, false)},
+				{editor: "login1", editedAt: start.Add(time.Minute), body: body(true, false)},
+				{editor: "login2", editedAt: start.Add(2 * time.Minute), body: body(true, true)},
+			},
+			expectedCheckers: []string{"login1", "login2"},
+			expectComplete:   true,
+		},
+		{
+			name: "revisions_out_of_order",
+			revisions: []issueBodyRevision{
+				{editor: "login2", editedAt: start.Add(2 * time.Minute), body: body(true, true)},
+				{editor: "login1", editedAt: start.Add(time.Minute), body: body(true, false)},
+				{editor: "bot", editedAt: start, body: body(false, false)},
+			},
+			expectedCheckers: []string{"login1", "login2"},
+			expectComplete:   true,
+		},
+		{
+			name: "non_approver_ticks",
+			revisions: []issueBodyRevision{
+				{editor: "bot", editedAt: start, body: body(false, false)},
+				{editor: "intern", editedAt: start.Add(time.Minute), body: body(true, true)},
+			},
+			expectedCheckers: []string{"intern", "intern"},
+			expectComplete:   false,
+		},
+		{
+			name: "untick_clears_attribution",
+			revisions: []issueBodyRevision{
+				{editor: "bot", editedAt: start, body: body(false, false)},
+				{editor: "intern", editedAt: start.Add(time.Minute), body: body(true, true)},
+				{editor: "login1", editedAt: start.Add(2 * time.Minute), body: body(false, true)},
+				{editor: "login1", editedAt: start.Add(3 * time.Minute), body: body(true, true)},
+			},
+			expectedCheckers: []string{"login1", "intern"},
+			expectComplete:   false,
+		},
+		{
+			name: "item_text_changed",
+			revisions: []issueBodyRevision{
+				{editor: "bot", editedAt: start, body: body(false, false)},
+				{editor: "login1", editedAt: start.Add(time.Minute), body: "- [x] DB backup skipped\n- [x] Change ticket linked"},
+			},
+			expectedCheckers: []string{"", "login1"},
+			expectComplete:   false,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			checklist := checklistFromRevisions(items, testCase.revisions)
+			checkers := make([]string, 0, len(checklist))
+			for _, item := range checklist {
+				checkers = append(checkers, item.checkedBy)
+			}
+			if !reflect.DeepEqual(checkers, testCase.expectedCheckers) {
+				t.Fatalf("expected checkers %v but got %v", testCase.expectedCheckers, checkers)
+			}
+			if actual := checklistComplete(checklist, []string{"login1", "login2"}); actual != testCase.expectComplete {
+				t.Fatalf("expected complete %v but got %v", testCase.expectComplete, actual)
+			}
+		})
+	}
+}
+
+func TestListIssueBodyRevisionsPaginates(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/graphql", func(w http.ResponseWriter, r *http.Request) {
+		var request graphQLRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("error decoding request: %v", err)
+		}
+		edits := map[string]interface{}{
+			"pageInfo": map[string]interface{}{"hasNextPage": true, "endCursor": "cursor1"},
+			"nodes":    []map[string]interface{}{{"diff": "first", "editor": map[string]string{"login": "login1"}}},
+		}
+		if request.Variables["after"] == "cursor1" {
+			edits = map[string]interface{}{
+				"pageInfo": map[string]interface{}{"hasNextPage": false},
+				"nodes":    []map[string]interface{}{{"diff": "second", "editor": map[string]string{"login": "login2"}}},
+			}
+		}
+		response := map[string]interface{}{
+			"data": map[string]interface{}{
+				"repository": map[string]interface{}{
+					"issue": map[string]interface{}{"userContentEdits": edits},
+				},
+			},
+		}
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			t.Errorf("error encoding response: %v", err)
+		}
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	client := github.NewClient(nil)
+	baseURL, err := url.Parse(server.URL + "/")
+	if err != nil {
+		t.Fatalf("error parsing URL: %v", err)
+	}
+	client.BaseURL = baseURL
+
+	revisions, err := listIssueBodyRevisions(context.Background(), client, "owner", "repo", 1)
+	if err != nil {
+		t.Fatalf("error listing revisions: %v", err)
+	}
+	bodies := []string{}
+	for _, revision := range revisions {
+		bodies = append(bodies, revision.editor+":"+revision.body)
+	}
+	if expected := []string{"login1:first", "login2:second"}; !reflect.DeepEqual(bodies, expected) {
+		t.Fatalf("revisions %v, expected %v", bodies, expected)
+	}
+}
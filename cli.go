@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// outputFormat selects how the outputs are reported when running from the
+// command line.
+type outputFormat string
+
+const (
+	// outputFormatText only writes the outputs to GITHUB_OUTPUT, if set, as
+	// in the action.
+	outputFormatText outputFormat = "text"
+	// outputFormatJSON also prints the outputs as a JSON object on stdout,
+	// and moves the log to stderr.
+	outputFormatJSON outputFormat = "json"
+)
+
+// cliInputs are the inputs of the action that have an equivalent flag. The
+// flag is named after the input.
+var cliInputs = []string{
+	envVarApprovers,
+	envVarApproversFromCodeowners,
+	envVarRequiredApprovers,
+	envVarPolicy,
+	envVarConfigFile,
+	envVarToken,
+	envVarMinimumApprovals,
+	envVarIssueTitle,
+	envVarIssueBody,
+	envVarIssueBodyFilePath,
+	envVarIssueLabels,
+	envVarExcludeWorkflowInitiatorAsApprover,
+	envVarAdditionalApprovedWords,
+	envVarAdditionalDeniedWords,
+	envVarTargetRepoOwner,
+	envVarTargetRepo,
+	envVarFailOnDenial,
+	envVarPollingIntervalSeconds,
+	envVarCloseIssueMeansDenial,
+	envVarIssueClosers,
+	envVarCloseIssueAsVote,
+	envVarTarget,
+	envVarBackend,
+	envVarRunURL,
+	envVarWorkItemType,
+	envVarWorkItemApprovedState,
+	envVarWorkItemDeniedState,
+	envVarJiraURL,
+	envVarJiraUser,
+	envVarJiraToken,
+	envVarJiraProject,
+	envVarJiraIssueKey,
+	envVarJiraIssueType,
+	envVarJiraApprovedStatuses,
+	envVarJiraDeniedStatuses,
+	envVarJiraAccountMapping,
+	envVarServiceNowInstanceURL,
+	envVarServiceNowUser,
+	envVarServiceNowPassword,
+	envVarServiceNowChangeType,
+	envVarServiceNowStandardChangeTemplate,
+	envVarServiceNowAssignmentGroup,
+	envVarDiscussionCategory,
+	envVarIssueNumber,
+	envVarCloseExistingIssue,
+	envVarChecklist,
+	envVarEditedComments,
+	envVarCommentSyntax,
+	envVarAllowReactions,
+	envVarApprovalReactions,
+	envVarDenialReactions,
+}
+
+// cliBoolInputs are the inputs whose flags can be given without a value.
+var cliBoolInputs = map[string]bool{
+	envVarExcludeWorkflowInitiatorAsApprover: true,
+	envVarFailOnDenial:                       true,
+	envVarCloseIssueMeansDenial:              true,
+	envVarCloseIssueAsVote:                   true,
+	envVarCloseExistingIssue:                 true,
+	envVarAllowReactions:                     true,
+}
+
+// cliAliases are shorter names for the most used flags.
+var cliAliases = map[string]string{
+	"min":   envVarMinimumApprovals,
+	"title": envVarIssueTitle,
+	"body":  envVarIssueBody,
+	"token": envVarToken,
+}
+
+// cliEnvironment are flags for the GitHub Actions environment variables that
+// describe the run, for use outside of GitHub Actions.
+var cliEnvironment = []struct {
+	name   string
+	envVar string
+	usage  string
+}{
+	{name: "run-id", envVar: envVarRunID, usage: "ID of the workflow run waiting for approval"},
+	{name: "actor", envVar: envVarWorkflowInitiator, usage: "login of the workflow initiator"},
+	{name: "server-url", envVar: envVarServerURL, usage: "URL of the GitHub server"},
+	{name: "api-url", envVar: envVarAPIURL, usage: "URL of the GitHub API"},
+}
+
+func cliFlagName(envVar string) string {
+	return strings.ToLower(strings.TrimPrefix(envVar, "INPUT_"))
+}
+
+// parseCommandLine parses the arguments of the request command into inputs,
+// by the environment variable each flag stands for. Flags that aren't given
+// fall back to the INPUT_* and GITHUB_* variables.
+func parseCommandLine(args []string, stderr io.Writer) (inputs, outputFormat, error) {
+	if len(args) == 0 || args[0] != "request" {
+		fmt.Fprintf(stderr, "Usage: manual-approval request [flags]\n\nRun 'manual-approval request -h' for the flags.\n")
+		return inputs{}, "", fmt.Errorf("expected the request command")
+	}
+
+	fs := flag.NewFlagSet("request", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: manual-approval request [flags]\n\nRequests a manual approval and waits for it. Each flag falls back to the environment variable of the action input or GitHub Actions variable it sets.\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+
+	envVars := map[string]string{}
+	for _, envVar := range cliInputs {
+		name := cliFlagName(envVar)
+		envVars[name] = envVar
+		usage := fmt.Sprintf("%s input (%s)", name, envVar)
+		if cliBoolInputs[envVar] {
+			fs.Bool(name, false, usage)
+		} else {
+			fs.String(name, "", usage)
+		}
+	}
+	for alias, envVar := range cliAliases {
+		envVars[alias] = envVar
+		fs.String(alias, "", fmt.Sprintf("shorthand for -%s", cliFlagName(envVar)))
+	}
+	for _, env := range cliEnvironment {
+		envVars[env.name] = env.envVar
+		fs.String(env.name, "", fmt.Sprintf("%s (%s)", env.usage, env.envVar))
+	}
+	repo := fs.String("repo", "", fmt.Sprintf("repository as owner/name (%s and %s)", envVarRepoFullName, envVarRepoOwner))
+	output := fs.String("output", string(outputFormatText), fmt.Sprintf("%q, or %q to print the outputs as JSON", outputFormatText, outputFormatJSON))
+
+	if err := fs.Parse(args[1:]); err != nil {
+		return inputs{}, "", err
+	}
+	if fs.NArg() > 0 {
+		return inputs{}, "", fmt.Errorf("unexpected arguments: %v", fs.Args())
+	}
+
+	in := inputs{flags: map[string]string{}}
+	fs.Visit(func(f *flag.Flag) {
+		if envVar, ok := envVars[f.Name]; ok {
+			in.flags[envVar] = f.Value.String()
+		}
+	})
+
+	if *repo != "" {
+		separator := strings.Index(*repo, "/")
+		if separator <= 0 {
+			return inputs{}, "", fmt.Errorf("repo %q isn't in the owner/name format", *repo)
+		}
+		in.flags[envVarRepoFullName] = *repo
+		in.flags[envVarRepoOwner] = (*repo)[:separator]
+	}
+
+	switch format := outputFormat(strings.ToLower(*output)); format {
+	case outputFormatText, outputFormatJSON:
+		return in, format, nil
+	default:
+		return inputs{}, "", fmt.Errorf("unknown output %q, expected %q or %q", *output, outputFormatText, outputFormatJSON)
+	}
+}
+
+// printOutputs prints the outputs set during the run as a JSON object.
+func printOutputs(w io.Writer, outputs map[string]string) error {
+	if outputs == nil {
+		outputs = map[string]string{}
+	}
+	return json.NewEncoder(w).Encode(outputs)
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestParseCommandLine(t *testing.T) {
+	testCases := []struct {
+		name           string
+		args           []string
+		env            map[string]string
+		expectedFormat outputFormat
+		expectedInputs map[string]string
+		expectError    bool
+	}{
+		{
+			name:           "request",
+			args:           []string{"request", "--repo", "owner/name", "--approvers", "login1,login2", "--min", "2", "--title", "Deploy", "--run-id", "42"},
+			expectedFormat: outputFormatText,
+			expectedInputs: map[string]string{
+				envVarRepoFullName:     "owner/name",
+				envVarRepoOwner:        "owner",
+				envVarApprovers:        "login1,login2",
+				envVarMinimumApprovals: "2",
+				envVarIssueTitle:       "Deploy",
+				envVarRunID:            "42",
+			},
+		},
+		{
+			name:           "flags_named_after_inputs",
+			args:           []string{"request", "-issue-labels=deploy,prod", "-polling-interval-seconds", "5", "-jira-issue-key", "OPS-1"},
+			expectedFormat: outputFormatText,
+			expectedInputs: map[string]string{
+				envVarIssueLabels:            "deploy,prod",
+				envVarPollingIntervalSeconds: "5",
+				envVarJiraIssueKey:           "OPS-1",
+			},
+		},
+		{
+			name:           "bool_flags",
+			args:           []string{"request", "--allow-reactions", "--fail-on-denial=false"},
+			expectedFormat: outputFormatText,
+			expectedInputs: map[string]string{
+				envVarAllowReactions: "true",
+				envVarFailOnDenial:   "false",
+			},
+		},
+		{
+			name:           "env_fallback",
+			args:           []string{"request", "--approvers", "login3", "--output", "JSON"},
+			env:            map[string]string{envVarApprovers: "login1", envVarToken: "secret"},
+			expectedFormat: outputFormatJSON,
+			expectedInputs: map[string]string{
+				envVarApprovers: "login3",
+				envVarToken:     "secret",
+			},
+		},
+		{
+			name:        "missing_command",
+			args:        []string{"--approvers", "login1"},
+			expectError: true,
+		},
+		{
+			name:        "repo_without_owner",
+			args:        []string{"request", "--repo", "name"},
+			expectError: true,
+		},
+		{
+			name:        "unknown_output",
+			args:        []string{"request", "--output", "yaml"},
+			expectError: true,
+		},
+		{
+			name:        "unknown_flag",
+			args:        []string{"request", "--approver", "login1"},
+			expectError: true,
+		},
+		{
+			name:        "positional_argument",
+			args:        []string{"request", "extra"},
+			expectError: true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			// Clear every variable the command line can set, so that only
+			// testCase.env falls through to them.
+			for _, envVar := range append(append([]string{}, cliInputs...), envVarRepoFullName, envVarRepoOwner, envVarRunID, envVarWorkflowInitiator, envVarServerURL, envVarAPIURL) {
+				t.Setenv(envVar, "")
+			}
+			for envVar, value := range testCase.env {
+				t.Setenv(envVar, value)
+			}
+
+			in, format, err := parseCommandLine(testCase.args, io.Discard)
+			if testCase.expectError {
+				if err == nil {
+					t.Fatalf("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if format != testCase.expectedFormat {
+				t.Fatalf("format %q, expected %q", format, testCase.expectedFormat)
+			}
+			for envVar, expected := range testCase.expectedInputs {
+				if actual := in.get(envVar); actual != expected {
+					t.Fatalf("%s is %q, expected %q", envVar, actual, expected)
+				}
+				if actual := os.Getenv(envVar); actual != testCase.env[envVar] {
+					t.Fatalf("expected the environment to be left as it is, %s is %q", envVar, actual)
+				}
+			}
+		})
+	}
+}
+
+func TestParseCommandLineHelp(t *testing.T) {
+	var usage bytes.Buffer
+	_, _, err := parseCommandLine([]string{"request", "-h"}, &usage)
+	if !errors.Is(err, flag.ErrHelp) {
+		t.Fatalf("expected flag.ErrHelp, got %v", err)
+	}
+	for _, expected := range []string{"-approvers", "-minimum-approvals", "-min", "-output", "-repo", "INPUT_ISSUE-TITLE"} {
+		if !bytes.Contains(usage.Bytes(), []byte(expected)) {
+			t.Fatalf("usage doesn't mention %q:\n%s", expected, usage.String())
+		}
+	}
+}
+
+func TestPrintOutputs(t *testing.T) {
+	apprv := &approvalEnvironment{}
+	t.Setenv("GITHUB_OUTPUT", "")
+	if _, err := apprv.SetActionOutputs(map[string]string{"issue-number": "7"}); err != nil {
+		t.Fatalf("error setting outputs: %v", err)
+	}
+	if _, err := apprv.SetActionOutputs(map[string]string{"approval-status": "approved", "decision-reason": "login1: ok\nlogin2: ok"}); err != nil {
+		t.Fatalf("error setting outputs: %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := printOutputs(&out, apprv.outputs); err != nil {
+		t.Fatalf("error printing outputs: %v", err)
+	}
+	expected := `{"approval-status":"approved","decision-reason":"login1: ok\nlogin2: ok","issue-number":"7"}` + "\n"
+	if out.String() != expected {
+		t.Fatalf("actual %q, expected %q", out.String(), expected)
+	}
+}
+
+func TestReadAdditionalWords(t *testing.T) {
+	testCases := []struct {
+		name          string
+		rawValue      string
+		expectedWords []string
+	}{
+		{name: "unset", rawValue: "", expectedWords: []string{}},
+		{name: "trimmed", rawValue: " lgtm , ship it", expectedWords: []string{"lgtm", "ship it"}},
+		{name: "trailing_comma", rawValue: "lgtm,", expectedWords: []string{"lgtm"}},
+		{name: "blank_entries", rawValue: "lgtm, ,,approve", expectedWords: []string{"lgtm", "approve"}},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Setenv(envVarAdditionalApprovedWords, testCase.rawValue)
+			if actual := readAdditionalWords(inputs{}, envVarAdditionalApprovedWords); !reflect.DeepEqual(actual, testCase.expectedWords) {
+				t.Fatalf("actual %q, expected %q", actual, testCase.expectedWords)
+			}
+		})
+	}
+}
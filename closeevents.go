@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v43/github"
+
+	"github.com/trstringer/manual-approval/pkg/approval"
+)
+
+const (
+	stateReasonCompleted  string = "completed"
+	stateReasonNotPlanned string = "not_planned"
+)
+
+// issueEvent is an entry from the issue events or timeline API. go-github's
+// IssueEvent predates state_reason, so events are decoded into this struct
+// instead.
+type issueEvent struct {
+	ID    int64  `json:"id"`
+	Event string `json:"event"`
+	Actor struct {
+		Login string `json:"login"`
+	} `json:"actor"`
+	StateReason string    `json:"state_reason"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func listIssueEvents(ctx context.Context, client *github.Client, owner, repo string, number int) ([]issueEvent, error) {
+	return listIssueEventPages(ctx, client, fmt.Sprintf("repos/%s/%s/issues/%d/events", owner, repo, number), "")
+}
+
+// listIssueTimeline lists the issue timeline. Timeline entries share the
+// event, actor and created_at fields with issue events, which is all that is
+// needed to find who closed the issue.
+func listIssueTimeline(ctx context.Context, client *github.Client, owner, repo string, number int) ([]issueEvent, error) {
+	// Older GitHub Enterprise Server versions still require the preview media
+	// type for the timeline API.
+	return listIssueEventPages(ctx, client, fmt.Sprintf("repos/%s/%s/issues/%d/timeline", owner, repo, number), "application/vnd.github.mockingbird-preview+json")
+}
+
+func listIssueEventPages(ctx context.Context, client *github.Client, path string, accept string) ([]issueEvent, error) {
+	var events []issueEvent
+	page := 1
+	for page != 0 {
+		req, err := client.NewRequest("GET", fmt.Sprintf("%s?per_page=100&page=%d", path, page), nil)
+		if err != nil {
+			return nil, err
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+
+		var pageEvents []issueEvent
+		resp, err := client.Do(ctx, req, &pageEvents)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, pageEvents...)
+		page = resp.NextPage
+	}
+	return events, nil
+}
+
+// lastCloseEvent returns the most recent closed event if the issue is
+// currently closed, i.e. it hasn't been reopened since.
+func lastCloseEvent(events []issueEvent) (issueEvent, bool) {
+	for i := len(events) - 1; i >= 0; i-- {
+		switch events[i].Event {
+		case "closed":
+			return events[i], true
+		case "reopened":
+			return issueEvent{}, false
+		}
+	}
+	return issueEvent{}, false
+}
+
+// votesFromCloseEvents turns every close of the issue into a vote by the
+// user who closed it: closing as completed approves, closing as not planned
+// denies. Closes without a state reason don't count.
+func votesFromCloseEvents(events []issueEvent) []approval.Vote {
+	var votes []approval.Vote
+	for _, event := range events {
+		if event.Event != "closed" {
+			continue
+		}
+
+		var action approval.Action
+		switch event.StateReason {
+		case stateReasonCompleted:
+			action = approval.ActionApprove
+		case stateReasonNotPlanned:
+			action = approval.ActionDeny
+		default:
+			continue
+		}
+
+		votes = append(votes, approval.Vote{
+			User:      event.Actor.Login,
+			Action:    action,
+			Source:    "close",
+			CreatedAt: event.CreatedAt,
+		})
+	}
+	return votes
+}
+
+// closeExplanation is the comment posted when a close of the issue didn't
+// decide the request and the issue is reopened.
+func closeExplanation(closeEvent issueEvent, approvers []string) string {
+	closer := closeEvent.Actor.Login
+	if closer == "" {
+		return fmt.Sprintf("This issue was closed by someone who is not an approver, reopening it. Only %s can decide this request.", formatApproverMentions(approvers))
+	}
+	if approversIndex(approvers, closer) < 0 {
+		return fmt.Sprintf("@%s closed this issue but is not an approver, reopening it. Only %s can decide this request.", closer, formatApproverMentions(approvers))
+	}
+	switch closeEvent.StateReason {
+	case stateReasonCompleted:
+		return fmt.Sprintf("Counted @%s closing this issue as an approval, but more approvals are required. Reopening it.", closer)
+	case stateReasonNotPlanned:
+		return fmt.Sprintf("@%s closed this issue as not planned but it did not deny the request. Reopening it.", closer)
+	default:
+		return fmt.Sprintf("@%s closed this issue without a reason, which is neither an approval nor a denial. Close it as completed to approve or as not planned to deny. Reopening it.", closer)
+	}
+}
+
+// disallowedCloseComment is posted when the issue was closed by someone who
+// can't deny the request under close-issue-means-denial. Close events of
+// deleted users have no actor, so then no one is mentioned.
+func disallowedCloseComment(closer string) string {
+	if closer == "" {
+		return "This issue was closed by someone who is not allowed to deny this request. Reopening it and continuing to wait for approval."
+	}
+	return fmt.Sprintf("@%s closed this issue but is not allowed to deny this request. Reopening it and continuing to wait for approval.", closer)
+}
+
+func formatApproverMentions(approvers []string) string {
+	mentions := make([]string, 0, len(approvers))
+	for _, approver := range approvers {
+		mentions = append(mentions, "@"+approver)
+	}
+	return strings.Join(mentions, ", ")
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/trstringer/manual-approval/pkg/approval"
+)
+
+func newIssueEvent(event, login, stateReason string, offset time.Duration) issueEvent {
+	e := issueEvent{
+		Event:       event,
+		StateReason: stateReason,
+		CreatedAt:   time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC).Add(offset),
+	}
+	e.Actor.Login = login
+	return e
+}
+
+func TestApprovalFromCloseEvents(t *testing.T) {
+	testCases := []struct {
+		name             string
+		events           []issueEvent
+		approvers        []string
+		minimumApprovals int
+		expectedStatus   approval.Status
+	}{
+		{
+			name:           "approver_closes_completed",
+			events:         []issueEvent{newIssueEvent("closed", "login1", stateReasonCompleted, 0)},
+			approvers:      []string{"login1"},
+			expectedStatus: approval.StatusApproved,
+		},
+		{
+			name:           "approver_closes_not_planned",
+			events:         []issueEvent{newIssueEvent("closed", "login1", stateReasonNotPlanned, 0)},
+			approvers:      []string{"login1"},
+			expectedStatus: approval.StatusDenied,
+		},
+		{
+			name:           "non_approver_closes_not_planned",
+			events:         []issueEvent{newIssueEvent("closed", "triager", stateReasonNotPlanned, 0)},
+			approvers:      []string{"login1"},
+			expectedStatus: approval.StatusPending,
+		},
+		{
+			name:           "close_without_reason",
+			events:         []issueEvent{newIssueEvent("closed", "login1", "", 0)},
+			approvers:      []string{"login1"},
+			expectedStatus: approval.StatusPending,
+		},
+		{
+			name: "approvals_across_reopen",
+			events: []issueEvent{
+				newIssueEvent("closed", "login1", stateReasonCompleted, 0),
+				newIssueEvent("reopened", "github-actions[bot]", "", time.Minute),
+				newIssueEvent("labeled", "login2", "", 2*time.Minute),
+				newIssueEvent("closed", "login2", stateReasonCompleted, 3*time.Minute),
+			},
+			approvers:      []string{"login1", "login2"},
+			expectedStatus: approval.StatusApproved,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			actual := evaluateVotes(t, votesFromCloseEvents(testCase.events), testCase.approvers, testCase.minimumApprovals)
+			if actual.Status != testCase.expectedStatus {
+				t.Fatalf("actual %s, expected %s", actual.Status, testCase.expectedStatus)
+			}
+		})
+	}
+}
+
+func TestLastCloseEvent(t *testing.T) {
+	testCases := []struct {
+		name          string
+		events        []issueEvent
+		expectClosed  bool
+		expectedActor string
+	}{
+		{
+			name:   "never_closed",
+			events: []issueEvent{newIssueEvent("assigned", "bot", "", 0)},
+		},
+		{
+			name: "closed",
+			events: []issueEvent{
+				newIssueEvent("closed", "login1", stateReasonCompleted, 0),
+				newIssueEvent("reopened", "bot", "", time.Minute),
+				newIssueEvent("closed", "login2", stateReasonNotPlanned, 2*time.Minute),
+				newIssueEvent("labeled", "bot", "", 3*time.Minute),
+			},
+			expectClosed:  true,
+			expectedActor: "login2",
+		},
+		{
+			name: "reopened",
+			events: []issueEvent{
+				newIssueEvent("closed", "login1", stateReasonCompleted, 0),
+				newIssueEvent("reopened", "bot", "", time.Minute),
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			event, closed := lastCloseEvent(testCase.events)
+			if closed != testCase.expectClosed {
+				t.Fatalf("expected closed %v but got %v", testCase.expectClosed, closed)
+			}
+			if event.Actor.Login != testCase.expectedActor {
+				t.Fatalf("expected actor %q but got %q", testCase.expectedActor, event.Actor.Login)
+			}
+		})
+	}
+}
+
+func TestCloseExplanationNonApprover(t *testing.T) {
+	comment := closeExplanation(newIssueEvent("closed", "triager", stateReasonNotPlanned, 0), []string{"login1", "login2"})
+	if !strings.Contains(comment, "@triager") || !strings.Contains(comment, "not an approver") {
+		t.Fatalf("unexpected explanation: %q", comment)
+	}
+	if !strings.Contains(comment, "@login1, @login2") {
+		t.Fatalf("expected approvers to be mentioned: %q", comment)
+	}
+}
+
+func TestCloseExplanationNoActor(t *testing.T) {
+	comment := closeExplanation(newIssueEvent("closed", "", stateReasonNotPlanned, 0), []string{"login1"})
+	if strings.Contains(comment, "@ ") || !strings.HasPrefix(comment, "This issue was closed by someone who is not an approver") {
+		t.Fatalf("unexpected explanation: %q", comment)
+	}
+}
+
+func TestDisallowedCloseComment(t *testing.T) {
+	testCases := []struct {
+		name     string
+		closer   string
+		expected string
+	}{
+		{
+			name:     "closer",
+			closer:   "triager",
+			expected: "@triager closed this issue but is not allowed to deny this request. Reopening it and continuing to wait for approval.",
+		},
+		{
+			name:     "no_actor",
+			closer:   "",
+			expected: "This issue was closed by someone who is not allowed to deny this request. Reopening it and continuing to wait for approval.",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			if actual := disallowedCloseComment(testCase.closer); actual != testCase.expected {
+				t.Fatalf("expected %q but got %q", testCase.expected, actual)
+			}
+		})
+	}
+}
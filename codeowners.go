@@ -0,0 +1,334 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/v43/github"
+	"github.com/trstringer/manual-approval/pkg/approval"
+)
+
+// codeownersMode controls whether the approvers are the code owners of the
+// files changed by the triggering pull request or push.
+type codeownersMode string
+
+const (
+	// codeownersOff takes the approvers from the approvers input.
+	codeownersOff codeownersMode = "false"
+	// codeownersUnion makes every owner of a changed file an approver.
+	codeownersUnion codeownersMode = "true"
+	// codeownersPerArea additionally requires an approval from an owner of
+	// each CODEOWNERS pattern that owns a changed file.
+	codeownersPerArea codeownersMode = "per-area"
+)
+
+func parseCodeownersMode(raw string) (codeownersMode, error) {
+	switch mode := codeownersMode(strings.ToLower(strings.TrimSpace(raw))); mode {
+	case "":
+		return codeownersOff, nil
+	case codeownersOff, codeownersUnion, codeownersPerArea:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown approvers-from-codeowners mode %q, expected %q, %q or %q", raw, codeownersOff, codeownersUnion, codeownersPerArea)
+	}
+}
+
+// codeownersPaths are where GitHub looks for the CODEOWNERS file, in order.
+var codeownersPaths = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS"}
+
+// codeownersRule is a line of a CODEOWNERS file: a pattern and the owners of
+// the files it matches. A rule without owners leaves its files unowned.
+type codeownersRule struct {
+	pattern string
+	owners  []string
+	match   *regexp.Regexp
+}
+
+// parseCodeowners parses a CODEOWNERS file. Its rules are in the order of the
+// file, as the last one that matches a path wins.
+func parseCodeowners(raw string) ([]codeownersRule, error) {
+	var rules []codeownersRule
+	for i, line := range strings.Split(raw, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		pattern := strings.Replace(fields[0], `\#`, "#", 1)
+		if strings.HasPrefix(pattern, "!") || strings.ContainsAny(pattern, "[]") {
+			return nil, fmt.Errorf("line %d: pattern %q uses syntax CODEOWNERS doesn't support", i+1, pattern)
+		}
+		match, err := codeownersPattern(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid pattern %q: %w", i+1, pattern, err)
+		}
+
+		rule := codeownersRule{pattern: pattern, match: match}
+		for _, owner := range fields[1:] {
+			if strings.HasPrefix(owner, "#") {
+				break
+			}
+			rule.owners = append(rule.owners, owner)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// codeownersPattern compiles a CODEOWNERS pattern, which follows gitignore:
+// a pattern with a slash other than a trailing one is relative to the root
+// of the repository, and otherwise matches at any depth. A pattern naming a
+// directory matches everything below it, but a trailing wildcard only
+// matches the files directly in its directory.
+func codeownersPattern(pattern string) (*regexp.Regexp, error) {
+	anchored := strings.HasPrefix(pattern, "/")
+	trimmed := strings.TrimPrefix(pattern, "/")
+	directory := strings.HasSuffix(trimmed, "/")
+	trimmed = strings.TrimSuffix(trimmed, "/")
+	if trimmed == "" {
+		return regexp.Compile("^.*$")
+	}
+	if strings.Contains(trimmed, "/") {
+		anchored = true
+	}
+
+	var expr strings.Builder
+	expr.WriteString("^")
+	if !anchored {
+		expr.WriteString("(?:.*/)?")
+	}
+	segments := strings.Split(trimmed, "/")
+	for i, segment := range segments {
+		last := i == len(segments)-1
+		if segment == "**" {
+			if last {
+				expr.WriteString(".*")
+			} else {
+				expr.WriteString("(?:.*/)?")
+			}
+			continue
+		}
+		for _, r := range segment {
+			switch r {
+			case '*':
+				expr.WriteString("[^/]*")
+			case '?':
+				expr.WriteString("[^/]")
+			default:
+				expr.WriteString(regexp.QuoteMeta(string(r)))
+			}
+		}
+		if !last {
+			expr.WriteString("/")
+		}
+	}
+	lastSegment := segments[len(segments)-1]
+	switch {
+	case directory:
+		expr.WriteString("/.*")
+	case lastSegment != "**" && !strings.ContainsAny(lastSegment, "*?"):
+		expr.WriteString("(?:/.*)?")
+	}
+	expr.WriteString("$")
+	return regexp.Compile(expr.String())
+}
+
+// ownedAreas returns the rules that own the files, the last matching rule
+// winning for each file, in the order of the CODEOWNERS file. Files without
+// owners are left out.
+func ownedAreas(rules []codeownersRule, files []string) []codeownersRule {
+	owning := map[int]bool{}
+	for _, file := range files {
+		for i := len(rules) - 1; i >= 0; i-- {
+			if rules[i].match.MatchString(file) {
+				if len(rules[i].owners) > 0 {
+					owning[i] = true
+				}
+				break
+			}
+		}
+	}
+
+	indexes := make([]int, 0, len(owning))
+	for i := range owning {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	areas := make([]codeownersRule, 0, len(indexes))
+	for _, i := range indexes {
+		areas = append(areas, rules[i])
+	}
+	return areas
+}
+
+// codeownersTeams returns the @org/team owners of the areas.
+func codeownersTeams(areas []codeownersRule) []teamRef {
+	var teams []teamRef
+	for _, area := range areas {
+		for _, owner := range area.owners {
+			if team, isTeam, err := parseTeamRef(owner); isTeam && err == nil && !slices.Contains(teams, team) {
+				teams = append(teams, team)
+			}
+		}
+	}
+	return teams
+}
+
+// resolveCodeowners resolves the owners of the areas to users, taking the
+// members of @org/team owners from teamMembers. Owners given by email can't be
+// mentioned or matched to commenters, so they are skipped.
+func resolveCodeowners(log io.Writer, areas []codeownersRule, teamMembers map[teamRef][]string, workflowInitiator string, shouldExcludeWorkflowInitiator bool) ([]string, []approval.Area) {
+	var approvers []string
+	approvalAreas := make([]approval.Area, 0, len(areas))
+	for _, area := range areas {
+		var users []string
+		for _, owner := range area.owners {
+			// @user owners are users, so only owners with a slash are
+			// teams.
+			if team, isTeam, err := parseTeamRef(owner); isTeam && strings.Contains(owner, "/") {
+				if err != nil {
+					fmt.Fprintf(log, "Skipping code owner '%s' of '%s': %v\n", owner, area.pattern, err)
+					continue
+				}
+				for _, member := range teamMembers[team] {
+					if strings.EqualFold(member, workflowInitiator) && shouldExcludeWorkflowInitiator {
+						fmt.Fprintf(log, "Not adding user '%s' from team '%s' as an approver as they are the workflow initiator\n", member, team)
+						continue
+					}
+					users = append(users, member)
+				}
+				continue
+			}
+			name, isHandle := strings.CutPrefix(owner, "@")
+			if !isHandle {
+				fmt.Fprintf(log, "Skipping code owner '%s' of '%s', only users and teams can be approvers\n", owner, area.pattern)
+				continue
+			}
+			if strings.EqualFold(name, workflowInitiator) && shouldExcludeWorkflowInitiator {
+				fmt.Fprintf(log, "Not adding code owner '%s' as an approver as they are the workflow initiator\n", name)
+				continue
+			}
+			users = append(users, name)
+		}
+		users = deduplicateUsers(users)
+		approvers = append(approvers, users...)
+		approvalAreas = append(approvalAreas, approval.Area{Name: area.pattern, Approvers: users})
+	}
+	return deduplicateUsers(approvers), approvalAreas
+}
+
+// readCodeowners reads the CODEOWNERS file of the repository's default
+// branch, from the first of the locations GitHub looks in that has one.
+func readCodeowners(ctx context.Context, client *github.Client, owner, repo string) ([]codeownersRule, error) {
+	for _, path := range codeownersPaths {
+		file, _, resp, err := client.Repositories.GetContents(ctx, owner, repo, path, nil)
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error getting %s from %s/%s: %w", path, owner, repo, err)
+		}
+		if file == nil {
+			continue
+		}
+		content, err := file.GetContent()
+		if err != nil {
+			return nil, fmt.Errorf("error decoding %s: %w", path, err)
+		}
+		rules, err := parseCodeowners(content)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", path, err)
+		}
+		return rules, nil
+	}
+	return nil, fmt.Errorf("no CODEOWNERS file in %s/%s, looked in %s", owner, repo, strings.Join(codeownersPaths, ", "))
+}
+
+// changedFiles lists the files changed by the triggering pull request, or by
+// the pushed commits. Renamed files count under both of their names.
+func changedFiles(ctx context.Context, client *github.Client, owner, repo string, event workflowEvent) ([]string, error) {
+	var files []string
+	addFiles := func(commitFiles []*github.CommitFile) {
+		for _, file := range commitFiles {
+			files = append(files, file.GetFilename())
+			if previous := file.GetPreviousFilename(); previous != "" {
+				files = append(files, previous)
+			}
+		}
+	}
+
+	if number, ok := payloadValue(event.Payload, "pull_request.number"); ok {
+		pullRequestNumber, err := strconv.Atoi(number)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing pull request number: %w", err)
+		}
+		opts := &github.ListOptions{PerPage: 100}
+		for {
+			commitFiles, resp, err := client.PullRequests.ListFiles(ctx, owner, repo, pullRequestNumber, opts)
+			if err != nil {
+				return nil, fmt.Errorf("error listing files of pull request %d: %w", pullRequestNumber, err)
+			}
+			addFiles(commitFiles)
+			if resp.NextPage == 0 {
+				return files, nil
+			}
+			opts.Page = resp.NextPage
+		}
+	}
+
+	before, hasBefore := payloadValue(event.Payload, "before")
+	after, hasAfter := payloadValue(event.Payload, "after")
+	if !hasBefore || !hasAfter || strings.Trim(before, "0") == "" {
+		return nil, fmt.Errorf("approvers-from-codeowners needs a pull request event or a push to an existing branch, got %q", event.Name)
+	}
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		comparison, resp, err := client.Repositories.CompareCommits(ctx, owner, repo, before, after, opts)
+		if err != nil {
+			return nil, fmt.Errorf("error comparing %s...%s: %w", before, after, err)
+		}
+		addFiles(comparison.Files)
+		if resp.NextPage == 0 {
+			return files, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// retrieveCodeowners returns the owners of the files changed by the event as
+// approvers, with the areas of the CODEOWNERS file that own them.
+func retrieveCodeowners(ctx context.Context, in inputs, log io.Writer, client *github.Client, owner, repo string, event workflowEvent, workflowInitiator string) ([]string, []approval.Area, error) {
+	shouldExcludeWorkflowInitiator, err := excludeWorkflowInitiator(in)
+	if err != nil {
+		return nil, nil, err
+	}
+	rules, err := readCodeowners(ctx, client, owner, repo)
+	if err != nil {
+		return nil, nil, err
+	}
+	files, err := changedFiles(ctx, client, owner, repo, event)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	areas := ownedAreas(rules, files)
+	fmt.Fprintf(log, "%d changed files are owned by %d CODEOWNERS patterns\n", len(files), len(areas))
+	if len(areas) == 0 {
+		return nil, nil, fmt.Errorf("none of the %d changed files has code owners", len(files))
+	}
+	var teamMembers map[teamRef][]string
+	if teams := codeownersTeams(areas); len(teams) > 0 {
+		teamMembers, err = expandGitHubTeams(ctx, log, client, teams)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	approvers, approvalAreas := resolveCodeowners(log, areas, teamMembers, workflowInitiator, shouldExcludeWorkflowInitiator)
+	return approvers, approvalAreas, nil
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/google/go-github/v43/github"
+	"github.com/trstringer/manual-approval/pkg/approval"
+)
+
+func TestCodeownersPattern(t *testing.T) {
+	testCases := []struct {
+		pattern   string
+		path      string
+		isMatched bool
+	}{
+		{pattern: "*", path: "src/main.go", isMatched: true},
+		{pattern: "*.js", path: "web/app.js", isMatched: true},
+		{pattern: "*.js", path: "web/app.jsx", isMatched: false},
+		{pattern: "/docs/", path: "docs/guide/setup.md", isMatched: true},
+		{pattern: "/docs/", path: "src/docs/setup.md", isMatched: false},
+		{pattern: "apps/", path: "services/apps/main.go", isMatched: true},
+		{pattern: "docs/*", path: "docs/getting-started.md", isMatched: true},
+		{pattern: "docs/*", path: "docs/build-app/troubleshooting.md", isMatched: false},
+		{pattern: "/build/logs", path: "build/logs/today.log", isMatched: true},
+		{pattern: "/build/logs", path: "build/logs", isMatched: true},
+		{pattern: "/build/logs", path: "other/build/logs/today.log", isMatched: false},
+		{pattern: "**/logs", path: "deeply/nested/logs/today.log", isMatched: true},
+		{pattern: "/scripts/**", path: "scripts/ci/build.sh", isMatched: true},
+		{pattern: "config.?ml", path: "config.yml", isMatched: true},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.pattern+"_"+testCase.path, func(t *testing.T) {
+			match, err := codeownersPattern(testCase.pattern)
+			if err != nil {
+				t.Fatalf("error compiling pattern: %v", err)
+			}
+			if actual := match.MatchString(testCase.path); actual != testCase.isMatched {
+				t.Fatalf("pattern %q matching %q is %v, expected %v", testCase.pattern, testCase.path, actual, testCase.isMatched)
+			}
+		})
+	}
+}
+
+const testCodeowners = `
+# Default owners
+*           @org/platform
+*.go        @login1 @login2 # Go code
+/docs/      @login3 docs@example.com
+/docs/generated/
+`
+
+func TestOwnedAreas(t *testing.T) {
+	rules, err := parseCodeowners(testCodeowners)
+	if err != nil {
+		t.Fatalf("error parsing CODEOWNERS: %v", err)
+	}
+
+	testCases := []struct {
+		name             string
+		files            []string
+		expectedPatterns []string
+	}{
+		{
+			name:             "last_match_wins",
+			files:            []string{"docs/main.go"},
+			expectedPatterns: []string{"/docs/"},
+		},
+		{
+			name:             "later_pattern_over_default",
+			files:            []string{"cmd/main.go"},
+			expectedPatterns: []string{"*.go"},
+		},
+		{
+			name:             "several_areas",
+			files:            []string{"docs/index.md", "main.go", "Makefile", "approval.go"},
+			expectedPatterns: []string{"*", "*.go", "/docs/"},
+		},
+		{
+			name:             "unowned",
+			files:            []string{"docs/generated/api.md"},
+			expectedPatterns: []string{},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			patterns := []string{}
+			for _, area := range ownedAreas(rules, testCase.files) {
+				patterns = append(patterns, area.pattern)
+			}
+			if !reflect.DeepEqual(patterns, testCase.expectedPatterns) {
+				t.Fatalf("actual %v, expected %v", patterns, testCase.expectedPatterns)
+			}
+		})
+	}
+}
+
+func TestParseCodeownersErrors(t *testing.T) {
+	for _, raw := range []string{"!*.go @login1", "[ab].go @login1"} {
+		if _, err := parseCodeowners(raw); err == nil {
+			t.Fatalf("expected an error parsing %q", raw)
+		}
+	}
+}
+
+func TestResolveCodeowners(t *testing.T) {
+	rules, err := parseCodeowners(testCodeowners)
+	if err != nil {
+		t.Fatalf("error parsing CODEOWNERS: %v", err)
+	}
+	areas := ownedAreas(rules, []string{"Makefile", "main.go", "docs/index.md"})
+	if teams, expected := codeownersTeams(areas), []teamRef{{org: "org", name: "platform"}}; !reflect.DeepEqual(teams, expected) {
+		t.Fatalf("teams %v, expected %v", teams, expected)
+	}
+	teamMembers := map[teamRef][]string{{org: "org", name: "platform"}: {"login2", "login4"}}
+
+	approvers, approvalAreas := resolveCodeowners(io.Discard, areas, teamMembers, "login1", true)
+	expectedApprovers := []string{"login2", "login4", "login3"}
+	if !reflect.DeepEqual(approvers, expectedApprovers) {
+		t.Fatalf("approvers %v, expected %v", approvers, expectedApprovers)
+	}
+	expectedAreas := []approval.Area{
+		{Name: "*", Approvers: []string{"login2", "login4"}},
+		{Name: "*.go", Approvers: []string{"login2"}},
+		{Name: "/docs/", Approvers: []string{"login3"}},
+	}
+	if !reflect.DeepEqual(approvalAreas, expectedAreas) {
+		t.Fatalf("areas %v, expected %v", approvalAreas, expectedAreas)
+	}
+}
+
+func TestChangedFiles(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/owner/repo/pulls/7/files", func(w http.ResponseWriter, r *http.Request) {
+		files := []map[string]string{{"filename": "main.go"}}
+		if r.URL.Query().Get("page") == "2" {
+			files = []map[string]string{{"filename": "docs/new.md", "previous_filename": "docs/old.md"}}
+		} else {
+			w.Header().Set("Link", `<`+r.URL.Path+`?page=2>; rel="next"`)
+		}
+		if err := json.NewEncoder(w).Encode(files); err != nil {
+			t.Errorf("error encoding response: %v", err)
+		}
+	})
+	mux.HandleFunc("/repos/owner/repo/compare/abc...def", func(w http.ResponseWriter, r *http.Request) {
+		comparison := map[string]interface{}{"files": []map[string]string{{"filename": "Makefile"}}}
+		if err := json.NewEncoder(w).Encode(comparison); err != nil {
+			t.Errorf("error encoding response: %v", err)
+		}
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	client := github.NewClient(nil)
+	baseURL, err := url.Parse(server.URL + "/")
+	if err != nil {
+		t.Fatalf("error parsing URL: %v", err)
+	}
+	client.BaseURL = baseURL
+
+	testCases := []struct {
+		name          string
+		event         workflowEvent
+		expectedFiles []string
+		isSuccess     bool
+	}{
+		{
+			name:          "pull_request",
+			event:         workflowEvent{Name: "pull_request", Payload: map[string]interface{}{"pull_request": map[string]interface{}{"number": float64(7)}}},
+			expectedFiles: []string{"main.go", "docs/new.md", "docs/old.md"},
+			isSuccess:     true,
+		},
+		{
+			name:          "push",
+			event:         workflowEvent{Name: "push", Payload: map[string]interface{}{"before": "abc", "after": "def"}},
+			expectedFiles: []string{"Makefile"},
+			isSuccess:     true,
+		},
+		{
+			name:      "new_branch",
+			event:     workflowEvent{Name: "push", Payload: map[string]interface{}{"before": "0000000000000000000000000000000000000000", "after": "def"}},
+			isSuccess: false,
+		},
+		{
+			name:      "workflow_dispatch",
+			event:     workflowEvent{Name: "workflow_dispatch"},
+			isSuccess: false,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			files, err := changedFiles(context.Background(), client, "owner", "repo", testCase.event)
+			if (err == nil) != testCase.isSuccess {
+				t.Fatalf("expected success %v, got error %v", testCase.isSuccess, err)
+			}
+			if testCase.isSuccess && !reflect.DeepEqual(files, testCase.expectedFiles) {
+				t.Fatalf("files %v, expected %v", files, testCase.expectedFiles)
+			}
+		})
+	}
+}
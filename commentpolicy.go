@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/v43/github"
+)
+
+// editedCommentPolicy controls how comments that were edited after they were
+// posted take part in the approval evaluation. Deleted comments are never
+// returned by the comments API, so they stop counting on the next poll
+// regardless of the policy.
+type editedCommentPolicy string
+
+const (
+	// editedCommentPolicyReevaluate evaluates the current body of every
+	// comment, edited or not. This is the historical behavior.
+	editedCommentPolicyReevaluate editedCommentPolicy = "reevaluate"
+	// editedCommentPolicyIgnore skips any comment whose updated_at is later
+	// than its created_at.
+	editedCommentPolicyIgnore editedCommentPolicy = "ignore"
+)
+
+func parseEditedCommentPolicy(raw string) (editedCommentPolicy, error) {
+	switch policy := editedCommentPolicy(strings.ToLower(strings.TrimSpace(raw))); policy {
+	case "":
+		return editedCommentPolicyReevaluate, nil
+	case editedCommentPolicyReevaluate, editedCommentPolicyIgnore:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown edited comments policy %q, expected %q or %q", raw, editedCommentPolicyReevaluate, editedCommentPolicyIgnore)
+	}
+}
+
+func isEditedComment(comment *github.IssueComment) bool {
+	if comment.CreatedAt == nil || comment.UpdatedAt == nil {
+		return false
+	}
+	return comment.UpdatedAt.After(*comment.CreatedAt)
+}
+
+// filterComments returns the comments that should be evaluated under the
+// given policy, along with the IDs of the comments that were left out.
+func filterComments(comments []*github.IssueComment, policy editedCommentPolicy) ([]*github.IssueComment, []int64) {
+	if policy != editedCommentPolicyIgnore {
+		return comments, nil
+	}
+
+	kept := make([]*github.IssueComment, 0, len(comments))
+	var ignored []int64
+	for _, comment := range comments {
+		if isEditedComment(comment) {
+			ignored = append(ignored, comment.GetID())
+			continue
+		}
+		kept = append(kept, comment)
+	}
+	return kept, ignored
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v43/github"
+)
+
+func TestFilterComments(t *testing.T) {
+	created := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	edited := created.Add(5 * time.Minute)
+
+	unedited := &github.IssueComment{
+		ID:        github.Int64(1),
+		CreatedAt: &created,
+		UpdatedAt: &created,
+	}
+	editedLater := &github.IssueComment{
+		ID:        github.Int64(2),
+		CreatedAt: &created,
+		UpdatedAt: &edited,
+	}
+	noTimestamps := &github.IssueComment{
+		ID: github.Int64(3),
+	}
+
+	testCases := []struct {
+		name            string
+		policy          editedCommentPolicy
+		comments        []*github.IssueComment
+		expectedKept    []*github.IssueComment
+		expectedIgnored []int64
+	}{
+		{
+			name:         "reevaluate_keeps_edited",
+			policy:       editedCommentPolicyReevaluate,
+			comments:     []*github.IssueComment{unedited, editedLater},
+			expectedKept: []*github.IssueComment{unedited, editedLater},
+		},
+		{
+			name:            "ignore_drops_edited",
+			policy:          editedCommentPolicyIgnore,
+			comments:        []*github.IssueComment{unedited, editedLater},
+			expectedKept:    []*github.IssueComment{unedited},
+			expectedIgnored: []int64{2},
+		},
+		{
+			name:         "ignore_keeps_comments_without_timestamps",
+			policy:       editedCommentPolicyIgnore,
+			comments:     []*github.IssueComment{noTimestamps},
+			expectedKept: []*github.IssueComment{noTimestamps},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			kept, ignored := filterComments(testCase.comments, testCase.policy)
+			if !reflect.DeepEqual(kept, testCase.expectedKept) {
+				t.Fatalf("expected kept %v but got %v", testCase.expectedKept, kept)
+			}
+			if !reflect.DeepEqual(ignored, testCase.expectedIgnored) {
+				t.Fatalf("expected ignored %v but got %v", testCase.expectedIgnored, ignored)
+			}
+		})
+	}
+}
+
+func TestParseEditedCommentPolicy(t *testing.T) {
+	testCases := []struct {
+		name      string
+		raw       string
+		expected  editedCommentPolicy
+		isSuccess bool
+	}{
+		{name: "empty_defaults_to_reevaluate", raw: "", expected: editedCommentPolicyReevaluate, isSuccess: true},
+		{name: "ignore", raw: "ignore", expected: editedCommentPolicyIgnore, isSuccess: true},
+		{name: "ignore_mixed_case", raw: " Ignore ", expected: editedCommentPolicyIgnore, isSuccess: true},
+		{name: "unknown", raw: "sometimes", isSuccess: false},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			actual, err := parseEditedCommentPolicy(testCase.raw)
+			if (err == nil) != testCase.isSuccess {
+				t.Fatalf("expected success %v but got error %v", testCase.isSuccess, err)
+			}
+			if actual != testCase.expected {
+				t.Fatalf("expected %q but got %q", testCase.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/v43/github"
+	"gopkg.in/yaml.v3"
+)
+
+// approvalConfig is the repository config file, .github/manual-approval.yml
+// by default. It defines named approval policies, so that workflows can share
+// them instead of repeating the same inputs, and the rules that select one of
+// them.
+type approvalConfig struct {
+	Policies map[string]approvalPolicy `yaml:"policies"`
+	Rules    []policyRule              `yaml:"rules"`
+}
+
+// approvalPolicy is a named policy of the config file. Its keys are named
+// after the inputs they stand in for.
+type approvalPolicy struct {
+	Approvers               []string `yaml:"approvers"`
+	RequiredApprovers       []string `yaml:"required-approvers"`
+	MinimumApprovals        *int     `yaml:"minimum-approvals"`
+	AdditionalApprovedWords []string `yaml:"additional-approved-words"`
+	AdditionalDeniedWords   []string `yaml:"additional-denied-words"`
+	IssueLabels             []string `yaml:"issue-labels"`
+	IssueTitle              string   `yaml:"issue-title"`
+	IssueBody               string   `yaml:"issue-body"`
+	TimeoutMinutes          int      `yaml:"timeout-minutes"`
+}
+
+// policyRule selects a policy for the workflow runs it matches. Ref and Event
+// are glob patterns matched against GITHUB_REF and GITHUB_EVENT_NAME, and
+// Payload maps dotted paths into the event payload, e.g. inputs.environment,
+// to glob patterns of their values. Conditions that are left out match
+// anything.
+type policyRule struct {
+	Policy  string            `yaml:"policy"`
+	Ref     string            `yaml:"ref"`
+	Event   string            `yaml:"event"`
+	Payload map[string]string `yaml:"payload"`
+}
+
+// configKeys are the keys allowed at each level of the config file.
+var (
+	configKeys       = []string{"policies", "rules"}
+	configRuleKeys   = []string{"policy", "ref", "event", "payload"}
+	configPolicyKeys = []string{"approvers", "required-approvers", "minimum-approvals", "additional-approved-words", "additional-denied-words", "issue-labels", "issue-title", "issue-body", "timeout-minutes"}
+)
+
+// parseApprovalConfig parses and validates a config file. Errors name the
+// line of the offending key where there is one.
+func parseApprovalConfig(raw []byte) (*approvalConfig, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(raw, &root); err != nil {
+		return nil, err
+	}
+	if len(root.Content) == 0 {
+		return &approvalConfig{}, nil
+	}
+	if err := validateConfigKeys(root.Content[0]); err != nil {
+		return nil, err
+	}
+
+	var config approvalConfig
+	if err := root.Content[0].Decode(&config); err != nil {
+		return nil, err
+	}
+	for _, name := range config.policyNames() {
+		if err := config.Policies[name].validate(); err != nil {
+			return nil, fmt.Errorf("policy %q: %w", name, err)
+		}
+	}
+	for i, rule := range config.Rules {
+		if err := rule.validate(config.Policies); err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i+1, err)
+		}
+	}
+	return &config, nil
+}
+
+func validateConfigKeys(node *yaml.Node) error {
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: expected a mapping with %s", node.Line, strings.Join(configKeys, ", "))
+	}
+	for i := 0; i < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		if !slices.Contains(configKeys, key.Value) {
+			return fmt.Errorf("line %d: unknown key %q, expected one of %s", key.Line, key.Value, strings.Join(configKeys, ", "))
+		}
+		if key.Value == "rules" {
+			if err := validateRuleKeys(value); err != nil {
+				return err
+			}
+			continue
+		}
+		if value.Kind != yaml.MappingNode {
+			return fmt.Errorf("line %d: %s must be a mapping of policy names to policies", value.Line, key.Value)
+		}
+		for j := 0; j < len(value.Content); j += 2 {
+			name, policy := value.Content[j], value.Content[j+1]
+			if policy.Kind != yaml.MappingNode {
+				return fmt.Errorf("line %d: policy %q must be a mapping", policy.Line, name.Value)
+			}
+			for k := 0; k < len(policy.Content); k += 2 {
+				policyKey := policy.Content[k]
+				if !slices.Contains(configPolicyKeys, policyKey.Value) {
+					return fmt.Errorf("line %d: unknown key %q in policy %q, expected one of %s", policyKey.Line, policyKey.Value, name.Value, strings.Join(configPolicyKeys, ", "))
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func validateRuleKeys(node *yaml.Node) error {
+	if node.Kind != yaml.SequenceNode {
+		return fmt.Errorf("line %d: rules must be a list", node.Line)
+	}
+	for i, rule := range node.Content {
+		if rule.Kind != yaml.MappingNode {
+			return fmt.Errorf("line %d: rule %d must be a mapping", rule.Line, i+1)
+		}
+		for j := 0; j < len(rule.Content); j += 2 {
+			ruleKey := rule.Content[j]
+			if !slices.Contains(configRuleKeys, ruleKey.Value) {
+				return fmt.Errorf("line %d: unknown key %q in rule %d, expected one of %s", ruleKey.Line, ruleKey.Value, i+1, strings.Join(configRuleKeys, ", "))
+			}
+		}
+	}
+	return nil
+}
+
+func (p approvalPolicy) validate() error {
+	if p.MinimumApprovals != nil && *p.MinimumApprovals < 0 {
+		return fmt.Errorf("minimum-approvals must not be negative")
+	}
+	if p.TimeoutMinutes < 0 {
+		return fmt.Errorf("timeout-minutes must not be negative")
+	}
+	for _, words := range [][]string{p.Approvers, p.RequiredApprovers, p.AdditionalApprovedWords, p.AdditionalDeniedWords, p.IssueLabels} {
+		for _, word := range words {
+			if strings.TrimSpace(word) == "" || strings.Contains(word, ",") {
+				return fmt.Errorf("%q is not a valid list entry", word)
+			}
+		}
+	}
+	return nil
+}
+
+func (r policyRule) validate(policies map[string]approvalPolicy) error {
+	if r.Policy == "" {
+		return fmt.Errorf("policy is required")
+	}
+	if _, ok := policies[r.Policy]; !ok {
+		return fmt.Errorf("unknown policy %q", r.Policy)
+	}
+	patterns := []string{r.Ref, r.Event}
+	for _, pattern := range r.Payload {
+		patterns = append(patterns, pattern)
+	}
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q", pattern)
+		}
+	}
+	return nil
+}
+
+func (c *approvalConfig) policyNames() []string {
+	names := make([]string, 0, len(c.Policies))
+	for name := range c.Policies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// policy returns the named policy. An empty name selects the policy named
+// defaultPolicy, if there is one.
+func (c *approvalConfig) policy(name string) (approvalPolicy, string, bool, error) {
+	if name == "" {
+		policy, ok := c.Policies[defaultPolicy]
+		return policy, defaultPolicy, ok, nil
+	}
+	policy, ok := c.Policies[name]
+	if !ok {
+		return approvalPolicy{}, "", false, fmt.Errorf("unknown policy %q, expected one of %v", name, c.policyNames())
+	}
+	return policy, name, true, nil
+}
+
+// workflowEvent is what rules are matched against: the ref and name of the
+// event that triggered the workflow, and its payload.
+type workflowEvent struct {
+	Ref     string
+	Name    string
+	Payload map[string]interface{}
+}
+
+// selectPolicy picks the policy to use and returns the reason it was picked.
+// The policy input wins over the rules, and the first rule that matches the
+// event wins over the rest. Without either, the name is empty so that policy
+// falls back to the default one.
+func (c *approvalConfig) selectPolicy(input string, event workflowEvent) (string, string) {
+	if input != "" {
+		return input, "it is set by the policy input"
+	}
+	for i, rule := range c.Rules {
+		if conditions, ok := rule.match(event); ok {
+			if len(conditions) == 0 {
+				return rule.Policy, fmt.Sprintf("rule %d matches any run", i+1)
+			}
+			return rule.Policy, fmt.Sprintf("rule %d matched %s", i+1, strings.Join(conditions, ", "))
+		}
+	}
+	if len(c.Rules) > 0 {
+		return "", "no rule matched"
+	}
+	return "", "no policy input was given"
+}
+
+// match reports whether the rule matches the event, and the conditions that
+// matched it.
+func (r policyRule) match(event workflowEvent) ([]string, bool) {
+	var conditions []string
+	if r.Ref != "" {
+		if ok, _ := path.Match(r.Ref, event.Ref); !ok {
+			return nil, false
+		}
+		conditions = append(conditions, fmt.Sprintf("ref %q", event.Ref))
+	}
+	if r.Event != "" {
+		if ok, _ := path.Match(r.Event, event.Name); !ok {
+			return nil, false
+		}
+		conditions = append(conditions, fmt.Sprintf("event %q", event.Name))
+	}
+	keys := make([]string, 0, len(r.Payload))
+	for key := range r.Payload {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value, found := payloadValue(event.Payload, key)
+		if !found {
+			return nil, false
+		}
+		if ok, _ := path.Match(r.Payload[key], value); !ok {
+			return nil, false
+		}
+		conditions = append(conditions, fmt.Sprintf("%s %q", key, value))
+	}
+	return conditions, true
+}
+
+// payloadValue looks up a dotted path in the event payload. Only strings,
+// numbers and booleans have a value.
+func payloadValue(payload map[string]interface{}, key string) (string, bool) {
+	var value interface{} = payload
+	for _, field := range strings.Split(key, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		if value, ok = object[field]; !ok {
+			return "", false
+		}
+	}
+	switch value := value.(type) {
+	case string:
+		return value, true
+	case float64, bool:
+		return fmt.Sprint(value), true
+	default:
+		return "", false
+	}
+}
+
+// inputs returns the values of the policy by the environment variable of the
+// input they stand in for.
+func (p approvalPolicy) inputs() map[string]string {
+	inputs := map[string]string{
+		envVarApprovers:               strings.Join(p.Approvers, ","),
+		envVarRequiredApprovers:       strings.Join(p.RequiredApprovers, ","),
+		envVarAdditionalApprovedWords: strings.Join(p.AdditionalApprovedWords, ","),
+		envVarAdditionalDeniedWords:   strings.Join(p.AdditionalDeniedWords, ","),
+		envVarIssueLabels:             strings.Join(p.IssueLabels, ","),
+		envVarIssueTitle:              p.IssueTitle,
+		envVarIssueBody:               p.IssueBody,
+	}
+	if p.MinimumApprovals != nil {
+		inputs[envVarMinimumApprovals] = strconv.Itoa(*p.MinimumApprovals)
+	}
+	return inputs
+}
+
+// readApprovalConfig reads the config file at path. With a client, it is read
+// from the default branch of the repository through the contents API, so
+// that the branch being approved can't change its own policy. Without one,
+// e.g. with other backends, it is read from the workspace. It returns nil if
+// the file doesn't exist. An optional file, one neither config-file nor
+// policy asked for, is also missing if the token can't read it, as reading
+// contents of a private repository takes the contents: read permission.
+func readApprovalConfig(ctx context.Context, log io.Writer, client *github.Client, owner, repo, path string, optional bool) (*approvalConfig, error) {
+	var raw []byte
+	if client != nil {
+		file, _, resp, err := client.Repositories.GetContents(ctx, owner, repo, path, nil)
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return nil, nil
+		}
+		if optional && resp != nil && resp.StatusCode == http.StatusForbidden {
+			fmt.Fprintf(log, "Not using %s, as the token isn't allowed to read it\n", path)
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error getting %s from %s/%s: %w", path, owner, repo, err)
+		}
+		if file == nil {
+			return nil, fmt.Errorf("%s in %s/%s is not a file", path, owner, repo)
+		}
+		content, err := file.GetContent()
+		if err != nil {
+			return nil, fmt.Errorf("error decoding %s: %w", path, err)
+		}
+		raw = []byte(content)
+	} else {
+		var err error
+		raw, err = os.ReadFile(filepath.Join(os.Getenv(envVarWorkspace), path))
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	config, err := parseApprovalConfig(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", path, err)
+	}
+	return config, nil
+}
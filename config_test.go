@@ -0,0 +1,319 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v43/github"
+)
+
+const testConfig = `
+policies:
+  default:
+    approvers: [login1, login2]
+  prod-strict:
+    approvers:
+      - login1
+      - login2
+      - org-team1
+    required-approvers: [login2]
+    minimum-approvals: 2
+    additional-approved-words: [ship it]
+    issue-labels: [deploy, prod]
+    issue-title: Deploy to production
+    timeout-minutes: 60
+`
+
+func TestParseApprovalConfig(t *testing.T) {
+	config, err := parseApprovalConfig([]byte(testConfig))
+	if err != nil {
+		t.Fatalf("error parsing config: %v", err)
+	}
+	minimumApprovals := 2
+	expected := approvalPolicy{
+		Approvers:               []string{"login1", "login2", "org-team1"},
+		RequiredApprovers:       []string{"login2"},
+		MinimumApprovals:        &minimumApprovals,
+		AdditionalApprovedWords: []string{"ship it"},
+		IssueLabels:             []string{"deploy", "prod"},
+		IssueTitle:              "Deploy to production",
+		TimeoutMinutes:          60,
+	}
+	if actual := config.Policies["prod-strict"]; !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("actual %+v, expected %+v", actual, expected)
+	}
+}
+
+func TestParseApprovalConfigErrors(t *testing.T) {
+	testCases := []struct {
+		name          string
+		config        string
+		expectedError string
+	}{
+		{
+			name:          "unknown_top_level_key",
+			config:        "policy:\n  default:\n    approvers: [login1]\n",
+			expectedError: `line 1: unknown key "policy"`,
+		},
+		{
+			name:          "unknown_policy_key",
+			config:        "policies:\n  default:\n    approver: [login1]\n",
+			expectedError: `line 3: unknown key "approver" in policy "default"`,
+		},
+		{
+			name:          "policy_not_a_mapping",
+			config:        "policies:\n  default: login1\n",
+			expectedError: `line 2: policy "default" must be a mapping`,
+		},
+		{
+			name:          "wrong_type",
+			config:        "policies:\n  default:\n    minimum-approvals: two\n",
+			expectedError: "line 3: cannot unmarshal",
+		},
+		{
+			name:          "negative_minimum",
+			config:        "policies:\n  default:\n    minimum-approvals: -1\n",
+			expectedError: `policy "default": minimum-approvals must not be negative`,
+		},
+		{
+			name:          "comma_in_list",
+			config:        "policies:\n  default:\n    approvers: [\"login1,login2\"]\n",
+			expectedError: `policy "default": "login1,login2" is not a valid list entry`,
+		},
+		{
+			name:          "unknown_rule_key",
+			config:        "policies:\n  default: {}\nrules:\n  - policy: default\n    branch: main\n",
+			expectedError: `line 5: unknown key "branch" in rule 1`,
+		},
+		{
+			name:          "rule_unknown_policy",
+			config:        "policies:\n  default: {}\nrules:\n  - policy: release\n",
+			expectedError: `rule 1: unknown policy "release"`,
+		},
+		{
+			name:          "rule_without_policy",
+			config:        "policies:\n  default: {}\nrules:\n  - ref: refs/heads/main\n",
+			expectedError: "rule 1: policy is required",
+		},
+		{
+			name:          "rule_invalid_pattern",
+			config:        "policies:\n  default: {}\nrules:\n  - policy: default\n    ref: refs/tags/[v\n",
+			expectedError: `rule 1: invalid pattern "refs/tags/[v"`,
+		},
+		{
+			name:          "invalid_yaml",
+			config:        "policies: [\n",
+			expectedError: "yaml:",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			_, err := parseApprovalConfig([]byte(testCase.config))
+			if err == nil || !strings.Contains(err.Error(), testCase.expectedError) {
+				t.Fatalf("expected an error containing %q, got %v", testCase.expectedError, err)
+			}
+		})
+	}
+}
+
+func TestApprovalConfigPolicy(t *testing.T) {
+	config, err := parseApprovalConfig([]byte(testConfig))
+	if err != nil {
+		t.Fatalf("error parsing config: %v", err)
+	}
+
+	if _, name, found, err := config.policy(""); err != nil || !found || name != defaultPolicy {
+		t.Fatalf("expected the default policy, got %q %v %v", name, found, err)
+	}
+	if _, name, found, err := config.policy("prod-strict"); err != nil || !found || name != "prod-strict" {
+		t.Fatalf("expected prod-strict, got %q %v %v", name, found, err)
+	}
+	if _, _, _, err := config.policy("staging"); err == nil || !strings.Contains(err.Error(), "[default prod-strict]") {
+		t.Fatalf("expected an error listing the policies, got %v", err)
+	}
+
+	withoutDefault := &approvalConfig{Policies: map[string]approvalPolicy{"prod-strict": {}}}
+	if _, _, found, err := withoutDefault.policy(""); err != nil || found {
+		t.Fatalf("expected no policy, got %v %v", found, err)
+	}
+}
+
+func TestReadApprovalConfig(t *testing.T) {
+	t.Run("workspace", func(t *testing.T) {
+		workspace := t.TempDir()
+		t.Setenv(envVarWorkspace, workspace)
+		if err := os.MkdirAll(filepath.Join(workspace, ".github"), 0o755); err != nil {
+			t.Fatalf("error creating directory: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(workspace, defaultConfigFile), []byte(testConfig), 0o600); err != nil {
+			t.Fatalf("error writing config: %v", err)
+		}
+
+		config, err := readApprovalConfig(context.Background(), io.Discard, nil, "owner", "repo", defaultConfigFile, false)
+		if err != nil {
+			t.Fatalf("error reading config: %v", err)
+		}
+		if len(config.Policies) != 2 {
+			t.Fatalf("got policies %v, expected 2", config.policyNames())
+		}
+
+		config, err = readApprovalConfig(context.Background(), io.Discard, nil, "owner", "repo", "missing.yml", false)
+		if err != nil || config != nil {
+			t.Fatalf("expected no config for a missing file, got %v %v", config, err)
+		}
+	})
+
+	t.Run("contents_api", func(t *testing.T) {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/repos/owner/repo/contents/.github/manual-approval.yml", func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("ref") != "" {
+				t.Errorf("expected the default branch, got ref %q", r.URL.Query().Get("ref"))
+			}
+			content := base64.StdEncoding.EncodeToString([]byte(testConfig))
+			if err := json.NewEncoder(w).Encode(map[string]string{"type": "file", "encoding": "base64", "content": content}); err != nil {
+				t.Errorf("error encoding response: %v", err)
+			}
+		})
+		mux.HandleFunc("/repos/owner/other/contents/.github/manual-approval.yml", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+		})
+		mux.HandleFunc("/repos/owner/private/contents/.github/manual-approval.yml", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+		})
+		server := httptest.NewServer(mux)
+		t.Cleanup(server.Close)
+		client := github.NewClient(nil)
+		baseURL, err := url.Parse(server.URL + "/")
+		if err != nil {
+			t.Fatalf("error parsing URL: %v", err)
+		}
+		client.BaseURL = baseURL
+
+		config, err := readApprovalConfig(context.Background(), io.Discard, client, "owner", "repo", defaultConfigFile, false)
+		if err != nil {
+			t.Fatalf("error reading config: %v", err)
+		}
+		if _, ok := config.Policies["prod-strict"]; !ok {
+			t.Fatalf("got policies %v, expected prod-strict", config.policyNames())
+		}
+
+		config, err = readApprovalConfig(context.Background(), io.Discard, client, "owner", "other", defaultConfigFile, false)
+		if err != nil || config != nil {
+			t.Fatalf("expected no config for a missing file, got %v %v", config, err)
+		}
+
+		config, err = readApprovalConfig(context.Background(), io.Discard, client, "owner", "private", defaultConfigFile, true)
+		if err != nil || config != nil {
+			t.Fatalf("expected no config for a forbidden optional file, got %v %v", config, err)
+		}
+		if _, err := readApprovalConfig(context.Background(), io.Discard, client, "owner", "private", defaultConfigFile, false); err == nil {
+			t.Fatalf("expected an error for a forbidden file that was asked for")
+		}
+	})
+}
+
+func TestApprovalConfigSelectPolicy(t *testing.T) {
+	config, err := parseApprovalConfig([]byte(`
+policies:
+  default: {}
+  prod-strict: {}
+  release: {}
+rules:
+  - policy: prod-strict
+    ref: refs/heads/main
+    event: workflow_dispatch
+    payload:
+      inputs.environment: prod
+  - policy: release
+    ref: refs/tags/v*
+`))
+	if err != nil {
+		t.Fatalf("error parsing config: %v", err)
+	}
+
+	testCases := []struct {
+		name           string
+		input          string
+		event          workflowEvent
+		expectedPolicy string
+		expectedReason string
+	}{
+		{
+			name:           "prod_dispatch",
+			event:          workflowEvent{Ref: "refs/heads/main", Name: "workflow_dispatch", Payload: map[string]interface{}{"inputs": map[string]interface{}{"environment": "prod"}}},
+			expectedPolicy: "prod-strict",
+			expectedReason: `rule 1 matched ref "refs/heads/main", event "workflow_dispatch", inputs.environment "prod"`,
+		},
+		{
+			name:           "staging_dispatch",
+			event:          workflowEvent{Ref: "refs/heads/main", Name: "workflow_dispatch", Payload: map[string]interface{}{"inputs": map[string]interface{}{"environment": "staging"}}},
+			expectedReason: "no rule matched",
+		},
+		{
+			name:           "push_without_payload_field",
+			event:          workflowEvent{Ref: "refs/heads/main", Name: "workflow_dispatch"},
+			expectedReason: "no rule matched",
+		},
+		{
+			name:           "release_tag",
+			event:          workflowEvent{Ref: "refs/tags/v1.2.3", Name: "push"},
+			expectedPolicy: "release",
+			expectedReason: `rule 2 matched ref "refs/tags/v1.2.3"`,
+		},
+		{
+			name:           "input_wins",
+			input:          "default",
+			event:          workflowEvent{Ref: "refs/tags/v1.2.3", Name: "push"},
+			expectedPolicy: "default",
+			expectedReason: "it is set by the policy input",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			policy, reason := config.selectPolicy(testCase.input, testCase.event)
+			if policy != testCase.expectedPolicy || reason != testCase.expectedReason {
+				t.Fatalf("got %q because %q, expected %q because %q", policy, reason, testCase.expectedPolicy, testCase.expectedReason)
+			}
+		})
+	}
+}
+
+func TestPayloadValue(t *testing.T) {
+	payload := map[string]interface{}{
+		"inputs":       map[string]interface{}{"environment": "prod", "dry-run": true},
+		"pull_request": map[string]interface{}{"number": float64(42), "labels": []interface{}{"deploy"}},
+	}
+	testCases := []struct {
+		key           string
+		expectedValue string
+		expectedFound bool
+	}{
+		{key: "inputs.environment", expectedValue: "prod", expectedFound: true},
+		{key: "inputs.dry-run", expectedValue: "true", expectedFound: true},
+		{key: "pull_request.number", expectedValue: "42", expectedFound: true},
+		{key: "pull_request.labels", expectedFound: false},
+		{key: "inputs.environment.name", expectedFound: false},
+		{key: "release.tag_name", expectedFound: false},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.key, func(t *testing.T) {
+			value, found := payloadValue(payload, testCase.key)
+			if value != testCase.expectedValue || found != testCase.expectedFound {
+				t.Fatalf("got %q %v, expected %q %v", value, found, testCase.expectedValue, testCase.expectedFound)
+			}
+		})
+	}
+}
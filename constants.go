@@ -1,7 +1,6 @@
 package main
 
 import (
-	"os"
 	"strings"
 	"time"
 )
@@ -9,6 +8,20 @@ import (
 const (
 	defaultPollingInterval time.Duration = 10 * time.Second
 
+	defaultApprovalReactions string = "+1,rocket"
+	defaultDenialReactions   string = "-1,confused"
+
+	defaultWorkItemType          string = "Task"
+	defaultWorkItemApprovedState string = "Closed"
+	defaultWorkItemDeniedState   string = "Removed"
+
+	defaultJiraIssueType      string = "Task"
+	defaultJiraApprovedStatus string = "Approved"
+	defaultJiraDeniedStatus   string = "Rejected"
+
+	defaultConfigFile string = ".github/manual-approval.yml"
+	defaultPolicy     string = "default"
+
 	envVarRepoFullName                       string = "GITHUB_REPOSITORY"
 	envVarRunID                              string = "GITHUB_RUN_ID"
 	envVarRepoOwner                          string = "GITHUB_REPOSITORY_OWNER"
@@ -28,26 +41,84 @@ const (
 	envVarTargetRepo                         string = "INPUT_TARGET-REPOSITORY"
 	envVarPollingIntervalSeconds             string = "INPUT_POLLING-INTERVAL-SECONDS"
 	envVarCloseIssueMeansDenial              string = "INPUT_CLOSE-ISSUE-MEANS-DENIAL"
-)
+	envVarEditedComments                     string = "INPUT_EDITED-COMMENTS"
+	envVarCommentSyntax                      string = "INPUT_COMMENT-SYNTAX"
+	envVarTarget                             string = "INPUT_TARGET"
+	envVarEventPath                          string = "GITHUB_EVENT_PATH"
+	envVarEventName                          string = "GITHUB_EVENT_NAME"
+	envVarRef                                string = "GITHUB_REF"
+	envVarChecklist                          string = "INPUT_CHECKLIST"
+	envVarIssueClosers                       string = "INPUT_ISSUE-CLOSERS"
+	envVarCloseIssueAsVote                   string = "INPUT_CLOSE-ISSUE-AS-VOTE"
+	envVarAllowReactions                     string = "INPUT_ALLOW-REACTIONS"
+	envVarApprovalReactions                  string = "INPUT_APPROVAL-REACTIONS"
+	envVarDenialReactions                    string = "INPUT_DENIAL-REACTIONS"
+	envVarIssueNumber                        string = "INPUT_ISSUE-NUMBER"
+	envVarCloseExistingIssue                 string = "INPUT_CLOSE-EXISTING-ISSUE"
+	envVarDiscussionCategory                 string = "INPUT_DISCUSSION-CATEGORY"
+	envVarBackend                            string = "INPUT_BACKEND"
+	envVarServerURL                          string = "GITHUB_SERVER_URL"
+	envVarRunNumber                          string = "GITHUB_RUN_NUMBER"
+	envVarAPIURL                             string = "GITHUB_API_URL"
+	envVarRunURL                             string = "INPUT_RUN-URL"
+	envVarWorkItemType                       string = "INPUT_WORK-ITEM-TYPE"
+	envVarWorkItemApprovedState              string = "INPUT_WORK-ITEM-APPROVED-STATE"
+	envVarWorkItemDeniedState                string = "INPUT_WORK-ITEM-DENIED-STATE"
+	envVarJiraURL                            string = "INPUT_JIRA-URL"
+	envVarJiraUser                           string = "INPUT_JIRA-USER"
+	envVarJiraToken                          string = "INPUT_JIRA-TOKEN"
+	envVarJiraProject                        string = "INPUT_JIRA-PROJECT"
+	envVarJiraIssueKey                       string = "INPUT_JIRA-ISSUE-KEY"
+	envVarJiraIssueType                      string = "INPUT_JIRA-ISSUE-TYPE"
+	envVarJiraApprovedStatuses               string = "INPUT_JIRA-APPROVED-STATUSES"
+	envVarJiraDeniedStatuses                 string = "INPUT_JIRA-DENIED-STATUSES"
+	envVarJiraAccountMapping                 string = "INPUT_JIRA-ACCOUNT-MAPPING"
+	envVarServiceNowInstanceURL              string = "INPUT_SERVICENOW-INSTANCE-URL"
+	envVarServiceNowUser                     string = "INPUT_SERVICENOW-USER"
+	envVarServiceNowPassword                 string = "INPUT_SERVICENOW-PASSWORD"
+	envVarServiceNowChangeType               string = "INPUT_SERVICENOW-CHANGE-TYPE"
+	envVarServiceNowStandardChangeTemplate   string = "INPUT_SERVICENOW-STANDARD-CHANGE-TEMPLATE"
+	envVarServiceNowAssignmentGroup          string = "INPUT_SERVICENOW-ASSIGNMENT-GROUP"
+	envVarApproversFromCodeowners            string = "INPUT_APPROVERS-FROM-CODEOWNERS"
+	envVarRequiredApprovers                  string = "INPUT_REQUIRED-APPROVERS"
+	envVarPolicy                             string = "INPUT_POLICY"
+	envVarConfigFile                         string = "INPUT_CONFIG-FILE"
+	envVarWorkspace                          string = "GITHUB_WORKSPACE"
+
+	envVarGitLabCI               string = "GITLAB_CI"
+	envVarGitLabAPIURL           string = "CI_API_V4_URL"
+	envVarGitLabProjectID        string = "CI_PROJECT_ID"
+	envVarGitLabProjectPath      string = "CI_PROJECT_PATH"
+	envVarGitLabProjectNamespace string = "CI_PROJECT_NAMESPACE"
+	envVarGitLabPipelineID       string = "CI_PIPELINE_ID"
+	envVarGitLabPipelineURL      string = "CI_PIPELINE_URL"
+	envVarGitLabJobToken         string = "CI_JOB_TOKEN"
+	envVarGitLabUserLogin        string = "GITLAB_USER_LOGIN"
 
-var (
-	additionalApprovedWords = readAdditionalWords(envVarAdditionalApprovedWords)
-	additionalDeniedWords   = readAdditionalWords(envVarAdditionalDeniedWords)
+	envVarForgejoActions string = "FORGEJO_ACTIONS"
+	envVarGiteaActions   string = "GITEA_ACTIONS"
 
-	approvedWords = append([]string{"approved", "approve", "lgtm", "yes"}, additionalApprovedWords...)
-	deniedWords   = append([]string{"denied", "deny", "no"}, additionalDeniedWords...)
+	envVarAzureTFBuild        string = "TF_BUILD"
+	envVarAzureCollectionURI  string = "SYSTEM_COLLECTIONURI"
+	envVarAzureTeamProject    string = "SYSTEM_TEAMPROJECT"
+	envVarAzureBuildID        string = "BUILD_BUILDID"
+	envVarAzureRepositoryName string = "BUILD_REPOSITORY_NAME"
+	envVarAzureRequestedFor   string = "BUILD_REQUESTEDFOREMAIL"
 )
 
-func readAdditionalWords(envVar string) []string {
-	rawValue := strings.TrimSpace(os.Getenv(envVar))
+func readAdditionalWords(in inputs, envVar string) []string {
+	rawValue := strings.TrimSpace(in.get(envVar))
 	if len(rawValue) == 0 {
 		// Nothing else to do here.
 		return []string{}
 	}
-	slicedWords := strings.Split(rawValue, ",")
-	for i := range slicedWords {
-		// no leading or trailing spaces in user provided words.
-		slicedWords[i] = strings.TrimSpace(slicedWords[i])
+	slicedWords := []string{}
+	for _, word := range strings.Split(rawValue, ",") {
+		// no leading or trailing spaces in user provided words, and blank
+		// entries, e.g. from a trailing comma, are skipped.
+		if word = strings.TrimSpace(word); word != "" {
+			slicedWords = append(slicedWords, word)
+		}
 	}
 	return slicedWords
 }
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/trstringer/manual-approval/pkg/approval"
+)
+
+// decisionRecord is the audit trail for a single approval request. It is
+// printed to the workflow log and exposed as the decision-record output so
+// that auditors can see which policy settings the decision was made under.
+type decisionRecord struct {
+	Status              string                     `json:"status"`
+	Repository          string                     `json:"repository"`
+	RunID               int                        `json:"runId"`
+	IssueNumber         int                        `json:"issueNumber"`
+	IssueURL            string                     `json:"issueUrl"`
+	Policy              string                     `json:"policy,omitempty"`
+	PolicyReason        string                     `json:"policyReason,omitempty"`
+	Approvers           []string                   `json:"approvers"`
+	RequiredApprovers   []string                   `json:"requiredApprovers,omitempty"`
+	Areas               []decisionArea             `json:"areas,omitempty"`
+	MinimumApprovals    int                        `json:"minimumApprovals"`
+	EditedCommentPolicy editedCommentPolicy        `json:"editedCommentPolicy"`
+	IgnoredCommentIDs   []int64                    `json:"ignoredCommentIds,omitempty"`
+	CommentSyntax       approval.CommentSyntax     `json:"commentSyntax"`
+	ReactionMapping     map[string]approval.Action `json:"reactionMapping,omitempty"`
+	CloseIssueAsVote    bool                       `json:"closeIssueAsVote"`
+	Checklist           []decisionChecklistItem    `json:"checklist,omitempty"`
+	Votes               []decisionVote             `json:"votes"`
+	Reason              string                     `json:"reason,omitempty"`
+	DecidedAt           time.Time                  `json:"decidedAt"`
+}
+
+// decisionVote is a vote that the decision rests on.
+type decisionVote struct {
+	User   string          `json:"user"`
+	Action approval.Action `json:"action"`
+	Reason string          `json:"reason,omitempty"`
+	Source string          `json:"source"`
+}
+
+// decisionArea is an area that needed an approval from one of its approvers.
+type decisionArea struct {
+	Name      string   `json:"name"`
+	Approvers []string `json:"approvers"`
+}
+
+// decisionChecklistItem is a checklist item and the user who ticked it.
+type decisionChecklistItem struct {
+	Item      string `json:"item"`
+	CheckedBy string `json:"checkedBy,omitempty"`
+}
+
+func (a *approvalEnvironment) decisionRecord(status string) decisionRecord {
+	minimumApprovals := a.minimumApprovals
+	if minimumApprovals == 0 {
+		minimumApprovals = len(a.issueApprovers)
+	}
+
+	votes := make([]decisionVote, 0, len(a.decision.Votes))
+	for _, v := range a.decision.Votes {
+		votes = append(votes, decisionVote{
+			User:   v.User,
+			Action: v.Action,
+			Reason: v.Reason,
+			Source: v.Source,
+		})
+	}
+
+	var areas []decisionArea
+	for _, area := range a.areas {
+		areas = append(areas, decisionArea{
+			Name:      area.Name,
+			Approvers: area.Approvers,
+		})
+	}
+
+	var checklist []decisionChecklistItem
+	for _, item := range a.checklistState {
+		checklist = append(checklist, decisionChecklistItem{
+			Item:      item.text,
+			CheckedBy: item.checkedBy,
+		})
+	}
+
+	return decisionRecord{
+		Status:              status,
+		Repository:          a.repoFullName,
+		RunID:               a.runID,
+		IssueNumber:         a.approvalIssueNumber,
+		IssueURL:            a.approvalIssue.GetHTMLURL(),
+		Policy:              a.policy,
+		PolicyReason:        a.policyReason,
+		Approvers:           a.issueApprovers,
+		RequiredApprovers:   a.requiredApprovers,
+		Areas:               areas,
+		MinimumApprovals:    minimumApprovals,
+		EditedCommentPolicy: a.editedCommentPolicy,
+		IgnoredCommentIDs:   a.ignoredCommentIDs,
+		CommentSyntax:       a.commentSyntax,
+		ReactionMapping:     a.reactionMapping,
+		CloseIssueAsVote:    a.closeIssueAsVote,
+		Checklist:           checklist,
+		Votes:               votes,
+		Reason:              a.decision.Reasons(),
+		DecidedAt:           time.Now().UTC(),
+	}
+}
+
+func (r decisionRecord) JSON() (string, error) {
+	raw, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+	return string(raw), nil
+}
@@ -0,0 +1,403 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v43/github"
+
+	"github.com/trstringer/manual-approval/pkg/approval"
+)
+
+// discussionChannel makes the approval request as a GitHub Discussion in the
+// configured category, for repositories that have issues disabled. Votes are
+// read from the discussion's comments and their replies. Once decided, the
+// decision comment is marked as the answer where the category allows it, and
+// the discussion is locked.
+type discussionChannel struct {
+	apprv    *approvalEnvironment
+	client   *github.Client
+	category string
+
+	discussionID string
+	answerable   bool
+}
+
+// discussionComment is a discussion comment or reply as returned by the
+// GraphQL API.
+type discussionComment struct {
+	DatabaseID   int64      `json:"databaseId"`
+	Body         string     `json:"body"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	LastEditedAt *time.Time `json:"lastEditedAt"`
+	Author       struct {
+		Login string `json:"login"`
+	} `json:"author"`
+}
+
+type discussionCategory struct {
+	ID           string `json:"id"`
+	Name         string `json:"name"`
+	Slug         string `json:"slug"`
+	IsAnswerable bool   `json:"isAnswerable"`
+}
+
+func (c *discussionChannel) CreateRequest(ctx context.Context) error {
+	a := c.apprv
+	repositoryID, category, err := c.findCategory(ctx)
+	if err != nil {
+		return err
+	}
+	c.answerable = category.IsAnswerable
+
+	title := a.approvalRequestTitle()
+	body := a.approvalRequestBody()
+	fmt.Fprintf(
+		a.log,
+		"Creating discussion in repo %s/%s category %q with the following content:\nTitle: %s\nApprovers: %s\nBody:\n%s\n",
+		a.targetRepoOwner,
+		a.targetRepoName,
+		category.Name,
+		title,
+		a.issueApprovers,
+		body,
+	)
+
+	const mutation = `mutation($repositoryId: ID!, $categoryId: ID!, $title: String!, $body: String!) {
+  createDiscussion(input: {repositoryId: $repositoryId, categoryId: $categoryId, title: $title, body: $body}) {
+    discussion {
+      id
+      number
+      url
+      author { login }
+    }
+  }
+}`
+	var result struct {
+		CreateDiscussion struct {
+			Discussion struct {
+				ID     string `json:"id"`
+				Number int    `json:"number"`
+				URL    string `json:"url"`
+				Author struct {
+					Login string `json:"login"`
+				} `json:"author"`
+			} `json:"discussion"`
+		} `json:"createDiscussion"`
+	}
+	err = doGraphQL(ctx, c.client, mutation, map[string]interface{}{
+		"repositoryId": repositoryID,
+		"categoryId":   category.ID,
+		"title":        title,
+		"body":         body,
+	}, &result)
+	if err != nil {
+		return fmt.Errorf("error creating discussion: %w", err)
+	}
+
+	discussion := result.CreateDiscussion.Discussion
+	c.discussionID = discussion.ID
+	a.approvalIssueNumber = discussion.Number
+	a.issueAuthor = discussion.Author.Login
+	a.approvalIssue = &github.Issue{
+		Number:  &discussion.Number,
+		HTMLURL: &discussion.URL,
+	}
+
+	for _, chunk := range splitLongString(a.issueBody) {
+		if _, err := c.comment(ctx, chunk); err != nil {
+			return fmt.Errorf("failed to add comment chunk to discussion: %w", err)
+		}
+	}
+
+	fmt.Fprintf(a.log, "Discussion created: %s\n", discussion.URL)
+	return nil
+}
+
+// findCategory looks up the target repository's ID and the discussion
+// category configured by name or slug.
+func (c *discussionChannel) findCategory(ctx context.Context) (string, discussionCategory, error) {
+	a := c.apprv
+	const query = `query($owner: String!, $repo: String!) {
+  repository(owner: $owner, name: $repo) {
+    id
+    hasDiscussionsEnabled
+    discussionCategories(first: 100) {
+      nodes { id name slug isAnswerable }
+    }
+  }
+}`
+	var result struct {
+		Repository struct {
+			ID                    string `json:"id"`
+			HasDiscussionsEnabled bool   `json:"hasDiscussionsEnabled"`
+			DiscussionCategories  struct {
+				Nodes []discussionCategory `json:"nodes"`
+			} `json:"discussionCategories"`
+		} `json:"repository"`
+	}
+	err := doGraphQL(ctx, c.client, query, map[string]interface{}{
+		"owner": a.targetRepoOwner,
+		"repo":  a.targetRepoName,
+	}, &result)
+	if err != nil {
+		return "", discussionCategory{}, fmt.Errorf("error getting discussion categories: %w", err)
+	}
+	if !result.Repository.HasDiscussionsEnabled {
+		return "", discussionCategory{}, fmt.Errorf("discussions are not enabled in %s/%s", a.targetRepoOwner, a.targetRepoName)
+	}
+
+	category, ok := matchDiscussionCategory(result.Repository.DiscussionCategories.Nodes, c.category)
+	if !ok {
+		return "", discussionCategory{}, fmt.Errorf("discussion category %q not found in %s/%s", c.category, a.targetRepoOwner, a.targetRepoName)
+	}
+	return result.Repository.ID, category, nil
+}
+
+// matchDiscussionCategory finds a category by its name or slug, ignoring
+// case.
+func matchDiscussionCategory(categories []discussionCategory, nameOrSlug string) (discussionCategory, bool) {
+	nameOrSlug = strings.TrimSpace(nameOrSlug)
+	for _, category := range categories {
+		if strings.EqualFold(category.Name, nameOrSlug) || strings.EqualFold(category.Slug, nameOrSlug) {
+			return category, true
+		}
+	}
+	return discussionCategory{}, false
+}
+
+// comment adds a top level comment to the discussion and returns its node ID.
+func (c *discussionChannel) comment(ctx context.Context, body string) (string, error) {
+	const mutation = `mutation($discussionId: ID!, $body: String!) {
+  addDiscussionComment(input: {discussionId: $discussionId, body: $body}) {
+    comment { id }
+  }
+}`
+	var result struct {
+		AddDiscussionComment struct {
+			Comment struct {
+				ID string `json:"id"`
+			} `json:"comment"`
+		} `json:"addDiscussionComment"`
+	}
+	err := doGraphQL(ctx, c.client, mutation, map[string]interface{}{
+		"discussionId": c.discussionID,
+		"body":         body,
+	}, &result)
+	return result.AddDiscussionComment.Comment.ID, err
+}
+
+func (c *discussionChannel) ListVotes(ctx context.Context) ([]approval.Vote, error) {
+	a := c.apprv
+	discussionComments, err := c.listComments(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting discussion comments: %w", err)
+	}
+
+	comments := issueCommentsFromDiscussion(discussionComments)
+	comments, a.ignoredCommentIDs = filterComments(comments, a.editedCommentPolicy)
+	if len(a.ignoredCommentIDs) > 0 {
+		fmt.Fprintf(a.log, "Ignoring %d edited comment(s): %v\n", len(a.ignoredCommentIDs), a.ignoredCommentIDs)
+	}
+	return a.evaluator.VotesFromComments(approvalComments(comments)), nil
+}
+
+// listComments lists the discussion's comments, each followed by its
+// replies.
+func (c *discussionChannel) listComments(ctx context.Context) ([]discussionComment, error) {
+	const query = `query($id: ID!, $after: String) {
+  node(id: $id) {
+    ... on Discussion {
+      comments(first: 100, after: $after) {
+        pageInfo { hasNextPage endCursor }
+        nodes {
+          id
+          databaseId
+          body
+          createdAt
+          lastEditedAt
+          author { login }
+          replies(first: 100) {
+            pageInfo { hasNextPage endCursor }
+            nodes {
+              databaseId
+              body
+              createdAt
+              lastEditedAt
+              author { login }
+            }
+          }
+        }
+      }
+    }
+  }
+}`
+	var comments []discussionComment
+	var after *string
+	for {
+		var result struct {
+			Node struct {
+				Comments struct {
+					PageInfo struct {
+						HasNextPage bool   `json:"hasNextPage"`
+						EndCursor   string `json:"endCursor"`
+					} `json:"pageInfo"`
+					Nodes []struct {
+						ID string `json:"id"`
+						discussionComment
+						Replies discussionReplies `json:"replies"`
+					} `json:"nodes"`
+				} `json:"comments"`
+			} `json:"node"`
+		}
+		err := doGraphQL(ctx, c.client, query, map[string]interface{}{
+			"id":    c.discussionID,
+			"after": after,
+		}, &result)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, node := range result.Node.Comments.Nodes {
+			comments = append(comments, node.discussionComment)
+			comments = append(comments, node.Replies.Nodes...)
+			if node.Replies.PageInfo.HasNextPage {
+				replies, err := c.listReplies(ctx, node.ID, node.Replies.PageInfo.EndCursor)
+				if err != nil {
+					return nil, err
+				}
+				comments = append(comments, replies...)
+			}
+		}
+		pageInfo := result.Node.Comments.PageInfo
+		if !pageInfo.HasNextPage {
+			return comments, nil
+		}
+		after = &pageInfo.EndCursor
+	}
+}
+
+// discussionReplies is a page of the replies to a discussion comment.
+type discussionReplies struct {
+	PageInfo struct {
+		HasNextPage bool   `json:"hasNextPage"`
+		EndCursor   string `json:"endCursor"`
+	} `json:"pageInfo"`
+	Nodes []discussionComment `json:"nodes"`
+}
+
+// listReplies lists the replies to a discussion comment that come after the
+// first page, which is fetched along with the comment.
+func (c *discussionChannel) listReplies(ctx context.Context, commentID, after string) ([]discussionComment, error) {
+	const query = `query($id: ID!, $after: String) {
+  node(id: $id) {
+    ... on DiscussionComment {
+      replies(first: 100, after: $after) {
+        pageInfo { hasNextPage endCursor }
+        nodes {
+          databaseId
+          body
+          createdAt
+          lastEditedAt
+          author { login }
+        }
+      }
+    }
+  }
+}`
+	var replies []discussionComment
+	for {
+		var result struct {
+			Node struct {
+				Replies discussionReplies `json:"replies"`
+			} `json:"node"`
+		}
+		err := doGraphQL(ctx, c.client, query, map[string]interface{}{
+			"id":    commentID,
+			"after": after,
+		}, &result)
+		if err != nil {
+			return nil, err
+		}
+
+		replies = append(replies, result.Node.Replies.Nodes...)
+		pageInfo := result.Node.Replies.PageInfo
+		if !pageInfo.HasNextPage {
+			return replies, nil
+		}
+		after = pageInfo.EndCursor
+	}
+}
+
+// issueCommentsFromDiscussion flattens discussion comments and their replies
+// into issue comments, in the order they were posted.
+func issueCommentsFromDiscussion(discussionComments []discussionComment) []*github.IssueComment {
+	comments := make([]*github.IssueComment, 0, len(discussionComments))
+	for _, dc := range discussionComments {
+		createdAt := dc.CreatedAt
+		updatedAt := dc.CreatedAt
+		if dc.LastEditedAt != nil {
+			updatedAt = *dc.LastEditedAt
+		}
+		comments = append(comments, &github.IssueComment{
+			ID:        github.Int64(dc.DatabaseID),
+			Body:      github.String(dc.Body),
+			User:      &github.User{Login: github.String(dc.Author.Login)},
+			CreatedAt: &createdAt,
+			UpdatedAt: &updatedAt,
+		})
+	}
+	sort.SliceStable(comments, func(i, j int) bool {
+		return comments[i].GetCreatedAt().Before(comments[j].GetCreatedAt())
+	})
+	return comments
+}
+
+func (c *discussionChannel) Review(ctx context.Context, decision approval.Decision) (approval.Decision, error) {
+	return decision, nil
+}
+
+func (c *discussionChannel) Finish(ctx context.Context, decision approval.Decision) error {
+	var body string
+	if decision.Status == approval.StatusApproved {
+		body = fmt.Sprintf("The required number of approvals (%d) has been met; continuing workflow and locking this discussion.", c.apprv.minimumApprovals)
+	} else {
+		body = fmt.Sprintf("Request denied. Locking discussion %s", denialSuffix(c.apprv.failOnDenial))
+	}
+	return c.close(ctx, body)
+}
+
+func (c *discussionChannel) Cancel(ctx context.Context) error {
+	body := "Workflow cancelled, locking discussion."
+	fmt.Fprintln(c.apprv.log, body)
+	return c.close(ctx, body)
+}
+
+// close posts the final comment, marks it as the answer if the category is
+// answerable, and locks the discussion.
+func (c *discussionChannel) close(ctx context.Context, body string) error {
+	commentID, err := c.comment(ctx, body)
+	if err != nil {
+		return fmt.Errorf("error commenting on discussion: %w", err)
+	}
+
+	if c.answerable {
+		const mutation = `mutation($id: ID!) {
+  markDiscussionCommentAsAnswer(input: {id: $id}) { clientMutationId }
+}`
+		if err := doGraphQL(ctx, c.client, mutation, map[string]interface{}{"id": commentID}, nil); err != nil {
+			return fmt.Errorf("error marking discussion answered: %w", err)
+		}
+	}
+
+	const mutation = `mutation($id: ID!) {
+  lockLockable(input: {lockableId: $id, lockReason: RESOLVED}) { clientMutationId }
+}`
+	if err := doGraphQL(ctx, c.client, mutation, map[string]interface{}{"id": c.discussionID}, nil); err != nil {
+		return fmt.Errorf("error locking discussion: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v43/github"
+	"github.com/trstringer/manual-approval/pkg/approval"
+)
+
+func TestApprovalFromDiscussionComments(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	comment := func(id int64, login, body string, offset time.Duration) discussionComment {
+		dc := discussionComment{DatabaseID: id, Body: body, CreatedAt: start.Add(offset)}
+		dc.Author.Login = login
+		return dc
+	}
+	edited := func(dc discussionComment) discussionComment {
+		editedAt := dc.CreatedAt.Add(time.Hour)
+		dc.LastEditedAt = &editedAt
+		return dc
+	}
+
+	testCases := []struct {
+		name           string
+		comments       []discussionComment
+		policy         editedCommentPolicy
+		expectedStatus approval.Status
+	}{
+		{
+			name: "approved_in_reply",
+			comments: []discussionComment{
+				comment(1, "login1", "approved", 0),
+				comment(3, "login2", "approved", 2*time.Minute),
+			},
+			expectedStatus: approval.StatusApproved,
+		},
+		{
+			name: "earlier_reply_denial_wins_over_later_top_level_approval",
+			comments: []discussionComment{
+				comment(1, "login1", "approved", 0),
+				comment(3, "login2", "approved", 3*time.Minute),
+				comment(2, "login2", "denied", time.Minute),
+			},
+			expectedStatus: approval.StatusDenied,
+		},
+		{
+			name: "edited_reply_ignored",
+			comments: []discussionComment{
+				comment(1, "login1", "approved", 0),
+				edited(comment(2, "login2", "approved", time.Minute)),
+			},
+			policy:         editedCommentPolicyIgnore,
+			expectedStatus: approval.StatusPending,
+		},
+		{
+			name: "edited_reply_reevaluated",
+			comments: []discussionComment{
+				comment(1, "login1", "approved", 0),
+				edited(comment(2, "login2", "approved", time.Minute)),
+			},
+			policy:         editedCommentPolicyReevaluate,
+			expectedStatus: approval.StatusApproved,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			comments, _ := filterComments(issueCommentsFromDiscussion(testCase.comments), testCase.policy)
+			evaluator, err := approval.NewEvaluator(approval.Policy{
+				Approvers:        []string{"login1", "login2"},
+				MinimumApprovals: 2,
+			})
+			if err != nil {
+				t.Fatalf("error creating evaluator: %v", err)
+			}
+			actual := evaluator.Evaluate(evaluator.VotesFromComments(approvalComments(comments)))
+			if actual.Status != testCase.expectedStatus {
+				t.Fatalf("actual %s, expected %s", actual.Status, testCase.expectedStatus)
+			}
+		})
+	}
+}
+
+func TestMatchDiscussionCategory(t *testing.T) {
+	categories := []discussionCategory{
+		{ID: "1", Name: "General", Slug: "general"},
+		{ID: "2", Name: "Deploy Approvals", Slug: "deploy-approvals"},
+	}
+
+	testCases := []struct {
+		nameOrSlug string
+		expectedID string
+		found      bool
+	}{
+		{nameOrSlug: "Deploy Approvals", expectedID: "2", found: true},
+		{nameOrSlug: "deploy-approvals", expectedID: "2", found: true},
+		{nameOrSlug: " general ", expectedID: "1", found: true},
+		{nameOrSlug: "Announcements", found: false},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.nameOrSlug, func(t *testing.T) {
+			actual, found := matchDiscussionCategory(categories, testCase.nameOrSlug)
+			if found != testCase.found {
+				t.Fatalf("found %t, expected %t", found, testCase.found)
+			}
+			if actual.ID != testCase.expectedID {
+				t.Fatalf("actual %q, expected %q", actual.ID, testCase.expectedID)
+			}
+		})
+	}
+}
+
+func TestListDiscussionCommentsPaginatesReplies(t *testing.T) {
+	page := func(hasNextPage bool, endCursor string, ids ...int64) map[string]interface{} {
+		nodes := []map[string]interface{}{}
+		for _, id := range ids {
+			nodes = append(nodes, map[string]interface{}{"databaseId": id})
+		}
+		return map[string]interface{}{
+			"pageInfo": map[string]interface{}{"hasNextPage": hasNextPage, "endCursor": endCursor},
+			"nodes":    nodes,
+		}
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/graphql", func(w http.ResponseWriter, r *http.Request) {
+		var request graphQLRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("error decoding request: %v", err)
+		}
+		var node map[string]interface{}
+		switch {
+		case !strings.Contains(request.Query, "on DiscussionComment"):
+			comments := page(false, "", 1)
+			firstComment := comments["nodes"].([]map[string]interface{})[0]
+			firstComment["id"] = "comment1"
+			firstComment["replies"] = page(true, "cursor1", 2)
+			node = map[string]interface{}{"comments": comments}
+		case request.Variables["id"] != "comment1":
+			t.Errorf("replies of %v, expected comment1", request.Variables["id"])
+		case request.Variables["after"] == "cursor1":
+			node = map[string]interface{}{"replies": page(true, "cursor2", 3)}
+		default:
+			node = map[string]interface{}{"replies": page(false, "", 4)}
+		}
+		if err := json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"node": node}}); err != nil {
+			t.Errorf("error encoding response: %v", err)
+		}
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	client := github.NewClient(nil)
+	baseURL, err := url.Parse(server.URL + "/")
+	if err != nil {
+		t.Fatalf("error parsing URL: %v", err)
+	}
+	client.BaseURL = baseURL
+
+	channel := &discussionChannel{client: client, discussionID: "discussion1"}
+	comments, err := channel.listComments(context.Background())
+	if err != nil {
+		t.Fatalf("error listing comments: %v", err)
+	}
+	ids := []int64{}
+	for _, comment := range comments {
+		ids = append(ids, comment.DatabaseID)
+	}
+	if expected := []int64{1, 2, 3, 4}; !reflect.DeepEqual(ids, expected) {
+		t.Fatalf("comments %v, expected %v", ids, expected)
+	}
+}
+
+func TestNewDiscussionChannelRejectsIssueOnlyInputs(t *testing.T) {
+	for name, apprv := range issueOnlyInputs() {
+		t.Run(name, func(t *testing.T) {
+			if _, err := newApprovalChannel(approvalTargetDiscussion, apprv, nil); err == nil {
+				t.Fatalf("expected an error")
+			}
+		})
+	}
+}
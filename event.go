@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// eventPullRequest is the part of a pull_request event payload the action
+// needs.
+type eventPullRequest struct {
+	Number  int    `json:"number"`
+	HTMLURL string `json:"html_url"`
+	User    struct {
+		Login string `json:"login"`
+	} `json:"user"`
+}
+
+// readEventPullRequest reads the pull request that triggered the workflow
+// from the event payload at GITHUB_EVENT_PATH.
+func readEventPullRequest() (eventPullRequest, error) {
+	eventPath := os.Getenv(envVarEventPath)
+	if eventPath == "" {
+		return eventPullRequest{}, fmt.Errorf("%s is not set", envVarEventPath)
+	}
+
+	raw, err := os.ReadFile(eventPath)
+	if err != nil {
+		return eventPullRequest{}, fmt.Errorf("error reading event payload: %w", err)
+	}
+
+	var event struct {
+		PullRequest *eventPullRequest `json:"pull_request"`
+	}
+	if err := json.Unmarshal(raw, &event); err != nil {
+		return eventPullRequest{}, fmt.Errorf("error parsing event payload: %w", err)
+	}
+	if event.PullRequest == nil || event.PullRequest.Number == 0 {
+		return eventPullRequest{}, fmt.Errorf("workflow was not triggered by a pull request event")
+	}
+	return *event.PullRequest, nil
+}
+
+// readWorkflowEvent reads the event that triggered the workflow, for policy
+// rules to match. Outside of a workflow, e.g. on the command line, the event
+// is empty.
+func readWorkflowEvent() (workflowEvent, error) {
+	event := workflowEvent{
+		Ref:  os.Getenv(envVarRef),
+		Name: os.Getenv(envVarEventName),
+	}
+	eventPath := os.Getenv(envVarEventPath)
+	if eventPath == "" {
+		return event, nil
+	}
+
+	raw, err := os.ReadFile(eventPath)
+	if err != nil {
+		return event, fmt.Errorf("error reading event payload: %w", err)
+	}
+	if err := json.Unmarshal(raw, &event.Payload); err != nil {
+		return event, fmt.Errorf("error parsing event payload: %w", err)
+	}
+	return event, nil
+}
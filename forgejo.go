@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v43/github"
+
+	"github.com/trstringer/manual-approval/pkg/approval"
+)
+
+// forgejoPageSize is the page size used for paginated Forgejo endpoints. It
+// is within the default MAX_RESPONSE_ITEMS of both Forgejo and Gitea.
+const forgejoPageSize = 50
+
+// The Forgejo/Gitea /api/v1 response shapes differ from GitHub's in ways
+// that break go-github's types, e.g. an issue's "repository.owner" is a
+// plain string. The backend therefore decodes into these minimal structs.
+
+type forgejoUser struct {
+	Login string `json:"login"`
+}
+
+type forgejoIssue struct {
+	Number  int         `json:"number"`
+	HTMLURL string      `json:"html_url"`
+	State   string      `json:"state"`
+	User    forgejoUser `json:"user"`
+}
+
+type forgejoComment struct {
+	ID        int64       `json:"id"`
+	Body      string      `json:"body"`
+	User      forgejoUser `json:"user"`
+	CreatedAt time.Time   `json:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at"`
+}
+
+type forgejoReaction struct {
+	User      forgejoUser `json:"user"`
+	Content   string      `json:"content"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+type forgejoLabel struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+type forgejoTeam struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+// forgejoRunURL builds the link to a workflow run. Forgejo and Gitea address
+// runs by their number within the repository, not by the run ID.
+func forgejoRunURL(serverURL, repoFullName, runNumber string) string {
+	return fmt.Sprintf("%s/%s/actions/runs/%s", strings.TrimRight(serverURL, "/"), repoFullName, runNumber)
+}
+
+// forgejoGet sends a GET request to path, relative to the API root, and
+// decodes the response into result.
+func forgejoGet(ctx context.Context, client *github.Client, path string, result interface{}) error {
+	return forgejoSend(ctx, client, "GET", path, nil, result)
+}
+
+// forgejoSend sends a request with a JSON body to path, relative to the API
+// root, and decodes the response into result if it isn't nil.
+func forgejoSend(ctx context.Context, client *github.Client, method, path string, body, result interface{}) error {
+	req, err := client.NewRequest(method, path, body)
+	if err != nil {
+		return err
+	}
+	_, err = client.Do(ctx, req, result)
+	return err
+}
+
+// forgejoTeamMembers expands a team of the org into its members' logins. It
+// returns nil if userOrTeam isn't a team of the org.
+func forgejoTeamMembers(ctx context.Context, log io.Writer, client *github.Client, org, userOrTeam, workflowInitiator string, shouldExcludeWorkflowInitiator bool) []string {
+	fmt.Fprintf(log, "Attempting to expand user %s/%s as a group (may not succeed)\n", org, userOrTeam)
+
+	var search struct {
+		Data []forgejoTeam `json:"data"`
+		OK   bool          `json:"ok"`
+	}
+	err := forgejoGet(ctx, client, fmt.Sprintf("orgs/%s/teams/search?q=%s", url.PathEscape(org), url.QueryEscape(userOrTeam)), &search)
+	if err != nil {
+		fmt.Fprintf(log, "%v\n", err)
+		return nil
+	}
+
+	// The search matches substrings, so look for the team by its full name.
+	teamID := int64(0)
+	for _, team := range search.Data {
+		if strings.EqualFold(team.Name, userOrTeam) {
+			teamID = team.ID
+		}
+	}
+	if teamID == 0 {
+		return nil
+	}
+
+	userNames := []string{}
+	for page := 1; ; page++ {
+		var members []forgejoUser
+		err := forgejoGet(ctx, client, fmt.Sprintf("teams/%d/members?page=%d&limit=%d", teamID, page, forgejoPageSize), &members)
+		if err != nil {
+			fmt.Fprintf(log, "%v\n", err)
+			return nil
+		}
+		for _, member := range members {
+			if strings.EqualFold(member.Login, workflowInitiator) && shouldExcludeWorkflowInitiator {
+				fmt.Fprintf(log, "Not adding user '%s' from group '%s' as an approver as they are the workflow initiator\n", member.Login, userOrTeam)
+			} else {
+				userNames = append(userNames, member.Login)
+			}
+		}
+		if len(members) < forgejoPageSize {
+			return userNames
+		}
+	}
+}
+
+// forgejoIssues is the issue backend of Forgejo and Gitea.
+type forgejoIssues struct {
+	client *github.Client
+	log    io.Writer
+}
+
+func newForgejoChannel(target approvalTarget, apprv *approvalEnvironment, client *github.Client) (approval.Channel, error) {
+	if target != approvalTargetIssue {
+		return nil, fmt.Errorf("target %q is not supported with the %s backend", target, backendForgejo)
+	}
+	if apprv.existingIssueNumber > 0 {
+		return nil, fmt.Errorf("issue-number is not supported with the %s backend", backendForgejo)
+	}
+	if err := checkIssueOnlyInputs(apprv, fmt.Sprintf("the %s backend", backendForgejo)); err != nil {
+		return nil, err
+	}
+	return &issueChannel{
+		apprv:   apprv,
+		backend: forgejoIssues{client: client, log: apprv.log},
+	}, nil
+}
+
+func forgejoIssuePath(owner, repo string, number int, suffix string) string {
+	return fmt.Sprintf("repos/%s/%s/issues/%d%s", owner, repo, number, suffix)
+}
+
+func (b forgejoIssues) CreateIssue(ctx context.Context, owner, repo string, request *github.IssueRequest) (*github.Issue, error) {
+	labelIDs, err := b.labelIDs(ctx, owner, repo, request.GetLabels())
+	if err != nil {
+		return nil, fmt.Errorf("error getting labels: %w", err)
+	}
+
+	var created forgejoIssue
+	err = forgejoSend(ctx, b.client, "POST", fmt.Sprintf("repos/%s/%s/issues", owner, repo), map[string]interface{}{
+		"title":     request.GetTitle(),
+		"body":      request.GetBody(),
+		"assignees": request.GetAssignees(),
+		"labels":    labelIDs,
+	}, &created)
+	if err != nil {
+		return nil, err
+	}
+	return created.issue(), nil
+}
+
+// labelIDs resolves label names to label IDs, as Forgejo's create issue
+// endpoint only takes IDs. Labels that don't exist are skipped.
+func (b forgejoIssues) labelIDs(ctx context.Context, owner, repo string, names []string) ([]int64, error) {
+	ids := []int64{}
+	if len(names) == 0 {
+		return ids, nil
+	}
+
+	byName := map[string]int64{}
+	for page := 1; ; page++ {
+		var labels []forgejoLabel
+		err := forgejoGet(ctx, b.client, fmt.Sprintf("repos/%s/%s/labels?page=%d&limit=%d", owner, repo, page, forgejoPageSize), &labels)
+		if err != nil {
+			return nil, err
+		}
+		for _, label := range labels {
+			byName[strings.ToLower(label.Name)] = label.ID
+		}
+		if len(labels) < forgejoPageSize {
+			break
+		}
+	}
+
+	for _, name := range names {
+		id, ok := byName[strings.ToLower(name)]
+		if !ok {
+			fmt.Fprintf(b.log, "Label %s not found, not adding it to the issue\n", name)
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (b forgejoIssues) GetIssue(ctx context.Context, owner, repo string, number int) (*github.Issue, error) {
+	var issue forgejoIssue
+	if err := forgejoGet(ctx, b.client, forgejoIssuePath(owner, repo, number, ""), &issue); err != nil {
+		return nil, err
+	}
+	return issue.issue(), nil
+}
+
+func (b forgejoIssues) ListComments(ctx context.Context, owner, repo string, number int) ([]*github.IssueComment, error) {
+	var comments []forgejoComment
+	if err := forgejoGet(ctx, b.client, forgejoIssuePath(owner, repo, number, "/comments"), &comments); err != nil {
+		return nil, err
+	}
+	return issueCommentsFromForgejo(comments), nil
+}
+
+func (b forgejoIssues) PostComment(ctx context.Context, owner, repo string, number int, body string) (*github.IssueComment, error) {
+	var comment forgejoComment
+	if err := forgejoSend(ctx, b.client, "POST", forgejoIssuePath(owner, repo, number, "/comments"), map[string]string{"body": body}, &comment); err != nil {
+		return nil, err
+	}
+	return comment.comment(), nil
+}
+
+func (b forgejoIssues) ListReactions(ctx context.Context, owner, repo string, number int) ([]issueReaction, error) {
+	var reactions []issueReaction
+	for page := 1; ; page++ {
+		var forgejoReactions []forgejoReaction
+		if err := forgejoGet(ctx, b.client, forgejoIssuePath(owner, repo, number, fmt.Sprintf("/reactions?page=%d&limit=%d", page, forgejoPageSize)), &forgejoReactions); err != nil {
+			return nil, err
+		}
+		for _, fr := range forgejoReactions {
+			reaction := issueReaction{Content: fr.Content, CreatedAt: fr.CreatedAt}
+			reaction.User.Login = fr.User.Login
+			reactions = append(reactions, reaction)
+		}
+		if len(forgejoReactions) < forgejoPageSize {
+			return reactions, nil
+		}
+	}
+}
+
+func (b forgejoIssues) Close(ctx context.Context, owner, repo string, number int, approved bool) error {
+	return forgejoSend(ctx, b.client, "PATCH", forgejoIssuePath(owner, repo, number, ""), map[string]string{"state": "closed"}, nil)
+}
+
+func (b forgejoIssues) Reopen(ctx context.Context, owner, repo string, number int) error {
+	return forgejoSend(ctx, b.client, "PATCH", forgejoIssuePath(owner, repo, number, ""), map[string]string{"state": "open"}, nil)
+}
+
+// issue converts a Forgejo issue to an issue.
+func (i forgejoIssue) issue() *github.Issue {
+	return &github.Issue{
+		Number:  github.Int(i.Number),
+		HTMLURL: github.String(i.HTMLURL),
+		State:   github.String(i.State),
+		User:    &github.User{Login: github.String(i.User.Login)},
+	}
+}
+
+// issueCommentsFromForgejo converts Forgejo comments to issue comments.
+func issueCommentsFromForgejo(forgejoComments []forgejoComment) []*github.IssueComment {
+	comments := make([]*github.IssueComment, 0, len(forgejoComments))
+	for _, fc := range forgejoComments {
+		comments = append(comments, fc.comment())
+	}
+	return comments
+}
+
+func (fc forgejoComment) comment() *github.IssueComment {
+	return &github.IssueComment{
+		ID:        github.Int64(fc.ID),
+		Body:      github.String(fc.Body),
+		User:      &github.User{Login: github.String(fc.User.Login)},
+		CreatedAt: &fc.CreatedAt,
+		UpdatedAt: &fc.UpdatedAt,
+	}
+}
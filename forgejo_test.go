@@ -0,0 +1,306 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v43/github"
+
+	"github.com/trstringer/manual-approval/pkg/approval"
+)
+
+// The fixtures in testdata/forgejo mirror Forgejo /api/v1 responses,
+// including fields the backend doesn't use, so that the backend's structs
+// are checked against the real shapes.
+
+func readForgejoFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	raw, err := os.ReadFile(filepath.Join("testdata", "forgejo", name))
+	if err != nil {
+		t.Fatalf("error reading fixture: %v", err)
+	}
+	return raw
+}
+
+func TestForgejoFixtures(t *testing.T) {
+	t.Run("create_issue", func(t *testing.T) {
+		raw := readForgejoFixture(t, "create_issue.json")
+		var issue forgejoIssue
+		if err := json.Unmarshal(raw, &issue); err != nil {
+			t.Fatalf("error decoding issue: %v", err)
+		}
+		expected := forgejoIssue{Number: 7, HTMLURL: "https://forgejo.example.com/owner/repo/issues/7", State: "open", User: forgejoUser{Login: "ci-bot"}}
+		if issue != expected {
+			t.Fatalf("actual %+v, expected %+v", issue, expected)
+		}
+
+		// This is why the backend doesn't use go-github's types.
+		if err := json.Unmarshal(raw, &github.Issue{}); err == nil {
+			t.Fatalf("expected go-github to fail decoding a Forgejo issue")
+		}
+	})
+
+	t.Run("comments", func(t *testing.T) {
+		var comments []forgejoComment
+		if err := json.Unmarshal(readForgejoFixture(t, "comments.json"), &comments); err != nil {
+			t.Fatalf("error decoding comments: %v", err)
+		}
+		issueComments := issueCommentsFromForgejo(comments)
+		if len(issueComments) != 2 {
+			t.Fatalf("got %d comments, expected 2", len(issueComments))
+		}
+		first := issueComments[0]
+		if first.GetID() != 301 || first.GetUser().GetLogin() != "login1" || first.GetBody() != "approved" {
+			t.Fatalf("unexpected first comment %v", first)
+		}
+		if isEditedComment(first) || !isEditedComment(issueComments[1]) {
+			t.Fatalf("expected only the second comment to be edited")
+		}
+	})
+
+	t.Run("reactions", func(t *testing.T) {
+		var reactions []forgejoReaction
+		if err := json.Unmarshal(readForgejoFixture(t, "reactions.json"), &reactions); err != nil {
+			t.Fatalf("error decoding reactions: %v", err)
+		}
+		expected := []forgejoReaction{
+			{User: forgejoUser{Login: "login2"}, Content: "+1", CreatedAt: time.Date(2024, 5, 1, 12, 3, 0, 0, time.UTC)},
+			{User: forgejoUser{Login: "ci-bot"}, Content: "-1", CreatedAt: time.Date(2024, 5, 1, 12, 4, 0, 0, time.UTC)},
+		}
+		if !reflect.DeepEqual(reactions, expected) {
+			t.Fatalf("actual %+v, expected %+v", reactions, expected)
+		}
+	})
+
+	t.Run("labels", func(t *testing.T) {
+		var labels []forgejoLabel
+		if err := json.Unmarshal(readForgejoFixture(t, "labels.json"), &labels); err != nil {
+			t.Fatalf("error decoding labels: %v", err)
+		}
+		expected := []forgejoLabel{{ID: 3, Name: "deploy"}, {ID: 4, Name: "Production"}}
+		if !reflect.DeepEqual(labels, expected) {
+			t.Fatalf("actual %+v, expected %+v", labels, expected)
+		}
+	})
+}
+
+// fakeForgejo serves the fixtures for the endpoints used by the Forgejo
+// backend and records the requests that change state.
+type fakeForgejo struct {
+	fakeAPI
+
+	createdWith map[string]interface{}
+	comments    []string
+	state       string
+}
+
+func (f *fakeForgejo) route(w http.ResponseWriter, r *http.Request) bool {
+	fixtures := map[string]string{
+		"GET /api/v1/repos/owner/repo/labels":             "labels.json",
+		"GET /api/v1/repos/owner/repo/issues/7/comments":  "comments.json",
+		"GET /api/v1/repos/owner/repo/issues/7/reactions": "reactions.json",
+		"GET /api/v1/orgs/owner/teams/search":             "teams_search.json",
+		"GET /api/v1/teams/12/members":                    "team_members.json",
+	}
+
+	route := r.Method + " " + r.URL.Path
+	switch route {
+	case "POST /api/v1/repos/owner/repo/issues":
+		f.readJSON(r, &f.createdWith)
+		f.state = "open"
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write(readForgejoFixture(f.t, "create_issue.json"))
+	case "POST /api/v1/repos/owner/repo/issues/7/comments":
+		var comment struct {
+			Body string `json:"body"`
+		}
+		f.readJSON(r, &comment)
+		f.comments = append(f.comments, comment.Body)
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"id": 400}`))
+	case "PATCH /api/v1/repos/owner/repo/issues/7":
+		var update struct {
+			State string `json:"state"`
+		}
+		f.readJSON(r, &update)
+		f.state = update.State
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write(readForgejoFixture(f.t, "create_issue.json"))
+	default:
+		fixture, ok := fixtures[route]
+		if !ok {
+			return false
+		}
+		// Every list fits on the first page.
+		if page := r.URL.Query().Get("page"); page != "" && page != "1" {
+			_, _ = w.Write([]byte("[]"))
+			break
+		}
+		_, _ = w.Write(readForgejoFixture(f.t, fixture))
+	}
+	return true
+}
+
+func newTestForgejoClient(t *testing.T, fake *fakeForgejo) *github.Client {
+	serverURL := fake.serve(t, nil, fake.route)
+
+	client := github.NewClient(nil)
+	baseURL, err := url.Parse(serverURL + "/api/v1/")
+	if err != nil {
+		t.Fatalf("error parsing server URL: %v", err)
+	}
+	client.BaseURL = baseURL
+	return client
+}
+
+func TestForgejoTeamMembers(t *testing.T) {
+	client := newTestForgejoClient(t, &fakeForgejo{})
+
+	testCases := []struct {
+		name      string
+		team      string
+		initiator string
+		exclude   bool
+		expected  []string
+	}{
+		{
+			name:     "exact_team_name",
+			team:     "sre",
+			expected: []string{"login1", "login2"},
+		},
+		{
+			name:      "exclude_initiator",
+			team:      "SRE",
+			initiator: "login1",
+			exclude:   true,
+			expected:  []string{"login2"},
+		},
+		{
+			name:     "partial_match_is_not_a_team",
+			team:     "sre-on",
+			expected: nil,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			actual := forgejoTeamMembers(context.Background(), io.Discard, client, "owner", testCase.team, testCase.initiator, testCase.exclude)
+			if !reflect.DeepEqual(actual, testCase.expected) {
+				t.Fatalf("actual %v, expected %v", actual, testCase.expected)
+			}
+		})
+	}
+}
+
+func TestForgejoRunApproval(t *testing.T) {
+	testCases := []struct {
+		name             string
+		policy           editedCommentPolicy
+		allowReactions   bool
+		expectedExitCode int
+		expectedOutputs  []string
+	}{
+		{
+			name:             "denied_by_comment",
+			policy:           editedCommentPolicyReevaluate,
+			expectedExitCode: 1,
+			expectedOutputs:  []string{"approval-status=denied"},
+		},
+		{
+			name:             "edited_denial_ignored_and_approved_by_reaction",
+			policy:           editedCommentPolicyIgnore,
+			allowReactions:   true,
+			expectedExitCode: 0,
+			expectedOutputs:  []string{"approval-status=approved", `"ignoredCommentIds":[302]`},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			fake := &fakeForgejo{}
+			client := newTestForgejoClient(t, fake)
+
+			var reactionMapping map[string]approval.Action
+			if testCase.allowReactions {
+				var err error
+				reactionMapping, err = parseReactionMapping(defaultApprovalReactions, defaultDenialReactions)
+				if err != nil {
+					t.Fatalf("error parsing reactions: %v", err)
+				}
+			}
+			apprv, err := newApprovalEnvironment(approvalOptions{
+				repoFullName:        "owner/repo",
+				repoOwner:           "owner",
+				runID:               1234,
+				issueApprovers:      []string{"login1", "login2"},
+				minimumApprovals:    2,
+				targetRepoOwner:     "owner",
+				targetRepoName:      "repo",
+				failOnDenial:        true,
+				issueLabels:         []string{"production", "missing"},
+				editedCommentPolicy: testCase.policy,
+				commentSyntax:       approval.CommentSyntaxKeywords,
+				reactionMapping:     reactionMapping,
+				target:              approvalTargetIssue,
+				workflowRunURL:      forgejoRunURL("https://forgejo.example.com/", "owner/repo", "12"),
+			})
+			if err != nil {
+				t.Fatalf("error creating approval environment: %v", err)
+			}
+			requestChannel, err := newForgejoChannel(approvalTargetIssue, apprv, client)
+			if err != nil {
+				t.Fatalf("error creating channel: %v", err)
+			}
+
+			expectedOutputs := append([]string{"issue-number=7", "issue-url=https://forgejo.example.com/owner/repo/issues/7"}, testCase.expectedOutputs...)
+			runTestApproval(t, apprv, requestChannel, testCase.expectedExitCode, expectedOutputs...)
+
+			fake.mu.Lock()
+			defer fake.mu.Unlock()
+			if fake.state != "closed" {
+				t.Fatalf("issue state %q, expected closed", fake.state)
+			}
+			if !reflect.DeepEqual(fake.createdWith["labels"], []interface{}{float64(4)}) {
+				t.Fatalf("labels %v, expected [4]", fake.createdWith["labels"])
+			}
+			if !reflect.DeepEqual(fake.createdWith["assignees"], []interface{}{"login1", "login2"}) {
+				t.Fatalf("assignees %v, expected [login1 login2]", fake.createdWith["assignees"])
+			}
+			body, _ := fake.createdWith["body"].(string)
+			if !strings.Contains(body, "https://forgejo.example.com/owner/repo/actions/runs/12") {
+				t.Fatalf("body %q doesn't link to the run", body)
+			}
+		})
+	}
+}
+
+func TestNewForgejoChannelRejectsIssueOnlyInputs(t *testing.T) {
+	apprv, err := newApprovalEnvironment(approvalOptions{
+		repoFullName:        "owner/repo",
+		repoOwner:           "owner",
+		runID:               1234,
+		issueApprovers:      []string{"login1"},
+		targetRepoOwner:     "owner",
+		targetRepoName:      "repo",
+		failOnDenial:        true,
+		editedCommentPolicy: editedCommentPolicyReevaluate,
+		commentSyntax:       approval.CommentSyntaxKeywords,
+		closeIssueAsVote:    true,
+		target:              approvalTargetIssue,
+	})
+	if err != nil {
+		t.Fatalf("error creating approval environment: %v", err)
+	}
+	if _, err := newForgejoChannel(approvalTargetIssue, apprv, nil); err == nil {
+		t.Fatalf("expected an error for close-issue-as-vote")
+	}
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v43/github"
+
+	"github.com/trstringer/manual-approval/pkg/approval"
+)
+
+const defaultGitLabAPIURL string = "https://gitlab.com/api/v4"
+
+// gitLabClient is a minimal client for the GitLab v4 REST API.
+type gitLabClient struct {
+	restClient
+}
+
+// newGitLabClient connects to the API at CI_API_V4_URL. A personal or
+// project access token passed as the secret input is preferred over
+// CI_JOB_TOKEN, which can't create issues on most GitLab versions.
+func newGitLabClient(in inputs) *gitLabClient {
+	baseURL := in.get(envVarGitLabAPIURL)
+	if baseURL == "" {
+		baseURL = defaultGitLabAPIURL
+	}
+	tokenHeader, token := "PRIVATE-TOKEN", in.get(envVarToken)
+	if token == "" {
+		tokenHeader, token = "JOB-TOKEN", in.get(envVarGitLabJobToken)
+	}
+	return &gitLabClient{
+		restClient: newRESTClient("gitlab", baseURL, func(req *http.Request) {
+			req.Header.Set(tokenHeader, token)
+		}),
+	}
+}
+
+func validateGitLabInput(in inputs) error {
+	missingEnvVars := []string{}
+	for _, envVar := range []string{envVarGitLabProjectID, envVarGitLabProjectPath, envVarGitLabPipelineID} {
+		if in.get(envVar) == "" {
+			missingEnvVars = append(missingEnvVars, envVar)
+		}
+	}
+	if in.get(envVarToken) == "" && in.get(envVarGitLabJobToken) == "" {
+		missingEnvVars = append(missingEnvVars, envVarToken)
+	}
+
+	if len(missingEnvVars) > 0 {
+		return fmt.Errorf("missing env vars: %v", missingEnvVars)
+	}
+	return nil
+}
+
+// gitLabListAll fetches every page of a list endpoint, following the
+// X-Next-Page header.
+func gitLabListAll[T any](ctx context.Context, c *gitLabClient, path string) ([]T, error) {
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+
+	var all []T
+	page := "1"
+	for page != "" {
+		var items []T
+		resp, err := c.send(ctx, "GET", fmt.Sprintf("%s%sper_page=100&page=%s", path, separator, page), "", nil, &items)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, items...)
+		page = resp.Header.Get("X-Next-Page")
+	}
+	return all, nil
+}
+
+type gitLabUser struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+}
+
+// groupMembers expands a GitLab group, given by its full path, into the
+// usernames of its members, including those inherited from parent groups.
+// It returns nil if userOrGroup isn't a group.
+func (c *gitLabClient) groupMembers(ctx context.Context, log io.Writer, userOrGroup, workflowInitiator string, shouldExcludeWorkflowInitiator bool) []string {
+	fmt.Fprintf(log, "Attempting to expand user %s as a group (may not succeed)\n", userOrGroup)
+
+	members, err := gitLabListAll[gitLabUser](ctx, c, fmt.Sprintf("groups/%s/members/all", url.PathEscape(userOrGroup)))
+	if err != nil {
+		fmt.Fprintf(log, "%v\n", err)
+		return nil
+	}
+
+	userNames := make([]string, 0, len(members))
+	for _, member := range members {
+		if strings.EqualFold(member.Username, workflowInitiator) && shouldExcludeWorkflowInitiator {
+			fmt.Fprintf(log, "Not adding user '%s' from group '%s' as an approver as they are the workflow initiator\n", member.Username, userOrGroup)
+		} else {
+			userNames = append(userNames, member.Username)
+		}
+	}
+	return userNames
+}
+
+// gitLabAwardEmojiReactions maps GitLab award emoji names to the reaction
+// names used by the approval-reactions and denial-reactions inputs.
+var gitLabAwardEmojiReactions = map[string]string{
+	"thumbsup":   "+1",
+	"thumbsdown": "-1",
+	"laughing":   "laugh",
+	"confused":   "confused",
+	"heart":      "heart",
+	"tada":       "hooray",
+	"rocket":     "rocket",
+	"eyes":       "eyes",
+}
+
+type gitLabNote struct {
+	ID        int64     `json:"id"`
+	Body      string    `json:"body"`
+	System    bool      `json:"system"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Author    struct {
+		Username string `json:"username"`
+	} `json:"author"`
+}
+
+type gitLabIssue struct {
+	IID    int    `json:"iid"`
+	WebURL string `json:"web_url"`
+	State  string `json:"state"`
+	Author struct {
+		Username string `json:"username"`
+	} `json:"author"`
+}
+
+// issue converts a GitLab issue to an issue. GitLab's "opened" state is
+// GitHub's "open".
+func (i gitLabIssue) issue() *github.Issue {
+	state := i.State
+	if state == "opened" {
+		state = "open"
+	}
+	return &github.Issue{
+		Number:  github.Int(i.IID),
+		HTMLURL: github.String(i.WebURL),
+		State:   github.String(state),
+		User:    &github.User{Login: github.String(i.Author.Username)},
+	}
+}
+
+type gitLabAwardEmoji struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	User      struct {
+		Username string `json:"username"`
+	} `json:"user"`
+}
+
+// gitLabIssues is the issue backend of GitLab. Issues are made in project,
+// a path segment, and addressed by their IID. Votes are read from the notes
+// and award emoji of the issue.
+type gitLabIssues struct {
+	client  *gitLabClient
+	project string
+	log     io.Writer
+}
+
+func newGitLabChannel(target approvalTarget, apprv *approvalEnvironment, client *gitLabClient, project string) (approval.Channel, error) {
+	if target != approvalTargetIssue {
+		return nil, fmt.Errorf("target %q is not supported with the %s backend", target, backendGitLab)
+	}
+	if apprv.existingIssueNumber > 0 {
+		return nil, fmt.Errorf("issue-number is not supported with the %s backend", backendGitLab)
+	}
+	if err := checkIssueOnlyInputs(apprv, fmt.Sprintf("the %s backend", backendGitLab)); err != nil {
+		return nil, err
+	}
+	return &issueChannel{
+		apprv:   apprv,
+		backend: gitLabIssues{client: client, project: project, log: apprv.log},
+	}, nil
+}
+
+// gitLabProject returns the project to create the approval issue in, as a
+// path segment: the target repository if set, else the project running the
+// pipeline.
+func gitLabProject(projectID, targetRepoOwner, targetRepoName string) string {
+	if targetRepoOwner != "" && targetRepoName != "" {
+		return url.PathEscape(targetRepoOwner + "/" + targetRepoName)
+	}
+	return url.PathEscape(projectID)
+}
+
+func (b gitLabIssues) issuePath(number int, suffix string) string {
+	return fmt.Sprintf("projects/%s/issues/%d%s", b.project, number, suffix)
+}
+
+func (b gitLabIssues) CreateIssue(ctx context.Context, owner, repo string, request *github.IssueRequest) (*github.Issue, error) {
+	assigneeIDs := make([]int64, 0, len(request.GetAssignees()))
+	for _, approver := range request.GetAssignees() {
+		var users []gitLabUser
+		if err := b.client.do(ctx, "GET", "users?username="+url.QueryEscape(approver), nil, &users); err != nil {
+			return nil, fmt.Errorf("error looking up user %s: %w", approver, err)
+		}
+		if len(users) == 0 {
+			fmt.Fprintf(b.log, "User %s not found, not assigning the issue to them\n", approver)
+			continue
+		}
+		assigneeIDs = append(assigneeIDs, users[0].ID)
+	}
+
+	var created gitLabIssue
+	err := b.client.do(ctx, "POST", fmt.Sprintf("projects/%s/issues", b.project), map[string]interface{}{
+		"title":        request.GetTitle(),
+		"description":  request.GetBody(),
+		"assignee_ids": assigneeIDs,
+		"labels":       strings.Join(request.GetLabels(), ","),
+	}, &created)
+	if err != nil {
+		return nil, err
+	}
+	return created.issue(), nil
+}
+
+func (b gitLabIssues) GetIssue(ctx context.Context, owner, repo string, number int) (*github.Issue, error) {
+	var issue gitLabIssue
+	if err := b.client.do(ctx, "GET", b.issuePath(number, ""), nil, &issue); err != nil {
+		return nil, err
+	}
+	return issue.issue(), nil
+}
+
+func (b gitLabIssues) ListComments(ctx context.Context, owner, repo string, number int) ([]*github.IssueComment, error) {
+	notes, err := gitLabListAll[gitLabNote](ctx, b.client, b.issuePath(number, "/notes?sort=asc&order_by=created_at"))
+	if err != nil {
+		return nil, err
+	}
+	return issueCommentsFromNotes(notes), nil
+}
+
+func (b gitLabIssues) PostComment(ctx context.Context, owner, repo string, number int, body string) (*github.IssueComment, error) {
+	var note gitLabNote
+	if err := b.client.do(ctx, "POST", b.issuePath(number, "/notes"), map[string]string{"body": body}, &note); err != nil {
+		return nil, err
+	}
+	return note.comment(), nil
+}
+
+func (b gitLabIssues) ListReactions(ctx context.Context, owner, repo string, number int) ([]issueReaction, error) {
+	awards, err := gitLabListAll[gitLabAwardEmoji](ctx, b.client, b.issuePath(number, "/award_emoji"))
+	if err != nil {
+		return nil, err
+	}
+	return reactionsFromAwardEmoji(awards), nil
+}
+
+func (b gitLabIssues) Close(ctx context.Context, owner, repo string, number int, approved bool) error {
+	return b.client.do(ctx, "PUT", b.issuePath(number, ""), map[string]string{"state_event": "close"}, nil)
+}
+
+func (b gitLabIssues) Reopen(ctx context.Context, owner, repo string, number int) error {
+	return b.client.do(ctx, "PUT", b.issuePath(number, ""), map[string]string{"state_event": "reopen"}, nil)
+}
+
+// issueCommentsFromNotes converts the notes people left on an issue to issue
+// comments. System notes, such as "changed the description", are dropped.
+func issueCommentsFromNotes(notes []gitLabNote) []*github.IssueComment {
+	comments := make([]*github.IssueComment, 0, len(notes))
+	for _, note := range notes {
+		if note.System {
+			continue
+		}
+		comments = append(comments, note.comment())
+	}
+	return comments
+}
+
+func (note gitLabNote) comment() *github.IssueComment {
+	return &github.IssueComment{
+		ID:        github.Int64(note.ID),
+		Body:      github.String(note.Body),
+		User:      &github.User{Login: github.String(note.Author.Username)},
+		CreatedAt: &note.CreatedAt,
+		UpdatedAt: &note.UpdatedAt,
+	}
+}
+
+// reactionsFromAwardEmoji converts award emoji to reactions. Emoji without a
+// reaction equivalent are dropped.
+func reactionsFromAwardEmoji(awards []gitLabAwardEmoji) []issueReaction {
+	reactions := make([]issueReaction, 0, len(awards))
+	for _, award := range awards {
+		content, ok := gitLabAwardEmojiReactions[award.Name]
+		if !ok {
+			continue
+		}
+		reaction := issueReaction{ID: award.ID, Content: content, CreatedAt: award.CreatedAt}
+		reaction.User.Login = award.User.Username
+		reactions = append(reactions, reaction)
+	}
+	return reactions
+}
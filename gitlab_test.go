@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/trstringer/manual-approval/pkg/approval"
+)
+
+// fakeGitLab is an in-memory fake of the parts of the GitLab v4 API used by
+// the GitLab backend.
+type fakeGitLab struct {
+	fakeAPI
+
+	users       map[string]int64
+	groups      map[string][]string
+	notePolls   [][]gitLabNote
+	notes       []gitLabNote
+	awards      []gitLabAwardEmoji
+	issue       map[string]interface{}
+	issueState  string
+	postedNotes []string
+}
+
+func (f *fakeGitLab) route(w http.ResponseWriter, r *http.Request) bool {
+	path := strings.TrimPrefix(r.URL.EscapedPath(), "/api/v4/")
+	switch {
+	case r.Method == "GET" && path == "users":
+		username := r.URL.Query().Get("username")
+		users := []gitLabUser{}
+		if id, ok := f.users[username]; ok {
+			users = append(users, gitLabUser{ID: id, Username: username})
+		}
+		f.writeJSON(w, users)
+	case r.Method == "GET" && strings.HasPrefix(path, "groups/") && strings.HasSuffix(path, "/members/all"):
+		group := strings.TrimSuffix(strings.TrimPrefix(path, "groups/"), "/members/all")
+		members, ok := f.groups[strings.ReplaceAll(group, "%2F", "/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			break
+		}
+		// One member per page, to exercise pagination.
+		page := 1
+		_, _ = fmt.Sscanf(r.URL.Query().Get("page"), "%d", &page)
+		if page < len(members) {
+			w.Header().Set("X-Next-Page", fmt.Sprintf("%d", page+1))
+		}
+		f.writeJSON(w, []gitLabUser{{ID: int64(page), Username: members[page-1]}})
+	case r.Method == "POST" && path == "projects/42/issues":
+		f.readJSON(r, &f.issue)
+		f.issueState = "opened"
+		f.writeJSON(w, map[string]interface{}{
+			"iid":     7,
+			"web_url": "https://gitlab.example.com/group/project/-/issues/7",
+			"author":  map[string]string{"username": "project_bot"},
+		})
+	case r.Method == "POST" && path == "projects/42/issues/7/notes":
+		var note struct {
+			Body string `json:"body"`
+		}
+		f.readJSON(r, &note)
+		f.postedNotes = append(f.postedNotes, note.Body)
+		f.writeJSON(w, map[string]interface{}{"id": 1000 + len(f.postedNotes)})
+	case r.Method == "GET" && path == "projects/42/issues/7/notes":
+		if len(f.notePolls) > 0 {
+			f.notes = append(f.notes, f.notePolls[0]...)
+			f.notePolls = f.notePolls[1:]
+		}
+		f.writeJSON(w, f.notes)
+	case r.Method == "GET" && path == "projects/42/issues/7/award_emoji":
+		f.writeJSON(w, f.awards)
+	case r.Method == "PUT" && path == "projects/42/issues/7":
+		var update struct {
+			StateEvent string `json:"state_event"`
+		}
+		f.readJSON(r, &update)
+		switch update.StateEvent {
+		case "close":
+			f.issueState = "closed"
+		case "reopen":
+			f.issueState = "opened"
+		}
+		f.writeJSON(w, map[string]interface{}{"iid": 7})
+	default:
+		return false
+	}
+	return true
+}
+
+func newTestGitLabClient(t *testing.T, fake *fakeGitLab) *gitLabClient {
+	serverURL := fake.serve(t, func(r *http.Request) bool {
+		return r.Header.Get("PRIVATE-TOKEN") == "secret"
+	}, fake.route)
+
+	t.Setenv(envVarGitLabAPIURL, serverURL+"/api/v4/")
+	t.Setenv(envVarToken, "secret")
+	return newGitLabClient(inputs{})
+}
+
+func TestGitLabGroupMembers(t *testing.T) {
+	fake := &fakeGitLab{groups: map[string][]string{
+		"org/sre": {"login1", "login2", "login3"},
+	}}
+	client := newTestGitLabClient(t, fake)
+
+	testCases := []struct {
+		name      string
+		group     string
+		initiator string
+		exclude   bool
+		expected  []string
+	}{
+		{
+			name:     "nested_group",
+			group:    "org/sre",
+			expected: []string{"login1", "login2", "login3"},
+		},
+		{
+			name:      "exclude_initiator",
+			group:     "org/sre",
+			initiator: "login2",
+			exclude:   true,
+			expected:  []string{"login1", "login3"},
+		},
+		{
+			name:     "not_a_group",
+			group:    "login1",
+			expected: nil,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			actual := client.groupMembers(context.Background(), io.Discard, testCase.group, testCase.initiator, testCase.exclude)
+			if !reflect.DeepEqual(actual, testCase.expected) {
+				t.Fatalf("actual %v, expected %v", actual, testCase.expected)
+			}
+		})
+	}
+}
+
+func TestGitLabRunApproval(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	note := func(id int64, username, body string, system bool) gitLabNote {
+		n := gitLabNote{ID: id, Body: body, System: system, CreatedAt: start.Add(time.Duration(id) * time.Minute)}
+		n.UpdatedAt = n.CreatedAt
+		n.Author.Username = username
+		return n
+	}
+	award := func(id int64, username, name string) gitLabAwardEmoji {
+		a := gitLabAwardEmoji{ID: id, Name: name, CreatedAt: start.Add(time.Duration(id) * time.Minute)}
+		a.User.Username = username
+		return a
+	}
+
+	testCases := []struct {
+		name             string
+		notePolls        [][]gitLabNote
+		awards           []gitLabAwardEmoji
+		allowReactions   bool
+		expectedExitCode int
+		expectedStatus   string
+	}{
+		{
+			name: "approved_by_notes",
+			notePolls: [][]gitLabNote{
+				{note(1, "login1", "approved", false)},
+				{note(2, "login1", "changed the description", true), note(3, "login2", "lgtm", false)},
+			},
+			expectedExitCode: 0,
+			expectedStatus:   "approval-status=approved",
+		},
+		{
+			name:             "denied_by_note",
+			notePolls:        [][]gitLabNote{{note(1, "login2", "deny", false)}},
+			expectedExitCode: 1,
+			expectedStatus:   "approval-status=denied",
+		},
+		{
+			name:             "approved_by_award_emoji",
+			notePolls:        [][]gitLabNote{{note(1, "login1", "approved", false)}},
+			awards:           []gitLabAwardEmoji{award(2, "login2", "thumbsup"), award(3, "project_bot", "thumbsdown")},
+			allowReactions:   true,
+			expectedExitCode: 0,
+			expectedStatus:   "approval-status=approved",
+		},
+		{
+			name: "award_emoji_ignored_without_allow_reactions",
+			notePolls: [][]gitLabNote{
+				{note(1, "login1", "approved", false)},
+				{note(4, "login2", "approve", false)},
+			},
+			awards:           []gitLabAwardEmoji{award(2, "login2", "thumbsdown")},
+			expectedExitCode: 0,
+			expectedStatus:   "approval-status=approved",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			fake := &fakeGitLab{
+				users:     map[string]int64{"login1": 1, "login2": 2},
+				notePolls: testCase.notePolls,
+				awards:    testCase.awards,
+			}
+			client := newTestGitLabClient(t, fake)
+
+			var reactionMapping map[string]approval.Action
+			if testCase.allowReactions {
+				var err error
+				reactionMapping, err = parseReactionMapping(defaultApprovalReactions, defaultDenialReactions)
+				if err != nil {
+					t.Fatalf("error parsing reactions: %v", err)
+				}
+			}
+			apprv, err := newApprovalEnvironment(approvalOptions{
+				repoFullName:        "group/subgroup/project",
+				repoOwner:           "group/subgroup",
+				runID:               99,
+				issueApprovers:      []string{"login1", "login2"},
+				targetRepoOwner:     "group/subgroup",
+				targetRepoName:      "project",
+				failOnDenial:        true,
+				issueLabels:         []string{"deploy"},
+				editedCommentPolicy: editedCommentPolicyReevaluate,
+				commentSyntax:       approval.CommentSyntaxKeywords,
+				reactionMapping:     reactionMapping,
+				target:              approvalTargetIssue,
+				workflowRunURL:      "https://gitlab.example.com/group/subgroup/project/-/pipelines/99",
+			})
+			if err != nil {
+				t.Fatalf("error creating approval environment: %v", err)
+			}
+			requestChannel, err := newGitLabChannel(approvalTargetIssue, apprv, client, gitLabProject("42", "", ""))
+			if err != nil {
+				t.Fatalf("error creating channel: %v", err)
+			}
+
+			runTestApproval(t, apprv, requestChannel, testCase.expectedExitCode, testCase.expectedStatus, "issue-number=7", "issue-url=https://gitlab.example.com/group/project/-/issues/7")
+
+			fake.mu.Lock()
+			defer fake.mu.Unlock()
+			if fake.issueState != "closed" {
+				t.Fatalf("issue state %q, expected closed", fake.issueState)
+			}
+			if !reflect.DeepEqual(fake.issue["assignee_ids"], []interface{}{float64(1), float64(2)}) {
+				t.Fatalf("assignee_ids %v, expected [1 2]", fake.issue["assignee_ids"])
+			}
+			if fake.issue["labels"] != "deploy" {
+				t.Fatalf("labels %v, expected deploy", fake.issue["labels"])
+			}
+			if description, _ := fake.issue["description"].(string); !strings.Contains(description, apprv.workflowRunURL) {
+				t.Fatalf("description %q doesn't link to the pipeline", description)
+			}
+		})
+	}
+}
+
+func TestNewGitLabChannelRejectsIssueOnlyInputs(t *testing.T) {
+	apprv, err := newApprovalEnvironment(approvalOptions{
+		repoFullName:          "group/project",
+		repoOwner:             "group",
+		runID:                 99,
+		issueApprovers:        []string{"login1"},
+		targetRepoOwner:       "group",
+		targetRepoName:        "project",
+		failOnDenial:          true,
+		closeIssueMeansDenial: true,
+		editedCommentPolicy:   editedCommentPolicyReevaluate,
+		commentSyntax:         approval.CommentSyntaxKeywords,
+		target:                approvalTargetIssue,
+	})
+	if err != nil {
+		t.Fatalf("error creating approval environment: %v", err)
+	}
+	if _, err := newGitLabChannel(approvalTargetIssue, apprv, &gitLabClient{}, "42"); err == nil {
+		t.Fatalf("expected an error for close-issue-means-denial")
+	}
+}
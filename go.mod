@@ -5,6 +5,7 @@ go 1.25.0
 require (
 	github.com/google/go-github/v43 v43.0.0
 	golang.org/x/oauth2 v0.33.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
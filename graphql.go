@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/v43/github"
+)
+
+type graphQLRequest struct {
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables"`
+}
+
+type graphQLError struct {
+	Message string `json:"message"`
+}
+
+// graphQLURL derives the GraphQL endpoint from the REST base URL. GitHub.com
+// serves it next to the REST API, GitHub Enterprise Server at /api/graphql
+// instead of /api/v3/.
+func graphQLURL(client *github.Client) string {
+	base := client.BaseURL.String()
+	if strings.HasSuffix(base, "/api/v3/") {
+		return strings.TrimSuffix(base, "/v3/") + "/graphql"
+	}
+	return base + "graphql"
+}
+
+// doGraphQL runs a GraphQL query and decodes its data into result.
+func doGraphQL(ctx context.Context, client *github.Client, query string, variables map[string]interface{}, result interface{}) error {
+	req, err := client.NewRequest("POST", graphQLURL(client), &graphQLRequest{
+		Query:     query,
+		Variables: variables,
+	})
+	if err != nil {
+		return err
+	}
+
+	var response struct {
+		Data   interface{}    `json:"data"`
+		Errors []graphQLError `json:"errors"`
+	}
+	response.Data = result
+	if _, err := client.Do(ctx, req, &response); err != nil {
+		return err
+	}
+	if len(response.Errors) > 0 {
+		messages := make([]string, 0, len(response.Errors))
+		for _, graphQLErr := range response.Errors {
+			messages = append(messages, graphQLErr.Message)
+		}
+		return fmt.Errorf("graphql: %s", strings.Join(messages, "; "))
+	}
+	return nil
+}
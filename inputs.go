@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"strings"
+)
+
+// inputs are the values the action reads, by the environment variable of the
+// input or GitHub Actions variable they stand for. Command line flags take
+// precedence over the environment, and the environment over the selected
+// policy, which stands in for the inputs that weren't given.
+type inputs struct {
+	// flags holds the values of the flags given on the command line.
+	flags map[string]string
+	// policy holds the values of the selected policy, see withPolicy.
+	policy map[string]string
+}
+
+// get returns the value of an input, or "" if it isn't set.
+func (in inputs) get(envVar string) string {
+	if value, ok := in.flags[envVar]; ok {
+		return value
+	}
+	if value := os.Getenv(envVar); value != "" {
+		return value
+	}
+	return in.policy[envVar]
+}
+
+// lookup is get for values whose presence matters even when empty.
+func (in inputs) lookup(envVar string) (string, bool) {
+	if value, ok := in.flags[envVar]; ok {
+		return value, true
+	}
+	if value, ok := os.LookupEnv(envVar); ok {
+		return value, true
+	}
+	value, ok := in.policy[envVar]
+	return value, ok
+}
+
+// getOrDefault returns the trimmed value of an input, or def if it isn't
+// set.
+func (in inputs) getOrDefault(envVar, def string) string {
+	if value := strings.TrimSpace(in.get(envVar)); value != "" {
+		return value
+	}
+	return def
+}
+
+// withPolicy returns the inputs with the policy's values standing in for the
+// inputs that weren't given, so that inputs override the config file.
+func (in inputs) withPolicy(policy approvalPolicy) inputs {
+	in.policy = map[string]string{}
+	for envVar, value := range policy.inputs() {
+		// A body file is the body input too.
+		if value == "" || (envVar == envVarIssueBody && in.get(envVarIssueBodyFilePath) != "") {
+			continue
+		}
+		in.policy[envVar] = value
+	}
+	return in
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestInputsWithPolicy(t *testing.T) {
+	config, err := parseApprovalConfig([]byte(testConfig))
+	if err != nil {
+		t.Fatalf("error parsing config: %v", err)
+	}
+	for _, envVar := range []string{envVarApprovers, envVarRequiredApprovers, envVarMinimumApprovals, envVarAdditionalApprovedWords, envVarAdditionalDeniedWords, envVarIssueLabels, envVarIssueTitle, envVarIssueBody, envVarIssueBodyFilePath} {
+		t.Setenv(envVar, "")
+	}
+	t.Setenv(envVarMinimumApprovals, "1")
+
+	in := inputs{}.withPolicy(config.Policies["prod-strict"])
+	expected := map[string]string{
+		envVarApprovers:               "login1,login2,org-team1",
+		envVarRequiredApprovers:       "login2",
+		envVarMinimumApprovals:        "1",
+		envVarAdditionalApprovedWords: "ship it",
+		envVarIssueLabels:             "deploy,prod",
+		envVarIssueTitle:              "Deploy to production",
+		envVarIssueBody:               "",
+	}
+	for envVar, value := range expected {
+		if actual := in.get(envVar); actual != value {
+			t.Fatalf("%s is %q, expected %q", envVar, actual, value)
+		}
+	}
+	if actual := os.Getenv(envVarApprovers); actual != "" {
+		t.Fatalf("expected the environment to be left as it is, %s is %q", envVarApprovers, actual)
+	}
+}
+
+func TestInputsWithPolicyBodyFile(t *testing.T) {
+	t.Setenv(envVarIssueBody, "")
+	t.Setenv(envVarIssueBodyFilePath, "body.md")
+
+	in := inputs{}.withPolicy(approvalPolicy{IssueBody: "Policy body"})
+	if actual := in.get(envVarIssueBody); actual != "" {
+		t.Fatalf("expected the body file to take precedence over the policy body, got %q", actual)
+	}
+}
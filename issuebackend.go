@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+
+	"github.com/google/go-github/v43/github"
+)
+
+// issueBackend is the issue tracker an issue channel makes its request in.
+// Votes are parsed from the comments and reactions it lists, so every backend
+// goes through the same edited comment policy and vote parsing. Trackers bound
+// to a single project ignore owner and repo.
+type issueBackend interface {
+	// CreateIssue opens an issue and returns its number, URL and author.
+	CreateIssue(ctx context.Context, owner, repo string, request *github.IssueRequest) (*github.Issue, error)
+	// GetIssue returns an issue, including its state.
+	GetIssue(ctx context.Context, owner, repo string, number int) (*github.Issue, error)
+	// ListComments lists every comment on an issue, oldest first.
+	ListComments(ctx context.Context, owner, repo string, number int) ([]*github.IssueComment, error)
+	// PostComment comments on an issue and returns the comment.
+	PostComment(ctx context.Context, owner, repo string, number int, body string) (*github.IssueComment, error)
+	// ListReactions lists the reactions to an issue.
+	ListReactions(ctx context.Context, owner, repo string, number int) ([]issueReaction, error)
+	// Close closes an issue once the request is decided, approved or not.
+	Close(ctx context.Context, owner, repo string, number int, approved bool) error
+	// Reopen reopens an issue closed before the request was decided.
+	Reopen(ctx context.Context, owner, repo string, number int) error
+}
+
+// githubIssues is the issue backend of GitHub.
+type githubIssues struct {
+	client *github.Client
+}
+
+func (b githubIssues) CreateIssue(ctx context.Context, owner, repo string, request *github.IssueRequest) (*github.Issue, error) {
+	issue, _, err := b.client.Issues.Create(ctx, owner, repo, request)
+	return issue, err
+}
+
+func (b githubIssues) GetIssue(ctx context.Context, owner, repo string, number int) (*github.Issue, error) {
+	issue, _, err := b.client.Issues.Get(ctx, owner, repo, number)
+	return issue, err
+}
+
+func (b githubIssues) ListComments(ctx context.Context, owner, repo string, number int) ([]*github.IssueComment, error) {
+	return listIssueComments(ctx, b.client, owner, repo, number)
+}
+
+func (b githubIssues) PostComment(ctx context.Context, owner, repo string, number int, body string) (*github.IssueComment, error) {
+	comment, _, err := b.client.Issues.CreateComment(ctx, owner, repo, number, &github.IssueComment{
+		Body: &body,
+	})
+	return comment, err
+}
+
+func (b githubIssues) ListReactions(ctx context.Context, owner, repo string, number int) ([]issueReaction, error) {
+	return listIssueReactions(ctx, b.client, owner, repo, number)
+}
+
+func (b githubIssues) Close(ctx context.Context, owner, repo string, number int, approved bool) error {
+	return b.setState(ctx, owner, repo, number, "closed")
+}
+
+func (b githubIssues) Reopen(ctx context.Context, owner, repo string, number int) error {
+	return b.setState(ctx, owner, repo, number, "open")
+}
+
+func (b githubIssues) setState(ctx context.Context, owner, repo string, number int, state string) error {
+	_, _, err := b.client.Issues.Edit(ctx, owner, repo, number, &github.IssueRequest{State: &state})
+	return err
+}
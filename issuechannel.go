@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/go-github/v43/github"
+
+	"github.com/trstringer/manual-approval/pkg/approval"
+)
+
+// issueChannel makes the approval request as an issue assigned to the
+// approvers, and reads votes from its comments, reactions and closes. With
+// issue-number set, the request is made as a marker comment on that existing
+// issue instead, and only what happens after the marker counts.
+type issueChannel struct {
+	apprv   *approvalEnvironment
+	backend issueBackend
+	// client reads the events and body edits of the issue, which only
+	// GitHub has. It is nil unless the backend is GitHub's.
+	client *github.Client
+
+	closeEvent  issueEvent
+	issueClosed bool
+	loopCounter int
+
+	markerID int64
+	markerAt time.Time
+}
+
+func (c *issueChannel) CreateRequest(ctx context.Context) error {
+	a := c.apprv
+	if a.existingIssueNumber > 0 {
+		return c.attachRequest(ctx)
+	}
+
+	issueTitle := a.approvalRequestTitle()
+	issueBody := a.approvalRequestBody()
+
+	var err error
+	fmt.Fprintf(
+		a.log,
+		"Creating issue in repo %s/%s with the following content:\nTitle: %s\nApprovers: %s\nBody:\n%s\n",
+		a.targetRepoOwner,
+		a.targetRepoName,
+		issueTitle,
+		a.issueApprovers,
+		issueBody,
+	)
+	a.approvalIssue, err = c.backend.CreateIssue(ctx, a.targetRepoOwner, a.targetRepoName, &github.IssueRequest{
+		Title:     &issueTitle,
+		Body:      &issueBody,
+		Assignees: &a.issueApprovers,
+		Labels:    &a.issueLabels,
+	})
+	if err != nil {
+		return err
+	}
+	a.approvalIssueNumber = a.approvalIssue.GetNumber()
+	a.issueAuthor = a.approvalIssue.GetUser().GetLogin()
+
+	if err := c.postBodyChunks(ctx); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(a.log, "Issue created: %s\n", a.approvalIssue.GetHTMLURL())
+	return nil
+}
+
+// attachRequest makes the approval request on the existing issue by posting
+// a marker comment with the approval prompt.
+func (c *issueChannel) attachRequest(ctx context.Context) error {
+	a := c.apprv
+	issue, err := c.backend.GetIssue(ctx, a.targetRepoOwner, a.targetRepoName, a.existingIssueNumber)
+	if err != nil {
+		return fmt.Errorf("error getting issue %d: %w", a.existingIssueNumber, err)
+	}
+	if issue.GetState() == "closed" {
+		return fmt.Errorf("issue %d is closed", a.existingIssueNumber)
+	}
+	a.approvalIssueNumber = issue.GetNumber()
+	a.approvalIssue = issue
+
+	marker := fmt.Sprintf("## %s\n\n%s", a.approvalRequestTitle(), a.approvalRequestBody())
+	fmt.Fprintf(a.log, "Requesting approval on issue %s:\n%s\n", issue.GetHTMLURL(), marker)
+	created, err := c.backend.PostComment(ctx, a.targetRepoOwner, a.targetRepoName, a.approvalIssueNumber, marker)
+	if err != nil {
+		return fmt.Errorf("error commenting on issue: %w", err)
+	}
+	c.markerID = created.GetID()
+	c.markerAt = created.GetCreatedAt()
+	a.issueAuthor = created.GetUser().GetLogin()
+
+	return c.postBodyChunks(ctx)
+}
+
+// closesIssue reports whether the issue is closed once the request is
+// decided. An existing issue is left open unless close-existing-issue is set.
+func (c *issueChannel) closesIssue() bool {
+	return c.apprv.existingIssueNumber == 0 || c.apprv.closeExistingIssue
+}
+
+// postBodyChunks adds the custom issue body as comments, split to stay under
+// the comment size limit.
+func (c *issueChannel) postBodyChunks(ctx context.Context) error {
+	bodyChunks := splitLongString(c.apprv.issueBody)
+	for _, chunk := range bodyChunks {
+		if err := c.comment(ctx, chunk); err != nil {
+			return fmt.Errorf("failed to add comment chunk to issue: %w", err)
+		}
+	}
+	return nil
+}
+
+func (c *issueChannel) comment(ctx context.Context, body string) error {
+	a := c.apprv
+	_, err := c.backend.PostComment(ctx, a.targetRepoOwner, a.targetRepoName, a.approvalIssueNumber, body)
+	return err
+}
+
+func (c *issueChannel) ListVotes(ctx context.Context) ([]approval.Vote, error) {
+	a := c.apprv
+	comments, err := c.backend.ListComments(ctx, a.targetRepoOwner, a.targetRepoName, a.approvalIssueNumber)
+	if err != nil {
+		return nil, fmt.Errorf("error getting comments: %w", err)
+	}
+
+	if c.markerID != 0 {
+		comments = commentsAfter(comments, c.markerID)
+	}
+	comments, a.ignoredCommentIDs = filterComments(comments, a.editedCommentPolicy)
+	if len(a.ignoredCommentIDs) > 0 {
+		fmt.Fprintf(a.log, "Ignoring %d edited comment(s): %v\n", len(a.ignoredCommentIDs), a.ignoredCommentIDs)
+	}
+
+	votes := a.evaluator.VotesFromComments(approvalComments(comments))
+	if a.reactionMapping != nil {
+		reactions, err := c.backend.ListReactions(ctx, a.targetRepoOwner, a.targetRepoName, a.approvalIssueNumber)
+		if err != nil {
+			return nil, fmt.Errorf("error getting reactions: %w", err)
+		}
+		votes = approval.MergeVotes(votes, approval.VotesAfter(votesFromReactions(reactions, a.reactionMapping, a.issueAuthor), c.markerAt))
+	}
+
+	if a.closeIssueAsVote {
+		events, err := listIssueEvents(ctx, c.client, a.targetRepoOwner, a.targetRepoName, a.approvalIssueNumber)
+		if err != nil {
+			return nil, fmt.Errorf("error getting issue events: %w", err)
+		}
+		votes = approval.MergeVotes(votes, approval.VotesAfter(votesFromCloseEvents(events), c.markerAt))
+		c.closeEvent, c.issueClosed = lastCloseEvent(events)
+	}
+
+	return votes, nil
+}
+
+func (c *issueChannel) Review(ctx context.Context, decision approval.Decision) (approval.Decision, error) {
+	a := c.apprv
+	if len(a.checklist) > 0 {
+		revisions, err := listIssueBodyRevisions(ctx, c.client, a.targetRepoOwner, a.targetRepoName, a.approvalIssueNumber)
+		if err != nil {
+			return decision, fmt.Errorf("error getting issue body edits: %w", err)
+		}
+		a.checklistState = checklistFromRevisions(a.checklist, revisions)
+		if decision.Status == approval.StatusApproved && !checklistComplete(a.checklistState, a.issueApprovers) {
+			fmt.Fprintln(a.log, "Approvals are in but the checklist has not been completed by approvers")
+			decision.Status = approval.StatusPending
+		}
+	}
+
+	if decision.Status != approval.StatusPending {
+		return decision, nil
+	}
+
+	if c.issueClosed {
+		// The close didn't decide the request, so the issue has to
+		// stay open for the remaining approvers.
+		if err := c.reopen(ctx, closeExplanation(c.closeEvent, a.issueApprovers)); err != nil {
+			return decision, err
+		}
+	}
+
+	if a.closeIssueMeansDenial {
+		// Loop counter to make an API call only once per 10 interation, intention: avoid github rate limiting and reduce api cost and stress.
+		if c.loopCounter < 10 {
+			c.loopCounter += 1
+			return decision, nil
+		}
+		c.loopCounter = 0
+
+		issue, err := c.backend.GetIssue(ctx, a.targetRepoOwner, a.targetRepoName, a.approvalIssueNumber)
+		if err != nil {
+			return decision, fmt.Errorf("error fetching issue state: %w", err)
+		}
+		if issue.GetState() != "closed" {
+			return decision, nil
+		}
+
+		timeline, err := listIssueTimeline(ctx, c.client, a.targetRepoOwner, a.targetRepoName, a.approvalIssueNumber)
+		if err != nil {
+			return decision, fmt.Errorf("error fetching issue timeline: %w", err)
+		}
+		closeEvent, _ := lastCloseEvent(timeline)
+		closer := closeEvent.Actor.Login
+
+		if !a.canCloseAsDenial(closer) {
+			// Only approvers and configured closers can deny by
+			// closing, so put the issue back and keep waiting.
+			return decision, c.reopen(ctx, disallowedCloseComment(closer))
+		}
+
+		// Issue was closed externally without any approval/denial comment.
+		// Treat as denial per user configuration.
+		return approval.Decision{
+			Status: approval.StatusDenied,
+			Votes: []approval.Vote{{
+				User:      closer,
+				Action:    approval.ActionDeny,
+				Source:    "close",
+				CreatedAt: closeEvent.CreatedAt,
+			}},
+		}, nil
+	}
+
+	return decision, nil
+}
+
+func (c *issueChannel) reopen(ctx context.Context, reopenComment string) error {
+	fmt.Fprintln(c.apprv.log, reopenComment)
+	if err := c.comment(ctx, reopenComment); err != nil {
+		return fmt.Errorf("error commenting on issue: %w", err)
+	}
+	a := c.apprv
+	if err := c.backend.Reopen(ctx, a.targetRepoOwner, a.targetRepoName, a.approvalIssueNumber); err != nil {
+		return fmt.Errorf("error reopening issue: %w", err)
+	}
+	return nil
+}
+
+func (c *issueChannel) Finish(ctx context.Context, decision approval.Decision) error {
+	a := c.apprv
+
+	if decision.Status == approval.StatusDenied && len(decision.Votes) > 0 && decision.Votes[0].Source == "close" {
+		denyComment := fmt.Sprintf("Issue was closed by @%s without approval. Treating closure as denial %s", decision.Votes[0].User, denialSuffix(a.failOnDenial))
+		fmt.Fprintln(a.log, denyComment)
+		// Issue is already closed — add comment only, skip re-closing
+		if err := c.comment(ctx, denyComment); err != nil {
+			fmt.Fprintf(a.log, "error commenting on closed issue: %v\n", err)
+		}
+		return nil
+	}
+
+	var closeComment string
+	switch {
+	case decision.Status == approval.StatusApproved && c.closesIssue():
+		closeComment = fmt.Sprintf("The required number of approvals (%d) has been met; continuing workflow and closing this issue.", a.minimumApprovals)
+	case decision.Status == approval.StatusApproved:
+		closeComment = fmt.Sprintf("The required number of approvals (%d) has been met; continuing workflow.", a.minimumApprovals)
+	case c.closesIssue():
+		closeComment = fmt.Sprintf("Request denied. Closing issue %s", denialSuffix(a.failOnDenial))
+	default:
+		closeComment = fmt.Sprintf("Request denied %s", denialSuffix(a.failOnDenial))
+	}
+
+	if err := c.comment(ctx, closeComment); err != nil {
+		return fmt.Errorf("error commenting on issue: %w", err)
+	}
+	if !c.closesIssue() {
+		return nil
+	}
+	if err := c.backend.Close(ctx, a.targetRepoOwner, a.targetRepoName, a.approvalIssueNumber, decision.Status == approval.StatusApproved); err != nil {
+		return fmt.Errorf("error closing issue: %w", err)
+	}
+	return nil
+}
+
+func (c *issueChannel) Cancel(ctx context.Context) error {
+	closeComment := "Workflow cancelled, closing issue."
+	if !c.closesIssue() {
+		closeComment = "Workflow cancelled, no longer waiting for approval."
+	}
+
+	fmt.Fprintln(c.apprv.log, closeComment)
+	if err := c.comment(ctx, closeComment); err != nil {
+		return fmt.Errorf("error commenting on issue: %w", err)
+	}
+	if !c.closesIssue() {
+		return nil
+	}
+	a := c.apprv
+	if err := c.backend.Close(ctx, a.targetRepoOwner, a.targetRepoName, a.approvalIssueNumber, false); err != nil {
+		return fmt.Errorf("error closing issue: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,443 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v43/github"
+
+	"github.com/trstringer/manual-approval/pkg/approval"
+)
+
+// jiraPageSize is the page size requested from paginated Jira endpoints.
+// Jira may return fewer, so pagination follows the returned counts.
+const jiraPageSize = 100
+
+// jiraClient is a minimal client for the Jira REST API v2. Version 2 is
+// used over version 3 as it takes and returns descriptions and comments as
+// plain text rather than Atlassian Document Format.
+type jiraClient struct {
+	restClient
+}
+
+// newJiraClient connects to the Jira Cloud site at jira-url with the API
+// token of jira-user.
+func newJiraClient(in inputs) *jiraClient {
+	user, token := in.get(envVarJiraUser), in.get(envVarJiraToken)
+	return &jiraClient{
+		restClient: newRESTClient("jira", in.get(envVarJiraURL), func(req *http.Request) {
+			req.SetBasicAuth(user, token)
+		}),
+	}
+}
+
+func validateJiraInput(in inputs) error {
+	if err := validateInput(in); err != nil {
+		return err
+	}
+
+	missingEnvVars := []string{}
+	for _, envVar := range []string{envVarJiraURL, envVarJiraUser, envVarJiraToken, envVarJiraAccountMapping} {
+		if in.get(envVar) == "" {
+			missingEnvVars = append(missingEnvVars, envVar)
+		}
+	}
+	if in.get(envVarJiraProject) == "" && in.get(envVarJiraIssueKey) == "" {
+		missingEnvVars = append(missingEnvVars, envVarJiraProject)
+	}
+
+	if len(missingEnvVars) > 0 {
+		return fmt.Errorf("missing env vars: %v", missingEnvVars)
+	}
+	return nil
+}
+
+// jiraTime decodes Jira timestamps, which have no colon in the zone offset,
+// e.g. 2024-01-01T12:00:00.000+0000.
+type jiraTime struct {
+	time.Time
+}
+
+func (t *jiraTime) UnmarshalJSON(raw []byte) error {
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return err
+	}
+	parsed, err := time.Parse("2006-01-02T15:04:05.000-0700", s)
+	if err != nil {
+		return err
+	}
+	t.Time = parsed
+	return nil
+}
+
+type jiraUser struct {
+	AccountID   string `json:"accountId"`
+	DisplayName string `json:"displayName"`
+}
+
+type jiraComment struct {
+	ID      string   `json:"id"`
+	Body    string   `json:"body"`
+	Author  jiraUser `json:"author"`
+	Created jiraTime `json:"created"`
+	Updated jiraTime `json:"updated"`
+}
+
+type jiraChangelogItem struct {
+	Field      string `json:"field"`
+	FromString string `json:"fromString"`
+	ToString   string `json:"toString"`
+}
+
+type jiraChangelog struct {
+	ID      string              `json:"id"`
+	Author  jiraUser            `json:"author"`
+	Created jiraTime            `json:"created"`
+	Items   []jiraChangelogItem `json:"items"`
+}
+
+// readJiraAccountMapping reads the file mapping approver logins to Jira
+// account IDs. It is a JSON object, e.g. {"login1": "5b10ac8d82e05b22cc7d4ef5"}.
+func readJiraAccountMapping(path string) (map[string]string, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading jira account mapping: %w", err)
+	}
+	var mapping map[string]string
+	if err := json.Unmarshal(raw, &mapping); err != nil {
+		return nil, fmt.Errorf("error parsing jira account mapping %s: %w", path, err)
+	}
+	return mapping, nil
+}
+
+// jiraIssueChannel makes the approval request as a Jira issue, or on an
+// existing one, and reads votes from the issue's status transitions and its
+// comments.
+type jiraIssueChannel struct {
+	apprv            *approvalEnvironment
+	client           *jiraClient
+	project          string
+	issueType        string
+	approvedStatuses []string
+	deniedStatuses   []string
+	// logins maps Jira account IDs back to approver logins.
+	logins map[string]string
+
+	issueKey string
+	existing bool
+	markerAt time.Time
+}
+
+func newJiraChannel(target approvalTarget, apprv *approvalEnvironment, client *jiraClient, project, issueKey, issueType string, approvedStatuses, deniedStatuses []string, accounts map[string]string) (approval.Channel, error) {
+	if target != approvalTargetIssue {
+		return nil, fmt.Errorf("target %q is not supported with the %s backend", target, backendJira)
+	}
+	if apprv.existingIssueNumber > 0 {
+		return nil, fmt.Errorf("issue-number is not supported with the %s backend, use jira-issue-key", backendJira)
+	}
+	if apprv.reactionMapping != nil {
+		return nil, fmt.Errorf("allow-reactions is not supported with the %s backend", backendJira)
+	}
+	if err := checkIssueOnlyInputs(apprv, fmt.Sprintf("the %s backend", backendJira)); err != nil {
+		return nil, err
+	}
+
+	logins := map[string]string{}
+	for _, approver := range apprv.issueApprovers {
+		accountID := ""
+		for login, id := range accounts {
+			if strings.EqualFold(login, approver) {
+				accountID = id
+			}
+		}
+		if accountID == "" {
+			return nil, fmt.Errorf("approver %s has no Jira account ID in the account mapping", approver)
+		}
+		logins[accountID] = approver
+	}
+
+	return &jiraIssueChannel{
+		apprv:            apprv,
+		client:           client,
+		project:          project,
+		issueType:        issueType,
+		approvedStatuses: approvedStatuses,
+		deniedStatuses:   deniedStatuses,
+		logins:           logins,
+		issueKey:         issueKey,
+		existing:         issueKey != "",
+	}, nil
+}
+
+// newJiraChannelFromInputs makes the Jira channel with the Jira inputs.
+func newJiraChannelFromInputs(in inputs, apprv *approvalEnvironment) (approval.Channel, error) {
+	accounts, err := readJiraAccountMapping(in.get(envVarJiraAccountMapping))
+	if err != nil {
+		return nil, err
+	}
+	approvedStatuses := readAdditionalWords(in, envVarJiraApprovedStatuses)
+	if len(approvedStatuses) == 0 {
+		approvedStatuses = []string{defaultJiraApprovedStatus}
+	}
+	deniedStatuses := readAdditionalWords(in, envVarJiraDeniedStatuses)
+	if len(deniedStatuses) == 0 {
+		deniedStatuses = []string{defaultJiraDeniedStatus}
+	}
+	return newJiraChannel(apprv.target, apprv, newJiraClient(in), strings.TrimSpace(in.get(envVarJiraProject)), strings.TrimSpace(in.get(envVarJiraIssueKey)), in.getOrDefault(envVarJiraIssueType, defaultJiraIssueType), approvedStatuses, deniedStatuses, accounts)
+}
+
+func (c *jiraIssueChannel) issuePath(suffix string) string {
+	return fmt.Sprintf("rest/api/2/issue/%s%s", url.PathEscape(c.issueKey), suffix)
+}
+
+func (c *jiraIssueChannel) accountID(login string) string {
+	for accountID, approver := range c.logins {
+		if approver == login {
+			return accountID
+		}
+	}
+	return ""
+}
+
+// mention mentions an approver by their Jira account, so they are notified.
+// Approvers without an account, which only areas can have, are named.
+func (c *jiraIssueChannel) mention(approver string) string {
+	if accountID := c.accountID(approver); accountID != "" {
+		return fmt.Sprintf("[~accountid:%s]", accountID)
+	}
+	return approver
+}
+
+func (c *jiraIssueChannel) CreateRequest(ctx context.Context) error {
+	a := c.apprv
+	title := a.approvalRequestTitle()
+	description := a.approvalRequestBodyMentioning(c.mention)
+
+	if c.existing {
+		if err := c.attachRequest(ctx, title, description); err != nil {
+			return err
+		}
+	} else {
+		fmt.Fprintf(
+			a.log,
+			"Creating issue in Jira project %s with the following content:\nTitle: %s\nApprovers: %s\nBody:\n%s\n",
+			c.project,
+			title,
+			a.issueApprovers,
+			description,
+		)
+
+		fields := map[string]interface{}{
+			"project":     map[string]string{"key": c.project},
+			"summary":     title,
+			"description": description,
+			"issuetype":   map[string]string{"name": c.issueType},
+			"labels":      a.issueLabels,
+		}
+		// A Jira issue has a single assignee. All approvers are listed in
+		// the description.
+		if len(a.issueApprovers) > 0 {
+			fields["assignee"] = map[string]string{"accountId": c.accountID(a.issueApprovers[0])}
+		}
+		var created struct {
+			Key string `json:"key"`
+		}
+		if err := c.client.do(ctx, "POST", "rest/api/2/issue", map[string]interface{}{"fields": fields}, &created); err != nil {
+			return err
+		}
+		c.issueKey = created.Key
+	}
+
+	issueURL := fmt.Sprintf("%s/browse/%s", c.client.baseURL, c.issueKey)
+	issueNumber, err := strconv.Atoi(c.issueKey[strings.LastIndex(c.issueKey, "-")+1:])
+	if err != nil {
+		return fmt.Errorf("error parsing jira issue key %s: %w", c.issueKey, err)
+	}
+	a.approvalIssueNumber = issueNumber
+	a.approvalIssue = &github.Issue{
+		Number:  &issueNumber,
+		HTMLURL: &issueURL,
+	}
+	if _, err := a.SetActionOutputs(map[string]string{"jira-issue-key": c.issueKey}); err != nil {
+		return fmt.Errorf("error setting jira issue key output: %w", err)
+	}
+
+	for _, chunk := range splitLongString(a.issueBody) {
+		if _, err := c.comment(ctx, chunk); err != nil {
+			return fmt.Errorf("failed to add comment chunk to issue: %w", err)
+		}
+	}
+
+	fmt.Fprintf(a.log, "Approval requested on issue: %s\n", issueURL)
+	return nil
+}
+
+// attachRequest posts the approval request as a comment on the existing
+// issue. Only transitions and comments after it count as votes.
+func (c *jiraIssueChannel) attachRequest(ctx context.Context, title, description string) error {
+	fmt.Fprintf(c.apprv.log, "Requesting approval on Jira issue %s\nApprovers: %s\n", c.issueKey, c.apprv.issueApprovers)
+
+	var issue struct {
+		Key string `json:"key"`
+	}
+	if err := c.client.do(ctx, "GET", c.issuePath("?fields=status"), nil, &issue); err != nil {
+		return fmt.Errorf("error getting jira issue %s: %w", c.issueKey, err)
+	}
+	c.issueKey = issue.Key
+
+	marker, err := c.comment(ctx, fmt.Sprintf("*%s*\n\n%s", title, description))
+	if err != nil {
+		return fmt.Errorf("error posting approval request: %w", err)
+	}
+	c.markerAt = marker.Created.Time
+	return nil
+}
+
+func (c *jiraIssueChannel) comment(ctx context.Context, body string) (jiraComment, error) {
+	var created jiraComment
+	err := c.client.do(ctx, "POST", c.issuePath("/comment"), map[string]string{"body": body}, &created)
+	return created, err
+}
+
+func (c *jiraIssueChannel) ListVotes(ctx context.Context) ([]approval.Vote, error) {
+	a := c.apprv
+
+	var jiraComments []jiraComment
+	for startAt := 0; ; {
+		var page struct {
+			Total    int           `json:"total"`
+			Comments []jiraComment `json:"comments"`
+		}
+		if err := c.client.do(ctx, "GET", c.issuePath(fmt.Sprintf("/comment?orderBy=created&startAt=%d&maxResults=%d", startAt, jiraPageSize)), nil, &page); err != nil {
+			return nil, fmt.Errorf("error getting comments: %w", err)
+		}
+		jiraComments = append(jiraComments, page.Comments...)
+		startAt += len(page.Comments)
+		if len(page.Comments) == 0 || startAt >= page.Total {
+			break
+		}
+	}
+
+	var changelogs []jiraChangelog
+	for startAt := 0; ; {
+		var page struct {
+			IsLast bool            `json:"isLast"`
+			Values []jiraChangelog `json:"values"`
+		}
+		if err := c.client.do(ctx, "GET", c.issuePath(fmt.Sprintf("/changelog?startAt=%d&maxResults=%d", startAt, jiraPageSize)), nil, &page); err != nil {
+			return nil, fmt.Errorf("error getting changelog: %w", err)
+		}
+		changelogs = append(changelogs, page.Values...)
+		startAt += len(page.Values)
+		if len(page.Values) == 0 || page.IsLast {
+			break
+		}
+	}
+
+	comments, ignoredCommentIDs := filterComments(issueCommentsFromJira(jiraComments, c.logins), a.editedCommentPolicy)
+	a.ignoredCommentIDs = ignoredCommentIDs
+	if len(a.ignoredCommentIDs) > 0 {
+		fmt.Fprintf(a.log, "Ignoring %d edited comment(s): %v\n", len(a.ignoredCommentIDs), a.ignoredCommentIDs)
+	}
+
+	votes := approval.MergeVotes(a.evaluator.VotesFromComments(approvalComments(comments)), votesFromTransitions(changelogs, c.approvedStatuses, c.deniedStatuses, c.logins))
+	return approval.VotesAfter(votes, c.markerAt), nil
+}
+
+// issueCommentsFromJira converts Jira comments to issue comments, with
+// authors mapped back to approver logins. Others keep their account ID,
+// which never matches an approver.
+func issueCommentsFromJira(jiraComments []jiraComment, logins map[string]string) []*github.IssueComment {
+	comments := make([]*github.IssueComment, 0, len(jiraComments))
+	for _, jc := range jiraComments {
+		id, err := strconv.ParseInt(jc.ID, 10, 64)
+		if err != nil {
+			continue
+		}
+		login, ok := logins[jc.Author.AccountID]
+		if !ok {
+			login = jc.Author.AccountID
+		}
+		jc := jc
+		comments = append(comments, &github.IssueComment{
+			ID:        github.Int64(id),
+			Body:      github.String(jc.Body),
+			User:      &github.User{Login: github.String(login)},
+			CreatedAt: &jc.Created.Time,
+			UpdatedAt: &jc.Updated.Time,
+		})
+	}
+	return comments
+}
+
+// votesFromTransitions turns transitions of the issue's status into votes:
+// moving it to one of approvedStatuses approves, and to one of
+// deniedStatuses denies. Transitions by anyone but the approvers are
+// dropped.
+func votesFromTransitions(changelogs []jiraChangelog, approvedStatuses, deniedStatuses []string, logins map[string]string) []approval.Vote {
+	var votes []approval.Vote
+	for _, changelog := range changelogs {
+		login, ok := logins[changelog.Author.AccountID]
+		if !ok {
+			continue
+		}
+		for _, item := range changelog.Items {
+			if item.Field != "status" {
+				continue
+			}
+			var action approval.Action
+			switch {
+			case approversIndex(approvedStatuses, item.ToString) >= 0:
+				action = approval.ActionApprove
+			case approversIndex(deniedStatuses, item.ToString) >= 0:
+				action = approval.ActionDeny
+			default:
+				continue
+			}
+			votes = append(votes, approval.Vote{
+				User:      login,
+				Action:    action,
+				Source:    "transition",
+				CreatedAt: changelog.Created.Time,
+			})
+		}
+	}
+	return votes
+}
+
+func (c *jiraIssueChannel) Review(ctx context.Context, decision approval.Decision) (approval.Decision, error) {
+	return decision, nil
+}
+
+// Finish only comments on the issue. Its status is left to the approvers and
+// the Jira workflow.
+func (c *jiraIssueChannel) Finish(ctx context.Context, decision approval.Decision) error {
+	a := c.apprv
+	var closeComment string
+	if decision.Status == approval.StatusApproved {
+		closeComment = fmt.Sprintf("The required number of approvals (%d) has been met; continuing workflow.", a.minimumApprovals)
+	} else {
+		closeComment = fmt.Sprintf("Request denied %s", denialSuffix(a.failOnDenial))
+	}
+	if _, err := c.comment(ctx, closeComment); err != nil {
+		return fmt.Errorf("error commenting on issue: %w", err)
+	}
+	return nil
+}
+
+func (c *jiraIssueChannel) Cancel(ctx context.Context) error {
+	closeComment := "Workflow cancelled, the approval request is no longer pending."
+	fmt.Fprintln(c.apprv.log, closeComment)
+	if _, err := c.comment(ctx, closeComment); err != nil {
+		return fmt.Errorf("error commenting on issue: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/trstringer/manual-approval/pkg/approval"
+)
+
+const jiraTestTimeLayout = "2006-01-02T15:04:05.000-0700"
+
+// jiraPoll is what the fake Jira adds to the issue before a poll.
+type jiraPoll struct {
+	comments   []map[string]interface{}
+	changelogs []map[string]interface{}
+}
+
+// fakeJira is an in-memory fake of the parts of the Jira REST API v2 used by
+// the Jira backend.
+type fakeJira struct {
+	fakeAPI
+
+	markerAt       time.Time
+	polls          []jiraPoll
+	comments       []map[string]interface{}
+	changelogs     []map[string]interface{}
+	createdFields  map[string]interface{}
+	postedComments []string
+}
+
+func (f *fakeJira) route(w http.ResponseWriter, r *http.Request) bool {
+	route := r.Method + " " + r.URL.Path
+	switch {
+	case route == "POST /rest/api/2/issue":
+		var issue struct {
+			Fields map[string]interface{} `json:"fields"`
+		}
+		f.readJSON(r, &issue)
+		f.createdFields = issue.Fields
+		w.WriteHeader(http.StatusCreated)
+		f.writeJSON(w, map[string]string{"id": "10007", "key": "OPS-7"})
+	case route == "GET /rest/api/2/issue/OPS-5":
+		f.writeJSON(w, map[string]string{"id": "10005", "key": "OPS-5"})
+	case r.Method == "POST" && strings.HasSuffix(r.URL.Path, "/comment"):
+		var comment struct {
+			Body string `json:"body"`
+		}
+		f.readJSON(r, &comment)
+		f.postedComments = append(f.postedComments, comment.Body)
+		w.WriteHeader(http.StatusCreated)
+		f.writeJSON(w, map[string]interface{}{
+			"id":      strconv.Itoa(1000 + len(f.postedComments)),
+			"body":    comment.Body,
+			"author":  map[string]string{"accountId": "bot"},
+			"created": f.markerAt.Format(jiraTestTimeLayout),
+			"updated": f.markerAt.Format(jiraTestTimeLayout),
+		})
+	case r.Method == "GET" && strings.HasSuffix(r.URL.Path, "/comment"):
+		startAt, _ := strconv.Atoi(r.URL.Query().Get("startAt"))
+		if startAt == 0 && len(f.polls) > 0 {
+			f.comments = append(f.comments, f.polls[0].comments...)
+			f.changelogs = append(f.changelogs, f.polls[0].changelogs...)
+			f.polls = f.polls[1:]
+		}
+		// One comment per page, to exercise pagination.
+		page := []map[string]interface{}{}
+		if startAt < len(f.comments) {
+			page = f.comments[startAt : startAt+1]
+		}
+		f.writeJSON(w, map[string]interface{}{"startAt": startAt, "total": len(f.comments), "comments": page})
+	case r.Method == "GET" && strings.HasSuffix(r.URL.Path, "/changelog"):
+		f.writeJSON(w, map[string]interface{}{"isLast": true, "values": f.changelogs})
+	default:
+		return false
+	}
+	return true
+}
+
+func TestReadJiraAccountMapping(t *testing.T) {
+	dir := t.TempDir()
+
+	valid := filepath.Join(dir, "valid.json")
+	if err := os.WriteFile(valid, []byte(`{"login1": "account-1", "Login2": "account-2"}`), 0o600); err != nil {
+		t.Fatalf("error writing mapping: %v", err)
+	}
+	mapping, err := readJiraAccountMapping(valid)
+	if err != nil {
+		t.Fatalf("error reading mapping: %v", err)
+	}
+	expected := map[string]string{"login1": "account-1", "Login2": "account-2"}
+	if !reflect.DeepEqual(mapping, expected) {
+		t.Fatalf("actual %v, expected %v", mapping, expected)
+	}
+
+	invalid := filepath.Join(dir, "invalid.json")
+	if err := os.WriteFile(invalid, []byte(`["login1"]`), 0o600); err != nil {
+		t.Fatalf("error writing mapping: %v", err)
+	}
+	if _, err := readJiraAccountMapping(invalid); err == nil {
+		t.Fatalf("expected an error for a mapping that isn't an object")
+	}
+
+	if _, err := readJiraAccountMapping(filepath.Join(dir, "missing.json")); err == nil {
+		t.Fatalf("expected an error for a missing mapping")
+	}
+}
+
+func TestNewJiraChannelRequiresAccounts(t *testing.T) {
+	apprv, err := newApprovalEnvironment(approvalOptions{
+		repoFullName:        "owner/repo",
+		repoOwner:           "owner",
+		runID:               1234,
+		issueApprovers:      []string{"login1", "login2"},
+		minimumApprovals:    2,
+		targetRepoOwner:     "owner",
+		targetRepoName:      "repo",
+		failOnDenial:        true,
+		editedCommentPolicy: editedCommentPolicyReevaluate,
+		commentSyntax:       approval.CommentSyntaxKeywords,
+		target:              approvalTargetIssue,
+	})
+	if err != nil {
+		t.Fatalf("error creating approval environment: %v", err)
+	}
+	_, err = newJiraChannel(approvalTargetIssue, apprv, &jiraClient{}, "OPS", "", defaultJiraIssueType, []string{defaultJiraApprovedStatus}, []string{defaultJiraDeniedStatus}, map[string]string{"LOGIN1": "account-1"})
+	if err == nil || !strings.Contains(err.Error(), "login2") {
+		t.Fatalf("expected an error naming login2, got %v", err)
+	}
+}
+
+func TestJiraRunApproval(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	at := func(minutes int) string {
+		return start.Add(time.Duration(minutes) * time.Minute).Format(jiraTestTimeLayout)
+	}
+	comment := func(id int, accountID, body string) map[string]interface{} {
+		return map[string]interface{}{
+			"id":      strconv.Itoa(id),
+			"body":    body,
+			"author":  map[string]string{"accountId": accountID},
+			"created": at(id),
+			"updated": at(id),
+		}
+	}
+	transition := func(minutes int, accountID, from, to string) map[string]interface{} {
+		return map[string]interface{}{
+			"id":      fmt.Sprintf("cl-%d", minutes),
+			"author":  map[string]string{"accountId": accountID},
+			"created": at(minutes),
+			"items": []map[string]string{
+				{"field": "assignee", "fromString": "", "toString": "Login One"},
+				{"field": "status", "fromString": from, "toString": to},
+			},
+		}
+	}
+
+	testCases := []struct {
+		name             string
+		issueKey         string
+		polls            []jiraPoll
+		expectedExitCode int
+		expectedStatus   string
+		expectedKey      string
+	}{
+		{
+			name: "approved_by_transition_and_comment",
+			polls: []jiraPoll{
+				{changelogs: []map[string]interface{}{transition(1, "account-1", "To Do", "Approved")}},
+				{comments: []map[string]interface{}{comment(2, "account-2", "lgtm")}},
+			},
+			expectedExitCode: 0,
+			expectedStatus:   "approval-status=approved",
+			expectedKey:      "OPS-7",
+		},
+		{
+			name: "denied_by_transition",
+			polls: []jiraPoll{
+				{changelogs: []map[string]interface{}{transition(1, "account-2", "To Do", "rejected")}},
+			},
+			expectedExitCode: 1,
+			expectedStatus:   "approval-status=denied",
+			expectedKey:      "OPS-7",
+		},
+		{
+			name: "transition_by_others_ignored",
+			polls: []jiraPoll{
+				{changelogs: []map[string]interface{}{transition(1, "account-3", "To Do", "Rejected")}},
+				{comments: []map[string]interface{}{comment(2, "account-1", "approve"), comment(3, "account-2", "approved")}},
+			},
+			expectedExitCode: 0,
+			expectedStatus:   "approval-status=approved",
+			expectedKey:      "OPS-7",
+		},
+		{
+			name:     "existing_issue_ignores_earlier_votes",
+			issueKey: "OPS-5",
+			polls: []jiraPoll{
+				{
+					changelogs: []map[string]interface{}{transition(-10, "account-2", "To Do", "Rejected")},
+					comments:   []map[string]interface{}{comment(-5, "account-1", "deny")},
+				},
+				{changelogs: []map[string]interface{}{transition(3, "account-2", "Rejected", "Approved")}},
+				{comments: []map[string]interface{}{comment(4, "account-1", "yes")}},
+			},
+			expectedExitCode: 0,
+			expectedStatus:   "approval-status=approved",
+			expectedKey:      "OPS-5",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			fake := &fakeJira{markerAt: start, polls: testCase.polls}
+			serverURL := fake.serve(t, func(r *http.Request) bool {
+				user, token, ok := r.BasicAuth()
+				return ok && user == "bot@example.com" && token == "jira-secret"
+			}, fake.route)
+			t.Setenv(envVarJiraURL, serverURL+"/")
+			t.Setenv(envVarJiraUser, "bot@example.com")
+			t.Setenv(envVarJiraToken, "jira-secret")
+
+			apprv, err := newApprovalEnvironment(approvalOptions{
+				repoFullName:        "owner/repo",
+				repoOwner:           "owner",
+				runID:               1234,
+				issueApprovers:      []string{"login1", "login2"},
+				minimumApprovals:    2,
+				targetRepoOwner:     "owner",
+				targetRepoName:      "repo",
+				failOnDenial:        true,
+				issueLabels:         []string{"deploy"},
+				editedCommentPolicy: editedCommentPolicyReevaluate,
+				commentSyntax:       approval.CommentSyntaxKeywords,
+				target:              approvalTargetIssue,
+			})
+			if err != nil {
+				t.Fatalf("error creating approval environment: %v", err)
+			}
+			accounts := map[string]string{"login1": "account-1", "login2": "account-2", "login3": "account-3"}
+			requestChannel, err := newJiraChannel(approvalTargetIssue, apprv, newJiraClient(inputs{}), "OPS", testCase.issueKey, defaultJiraIssueType, []string{defaultJiraApprovedStatus}, []string{defaultJiraDeniedStatus}, accounts)
+			if err != nil {
+				t.Fatalf("error creating channel: %v", err)
+			}
+
+			issueNumber := strings.TrimPrefix(testCase.expectedKey, "OPS-")
+			runTestApproval(t, apprv, requestChannel, testCase.expectedExitCode,
+				testCase.expectedStatus,
+				"jira-issue-key="+testCase.expectedKey,
+				"issue-number="+issueNumber,
+				"issue-url="+serverURL+"/browse/"+testCase.expectedKey,
+			)
+
+			fake.mu.Lock()
+			defer fake.mu.Unlock()
+			if testCase.issueKey != "" {
+				if fake.createdFields != nil {
+					t.Fatalf("expected no issue to be created for an existing issue")
+				}
+				if len(fake.postedComments) == 0 || !strings.Contains(fake.postedComments[0], "Required approvers") {
+					t.Fatalf("expected the approval request as the first comment, got %q", fake.postedComments)
+				}
+				return
+			}
+			if !reflect.DeepEqual(fake.createdFields["assignee"], map[string]interface{}{"accountId": "account-1"}) {
+				t.Fatalf("assignee %v, expected account-1", fake.createdFields["assignee"])
+			}
+			if !reflect.DeepEqual(fake.createdFields["project"], map[string]interface{}{"key": "OPS"}) {
+				t.Fatalf("project %v, expected OPS", fake.createdFields["project"])
+			}
+			if !reflect.DeepEqual(fake.createdFields["labels"], []interface{}{"deploy"}) {
+				t.Fatalf("labels %v, expected [deploy]", fake.createdFields["labels"])
+			}
+			description, _ := fake.createdFields["description"].(string)
+			if !strings.Contains(description, "[~accountid:account-1]") || !strings.Contains(description, "[~accountid:account-2]") || strings.Contains(description, "@login") {
+				t.Fatalf("description %q doesn't mention the approvers by account", description)
+			}
+		})
+	}
+}
+
+func TestNewJiraChannelRejectsIssueOnlyInputs(t *testing.T) {
+	for name, apprv := range issueOnlyInputs() {
+		t.Run(name, func(t *testing.T) {
+			if _, err := newJiraChannel(approvalTargetIssue, apprv, &jiraClient{}, "OPS", "", defaultJiraIssueType, []string{defaultJiraApprovedStatus}, []string{defaultJiraDeniedStatus}, nil); err == nil {
+				t.Fatalf("expected an error")
+			}
+		})
+	}
+}
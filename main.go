@@ -2,7 +2,10 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"net/url"
 	"os"
 	"os/signal"
@@ -12,183 +15,19 @@ import (
 
 	"github.com/google/go-github/v43/github"
 	"golang.org/x/oauth2"
-)
-
-// patchIssueState closes or otherwise updates an issue's state without decoding
-// the response body into a github.Issue. go-github's Issues.Edit decodes the
-// response into github.Issue, which fails against Forgejo because its issue
-// response embeds "repository.owner" as a plain string rather than a User object.
-func patchIssueState(ctx context.Context, client *github.Client, owner, repo string, number int, state string) error {
-	req, err := client.NewRequest("PATCH",
-		fmt.Sprintf("repos/%s/%s/issues/%d", owner, repo, number),
-		&github.IssueRequest{State: &state},
-	)
-	if err != nil {
-		return err
-	}
-	_, err = client.Do(ctx, req, nil)
-	return err
-}
-
-func handleInterrupt(ctx context.Context, client *github.Client, apprv *approvalEnvironment) {
-	newState := "closed"
-	closeComment := "Workflow cancelled, closing issue."
 
-	fmt.Println(closeComment)
-	_, _, err := client.Issues.CreateComment(ctx, apprv.targetRepoOwner, apprv.targetRepoName, apprv.approvalIssueNumber, &github.IssueComment{
-		Body: &closeComment,
-	})
-	if err != nil {
-		fmt.Printf("error commenting on issue: %v\n", err)
-		return
-	}
-	if err = patchIssueState(ctx, client, apprv.targetRepoOwner, apprv.targetRepoName, apprv.approvalIssueNumber, newState); err != nil {
-		fmt.Printf("error closing issue: %v\n", err)
-		return
-	}
-}
-
-func newCommentLoopChannel(ctx context.Context, apprv *approvalEnvironment, client *github.Client, pollingInterval time.Duration) chan int {
-	channel := make(chan int)
-	go func() {
-		loop_ctr := 0 
-		for {
-			comments, _, err := client.Issues.ListComments(ctx, apprv.targetRepoOwner, apprv.targetRepoName, apprv.approvalIssueNumber, &github.IssueListCommentsOptions{})
-			if err != nil {
-				fmt.Printf("error getting comments: %v\n", err)
-				channel <- 1
-				close(channel)
-				return
-			}
-
-			approved, err := approvalFromComments(comments, apprv.issueApprovers, apprv.minimumApprovals)
-			if err != nil {
-				fmt.Printf("error getting approval from comments: %v\n", err)
-				channel <- 1
-				close(channel)
-				return
-			}
-			fmt.Printf("Workflow status: %s\n", approved)
-			switch approved {
-			case approvalStatusApproved:
-				newState := "closed"
-				closeComment := fmt.Sprintf("The required number of approvals (%d) has been met; continuing workflow and closing this issue.", apprv.minimumApprovals)
-				_, _, err := client.Issues.CreateComment(ctx, apprv.targetRepoOwner, apprv.targetRepoName, apprv.approvalIssueNumber, &github.IssueComment{
-					Body: &closeComment,
-				})
-				if err != nil {
-					fmt.Printf("error commenting on issue: %v\n", err)
-					channel <- 1
-					close(channel)
-					return
-				}
-				if err = patchIssueState(ctx, client, apprv.targetRepoOwner, apprv.targetRepoName, apprv.approvalIssueNumber, newState); err != nil {
-					fmt.Printf("error closing issue: %v\n", err)
-					channel <- 1
-					close(channel)
-					return
-				}
-				channel <- 0
-				fmt.Println("Workflow manual approval completed")
-				close(channel)
-				return
-			case approvalStatusDenied:
-				newState := "closed"
-				closeComment := "Request denied. Closing issue "
-				if !apprv.failOnDenial {
-					closeComment += "but continuing"
-				} else {
-					closeComment += "and failing"
-				}
-				closeComment += " workflow."
-
-				_, _, err := client.Issues.CreateComment(ctx, apprv.targetRepoOwner, apprv.targetRepoName, apprv.approvalIssueNumber, &github.IssueComment{
-					Body: &closeComment,
-				})
-				if err != nil {
-					fmt.Printf("error commenting on issue: %v\n", err)
-					channel <- 1
-					close(channel)
-					return
-				}
-				if err = patchIssueState(ctx, client, apprv.targetRepoOwner, apprv.targetRepoName, apprv.approvalIssueNumber, newState); err != nil {
-					fmt.Printf("error closing issue: %v\n", err)
-					channel <- 1
-					close(channel)
-					return
-				}
-				channel <- 1
-				close(channel)
-				return
-			case approvalStatusPending:
-				if apprv.closeIssueMeansDenial {
-					// Loop counter to make an API call only once per 10 interation, intention: avoid github rate limiting and reduce api cost and stress.
-					if loop_ctr < 10 {
-						loop_ctr += 1
-						continue
-					}
-					loop_ctr = 0 
-
-					issue, _, err := client.Issues.Get(
-
-						ctx,
-						apprv.targetRepoOwner,
-						apprv.targetRepoName,
-						apprv.approvalIssueNumber,
-					)
-					if err != nil {
-						fmt.Printf("error fetching issue state: %v\n", err)
-						channel <- 1
-						close(channel)
-
-						return
-					}
-
-					if issue.GetState() == "closed" {
-
-						// Issue was closed externally without any approval/denial comment.
-						// Treat as denial per user configuration.
-						denyComment := "Issue was closed without approval. Treating closure as denial"
-
-						if !apprv.failOnDenial {
-							denyComment += " but continuing workflow."
-						} else {
-							denyComment += " and failing workflow."
-						}
-						fmt.Println(denyComment)
-						// Issue is already closed — add comment only, skip re-closing
-						_, _, err := client.Issues.CreateComment(
-							ctx,
-							apprv.targetRepoOwner,
-							apprv.targetRepoName,
-							apprv.approvalIssueNumber,
-							&github.IssueComment{Body: &denyComment},
-						)
-						if err != nil {
-							fmt.Printf("error commenting on closed issue: %v\n", err)
-						}
-						channel <- 1
-						close(channel)
-						return
-					}
-				}
-			}
-
-			time.Sleep(pollingInterval)
-		}
-	}()
-	return channel
-}
+	"github.com/trstringer/manual-approval/pkg/approval"
+)
 
-func newGithubClient(ctx context.Context) (*github.Client, error) {
-	token := os.Getenv(envVarToken)
+func newGithubClient(ctx context.Context, in inputs) (*github.Client, error) {
+	token := in.get(envVarToken)
 	ts := oauth2.StaticTokenSource(
 		&oauth2.Token{AccessToken: token},
 	)
 	tc := oauth2.NewClient(ctx, ts)
 
-	serverUrl, serverUrlPresent := os.LookupEnv("GITHUB_SERVER_URL")
-	apiUrl, apiUrlPresent := os.LookupEnv("GITHUB_API_URL")
+	serverUrl, serverUrlPresent := in.lookup("GITHUB_SERVER_URL")
+	apiUrl, apiUrlPresent := in.lookup(envVarAPIURL)
 
 	if !serverUrlPresent && !apiUrlPresent {
 		return github.NewClient(tc), nil
@@ -216,185 +55,570 @@ func newGithubClient(ctx context.Context) (*github.Client, error) {
 	return client, nil
 }
 
-func validateInput() error {
+func validateInput(in inputs) error {
 	missingEnvVars := []string{}
-	if os.Getenv(envVarRepoFullName) == "" {
+	if in.get(envVarRepoFullName) == "" {
 		missingEnvVars = append(missingEnvVars, envVarRepoFullName)
 	}
 
-	if os.Getenv(envVarRunID) == "" {
+	// Outside of GitHub Actions, run-url can link to the run instead.
+	if in.get(envVarRunID) == "" && in.get(envVarRunURL) == "" {
 		missingEnvVars = append(missingEnvVars, envVarRunID)
 	}
 
-	if os.Getenv(envVarRepoOwner) == "" {
+	if in.get(envVarRepoOwner) == "" {
 		missingEnvVars = append(missingEnvVars, envVarRepoOwner)
 	}
 
-	if os.Getenv(envVarToken) == "" {
+	if in.get(envVarToken) == "" {
 		missingEnvVars = append(missingEnvVars, envVarToken)
 	}
 
-	if os.Getenv(envVarApprovers) == "" {
-		missingEnvVars = append(missingEnvVars, envVarApprovers)
-	}
-
 	if len(missingEnvVars) > 0 {
 		return fmt.Errorf("missing env vars: %v", missingEnvVars)
 	}
 	return nil
 }
 
+// splitRepoFullName splits a repository's full name into its owner and name.
+// GitLab projects can be nested in subgroups, so the owner is everything up
+// to the last slash.
+func splitRepoFullName(repoFullName string) (string, string, error) {
+	separator := strings.LastIndex(repoFullName, "/")
+	if separator < 1 || separator == len(repoFullName)-1 {
+		return "", "", fmt.Errorf("error: repository %q is not of the form owner/name", repoFullName)
+	}
+	return repoFullName[:separator], repoFullName[separator+1:], nil
+}
+
 func main() {
-	if err := validateInput(); err != nil {
-		fmt.Printf("%v\n", err)
-		os.Exit(1)
+	in := inputs{}
+	format := outputFormatText
+	if len(os.Args) > 1 {
+		var err error
+		in, format, err = parseCommandLine(os.Args[1:], os.Stderr)
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error parsing command line: %v\n", err)
+			os.Exit(2)
+		}
 	}
+	// The outputs are printed on stdout, so the log goes to stderr.
+	var log io.Writer = os.Stdout
+	if format == outputFormatJSON {
+		log = os.Stderr
+	}
+
+	killSignalChannel := make(chan os.Signal, 1)
+	signal.Notify(killSignalChannel, os.Interrupt)
 
-	targetRepoName := os.Getenv(envVarTargetRepo)
-	targetRepoOwner := os.Getenv(envVarTargetRepoOwner)
+	os.Exit(run(context.Background(), in, format, os.Stdout, log, killSignalChannel, connectBackend))
+}
 
-	repoFullName := os.Getenv(envVarRepoFullName)
-	runID, err := strconv.Atoi(os.Getenv(envVarRunID))
+// run reads the inputs, makes the approval request through the backend that
+// connect connects to, waits for it to be decided or interrupted and returns
+// the exit code. The progress is logged to log. With the JSON output format,
+// the outputs are printed on stdout.
+func run(ctx context.Context, in inputs, format outputFormat, stdout, log io.Writer, interrupt <-chan os.Signal, connect backendConnector) int {
+	selectedBackend, err := parseBackend(log, in.get(envVarBackend))
+	if err != nil {
+		fmt.Fprintf(log, "error parsing backend: %v\n", err)
+		return 1
+	}
+
+	switch selectedBackend {
+	case backendGitLab:
+		err = validateGitLabInput(in)
+	case backendAzureDevOps:
+		err = validateAzureDevOpsInput(in)
+	case backendJira:
+		err = validateJiraInput(in)
+	case backendServiceNow:
+		err = validateServiceNowInput(in)
+	default:
+		err = validateInput(in)
+	}
 	if err != nil {
-		fmt.Printf("error getting runID: %v\n", err)
-		os.Exit(1)
+		fmt.Fprintf(log, "%v\n", err)
+		return 1
+	}
+
+	targetRepoName := in.get(envVarTargetRepo)
+	targetRepoOwner := in.get(envVarTargetRepoOwner)
+
+	repoFullName := in.get(envVarRepoFullName)
+	runIDRaw := in.get(envVarRunID)
+	repoOwner := in.get(envVarRepoOwner)
+	workflowInitiator := in.get(envVarWorkflowInitiator)
+	switch selectedBackend {
+	case backendGitLab:
+		repoFullName = in.get(envVarGitLabProjectPath)
+		runIDRaw = in.get(envVarGitLabPipelineID)
+		repoOwner = in.get(envVarGitLabProjectNamespace)
+		workflowInitiator = in.get(envVarGitLabUserLogin)
+	case backendAzureDevOps:
+		// Work items belong to the project, so the repository only names
+		// the request.
+		repoOwner = in.get(envVarAzureTeamProject)
+		repoName := in.get(envVarAzureRepositoryName)
+		if repoName == "" {
+			repoName = repoOwner
+		}
+		repoFullName = repoOwner + "/" + repoName
+		runIDRaw = in.get(envVarAzureBuildID)
+		workflowInitiator = in.get(envVarAzureRequestedFor)
+	}
+	runID := 0
+	if runIDRaw != "" {
+		runID, err = strconv.Atoi(runIDRaw)
+		if err != nil {
+			fmt.Fprintf(log, "error getting runID: %v\n", err)
+			return 1
+		}
 	}
-	repoOwner := os.Getenv(envVarRepoOwner)
 
 	if targetRepoName == "" || targetRepoOwner == "" {
-		parts := strings.SplitN(repoFullName, "/", 2)
-		targetRepoOwner = parts[0]
-		targetRepoName = parts[1]
+		targetRepoOwner, targetRepoName, err = splitRepoFullName(repoFullName)
+		if err != nil {
+			fmt.Fprintf(log, "%v\n", err)
+			return 1
+		}
 	}
 
-	ctx := context.Background()
-	client, err := newGithubClient(ctx)
+	connection, err := connect(ctx, in, log, selectedBackend, repoOwner, repoFullName)
 	if err != nil {
-		fmt.Printf("error connecting to server: %v\n", err)
-		os.Exit(1)
+		fmt.Fprintf(log, "%v\n", err)
+		return 1
 	}
-
-	approvers, err := retrieveApprovers(client, repoOwner)
+	client := connection.client
+	expandGroup := connection.expandGroup
+	_, repoName, _ := strings.Cut(repoFullName, "/")
+
+	// The policy's values stand in for the inputs that weren't given, so it
+	// is applied before any of them is read.
+	configFile := strings.TrimSpace(in.get(envVarConfigFile))
+	optionalConfig := configFile == "" && strings.TrimSpace(in.get(envVarPolicy)) == ""
+	if configFile == "" {
+		configFile = defaultConfigFile
+	}
+	config, err := readApprovalConfig(ctx, log, client, targetRepoOwner, targetRepoName, configFile, optionalConfig)
 	if err != nil {
-		fmt.Printf("error retrieving approvers: %v\n", err)
-		os.Exit(1)
+		fmt.Fprintf(log, "error reading config file: %v\n", err)
+		return 1
+	}
+	event, err := readWorkflowEvent()
+	if err != nil {
+		fmt.Fprintf(log, "error reading workflow event: %v\n", err)
+		return 1
+	}
+	policyName := strings.TrimSpace(in.get(envVarPolicy))
+	policyReason := ""
+	var policy approvalPolicy
+	if config != nil {
+		policyName, policyReason = config.selectPolicy(policyName, event)
+		var found bool
+		policy, policyName, found, err = config.policy(policyName)
+		if err != nil {
+			fmt.Fprintf(log, "error selecting policy from %s: %v\n", configFile, err)
+			return 1
+		}
+		if !found {
+			policyName = ""
+		}
+	} else if policyName != "" {
+		fmt.Fprintf(log, "error: policy %q is selected, but there is no %s\n", policyName, configFile)
+		return 1
+	}
+	if policyName != "" {
+		fmt.Fprintf(log, "Using policy %q from %s, because %s\n", policyName, configFile, policyReason)
+		in = in.withPolicy(policy)
+	}
+	codeownersMode, err := parseCodeownersMode(in.get(envVarApproversFromCodeowners))
+	if err != nil {
+		fmt.Fprintf(log, "error parsing approvers-from-codeowners: %v\n", err)
+		return 1
+	}
+	if codeownersMode != codeownersOff && selectedBackend != backendGitHub {
+		fmt.Fprintf(log, "error: approvers-from-codeowners is only supported with the %q backend\n", backendGitHub)
+		return 1
+	}
+	if expandGroup != nil && codeownersMode == codeownersOff && in.get(envVarApprovers) == "" {
+		fmt.Fprintf(log, "missing env vars: %v\n", []string{envVarApprovers})
+		return 1
+	}
+	// Backends that don't expand approvers take them from the tracker, so
+	// the input would be silently ignored.
+	if expandGroup == nil && strings.TrimSpace(in.get(envVarApprovers)) != "" {
+		fmt.Fprintf(log, "error: approvers is not supported with the %s backend, whose own rules decide who approves\n", selectedBackend)
+		return 1
+	}
+
+	var approvers []string
+	var roleApprovers map[string]repositoryRole
+	var areas []approval.Area
+	if codeownersMode != codeownersOff {
+		approvers, areas, err = retrieveCodeowners(ctx, in, log, client, repoOwner, repoName, event, workflowInitiator)
+		if err != nil {
+			fmt.Fprintf(log, "error retrieving approvers from CODEOWNERS: %v\n", err)
+			return 1
+		}
+		if codeownersMode != codeownersPerArea {
+			areas = nil
+		}
+	} else if expandGroup != nil {
+		approvers, roleApprovers, err = retrieveApprovers(in, log, expandGroup, connection.expandTeams, connection.expandRole, workflowInitiator)
+		if err != nil {
+			fmt.Fprintf(log, "error retrieving approvers: %v\n", err)
+			return 1
+		}
 	}
 
 	failOnDenial := true
-	failOnDenialRaw := os.Getenv(envVarFailOnDenial)
+	failOnDenialRaw := in.get(envVarFailOnDenial)
 	if failOnDenialRaw != "" {
 		failOnDenial, err = strconv.ParseBool(failOnDenialRaw)
 		if err != nil {
-			fmt.Printf("error parsing fail on denial: %v\n", err)
-			os.Exit(1)
+			fmt.Fprintf(log, "error parsing fail on denial: %v\n", err)
+			return 1
 		}
 	}
 
 	closeIssueMeansDenial := false
-	closeIssueMeansDenialRaw := os.Getenv(envVarCloseIssueMeansDenial)
+	closeIssueMeansDenialRaw := in.get(envVarCloseIssueMeansDenial)
 	if closeIssueMeansDenialRaw != "" {
 		closeIssueMeansDenial, err = strconv.ParseBool(closeIssueMeansDenialRaw)
 		if err != nil {
-			fmt.Printf("error parsing close-issue-means-denial: %v\n", err)
-			os.Exit(1)
+			fmt.Fprintf(log, "error parsing close-issue-means-denial: %v\n", err)
+			return 1
+		}
+	}
+
+	editedCommentPolicy, err := parseEditedCommentPolicy(in.get(envVarEditedComments))
+	if err != nil {
+		fmt.Fprintf(log, "error parsing edited-comments: %v\n", err)
+		return 1
+	}
+
+	approvedWords := append(append([]string{}, approval.DefaultApprovedWords...), readAdditionalWords(in, envVarAdditionalApprovedWords)...)
+	deniedWords := append(append([]string{}, approval.DefaultDeniedWords...), readAdditionalWords(in, envVarAdditionalDeniedWords)...)
+
+	commentSyntax, err := approval.ParseCommentSyntax(in.get(envVarCommentSyntax))
+	if err != nil {
+		fmt.Fprintf(log, "error parsing comment-syntax: %v\n", err)
+		return 1
+	}
+
+	var reactionMapping map[string]approval.Action
+	allowReactionsRaw := in.get(envVarAllowReactions)
+	if allowReactionsRaw != "" {
+		allowReactions, err := strconv.ParseBool(allowReactionsRaw)
+		if err != nil {
+			fmt.Fprintf(log, "error parsing allow-reactions: %v\n", err)
+			return 1
+		}
+		if allowReactions {
+			approvalReactions := in.get(envVarApprovalReactions)
+			if approvalReactions == "" {
+				approvalReactions = defaultApprovalReactions
+			}
+			denialReactions := in.get(envVarDenialReactions)
+			if denialReactions == "" {
+				denialReactions = defaultDenialReactions
+			}
+			reactionMapping, err = parseReactionMapping(approvalReactions, denialReactions)
+			if err != nil {
+				fmt.Fprintf(log, "error parsing reactions: %v\n", err)
+				return 1
+			}
 		}
 	}
 
+	target, err := parseApprovalTarget(in.get(envVarTarget))
+	if err != nil {
+		fmt.Fprintf(log, "error parsing target: %v\n", err)
+		return 1
+	}
+
+	checklist := parseChecklist(in.get(envVarChecklist))
+
+	issueClosers := []string{}
+	for _, closer := range strings.Split(in.get(envVarIssueClosers), ",") {
+		if trimmed := strings.TrimSpace(closer); trimmed != "" {
+			issueClosers = append(issueClosers, trimmed)
+		}
+	}
+
+	closeIssueAsVote := false
+	closeIssueAsVoteRaw := in.get(envVarCloseIssueAsVote)
+	if closeIssueAsVoteRaw != "" {
+		closeIssueAsVote, err = strconv.ParseBool(closeIssueAsVoteRaw)
+		if err != nil {
+			fmt.Fprintf(log, "error parsing close-issue-as-vote: %v\n", err)
+			return 1
+		}
+	}
+	if closeIssueAsVote && closeIssueMeansDenial {
+		fmt.Fprintf(log, "error: close-issue-as-vote and close-issue-means-denial can't both be enabled\n")
+		return 1
+	}
+
+	existingIssueNumber := 0
+	existingIssueNumberRaw := in.get(envVarIssueNumber)
+	if existingIssueNumberRaw != "" {
+		existingIssueNumber, err = strconv.Atoi(existingIssueNumberRaw)
+		if err != nil || existingIssueNumber <= 0 {
+			fmt.Fprintf(log, "error parsing issue-number: %q is not a valid issue number\n", existingIssueNumberRaw)
+			return 1
+		}
+		if target != approvalTargetIssue {
+			fmt.Fprintf(log, "error: issue-number can only be used with target %q\n", approvalTargetIssue)
+			return 1
+		}
+		if len(checklist) > 0 {
+			fmt.Fprintf(log, "error: checklist can't be used with issue-number, as approvers can only tick items in the issue body\n")
+			return 1
+		}
+	}
+
+	closeExistingIssue := false
+	closeExistingIssueRaw := in.get(envVarCloseExistingIssue)
+	if closeExistingIssueRaw != "" {
+		closeExistingIssue, err = strconv.ParseBool(closeExistingIssueRaw)
+		if err != nil {
+			fmt.Fprintf(log, "error parsing close-existing-issue: %v\n", err)
+			return 1
+		}
+	}
+
+	discussionCategory := strings.TrimSpace(in.get(envVarDiscussionCategory))
+	if target == approvalTargetDiscussion && discussionCategory == "" {
+		fmt.Fprintf(log, "error: discussion-category is required with target %q\n", approvalTargetDiscussion)
+		return 1
+	}
+
 	pollingInterval := defaultPollingInterval
-	pollingIntervalSecondsRaw := os.Getenv(envVarPollingIntervalSeconds)
+	pollingIntervalSecondsRaw := in.get(envVarPollingIntervalSeconds)
 	if pollingIntervalSecondsRaw != "" {
 		pollingIntervalSeconds, err := strconv.Atoi(pollingIntervalSecondsRaw)
 		if err != nil {
-			fmt.Printf("error parsing polling interval: %v\n", err)
-			os.Exit(1)
+			fmt.Fprintf(log, "error parsing polling interval: %v\n", err)
+			return 1
 		}
 		if pollingIntervalSeconds <= 0 {
-			fmt.Printf("error: polling interval must be greater than 0\n")
-			os.Exit(1)
+			fmt.Fprintf(log, "error: polling interval must be greater than 0\n")
+			return 1
 		}
 		pollingInterval = time.Duration(pollingIntervalSeconds) * time.Second
 	}
 
-	issueTitle := os.Getenv(envVarIssueTitle)
+	issueTitle := in.get(envVarIssueTitle)
 	var issueBody string
-	if os.Getenv(envVarIssueBodyFilePath) != "" {
-		fileContents, err := os.ReadFile(os.Getenv(envVarIssueBodyFilePath))
+	if in.get(envVarIssueBodyFilePath) != "" {
+		fileContents, err := os.ReadFile(in.get(envVarIssueBodyFilePath))
 		if err != nil {
-			fmt.Printf("error reading issue body file: %v\n", err)
-			os.Exit(1)
+			fmt.Fprintf(log, "error reading issue body file: %v\n", err)
+			return 1
 		}
 		issueBody = string(fileContents)
 	} else {
-		issueBody = os.Getenv(envVarIssueBody)
+		issueBody = in.get(envVarIssueBody)
 	}
-	minimumApprovalsRaw := os.Getenv(envVarMinimumApprovals)
+	minimumApprovalsRaw := in.get(envVarMinimumApprovals)
 	minimumApprovals := 0
 	if minimumApprovalsRaw != "" {
 		minimumApprovals, err = strconv.Atoi(minimumApprovalsRaw)
 		if err != nil {
-			fmt.Printf("error parsing minimum approvals: %v\n", err)
-			os.Exit(1)
+			fmt.Fprintf(log, "error parsing minimum approvals: %v\n", err)
+			return 1
 		}
+	} else if codeownersMode == codeownersPerArea {
+		// Each area needs an approval anyway, so one from any owner is
+		// enough beyond that.
+		minimumApprovals = 1
 	}
 
-	parts := strings.Split(os.Getenv(envVarIssueLabels), ",")
+	parts := strings.Split(in.get(envVarIssueLabels), ",")
 	issueLabels := make([]string, 0, len(parts))
 	for _, label := range parts {
 		if trimmed := strings.TrimSpace(label); trimmed != "" {
 			issueLabels = append(issueLabels, trimmed)
 		}
 	}
-	fmt.Printf("Parsed %d labels", len(issueLabels))
+	fmt.Fprintf(log, "Parsed %d labels", len(issueLabels))
+
+	workflowRunURL := in.get(envVarRunURL)
+	if workflowRunURL == "" {
+		workflowRunURL = connection.runURL
+	}
+	if workflowRunURL == "" {
+		workflowRunURL = githubRunURL(in.get(envVarServerURL), repoFullName, runID)
+	}
 
-	apprv, err := newApprovalEnvironment(client, repoFullName, repoOwner, runID, approvers, minimumApprovals, issueTitle, issueBody, targetRepoOwner, targetRepoName, failOnDenial, closeIssueMeansDenial, issueLabels)
+	apprv, err := newApprovalEnvironment(approvalOptions{
+		repoFullName:          repoFullName,
+		repoOwner:             repoOwner,
+		runID:                 runID,
+		issueTitle:            issueTitle,
+		issueBody:             issueBody,
+		issueLabels:           issueLabels,
+		issueApprovers:        approvers,
+		requiredApprovers:     readAdditionalWords(in, envVarRequiredApprovers),
+		areas:                 areas,
+		minimumApprovals:      minimumApprovals,
+		targetRepoOwner:       targetRepoOwner,
+		targetRepoName:        targetRepoName,
+		failOnDenial:          failOnDenial,
+		closeIssueMeansDenial: closeIssueMeansDenial,
+		editedCommentPolicy:   editedCommentPolicy,
+		commentSyntax:         commentSyntax,
+		approvedWords:         approvedWords,
+		deniedWords:           deniedWords,
+		reactionMapping:       reactionMapping,
+		closeIssueAsVote:      closeIssueAsVote,
+		issueClosers:          issueClosers,
+		checklist:             checklist,
+		target:                target,
+		existingIssueNumber:   existingIssueNumber,
+		closeExistingIssue:    closeExistingIssue,
+		discussionCategory:    discussionCategory,
+		log:                   log,
+		workflowRunURL:        workflowRunURL,
+		policy:                policyName,
+		policyReason:          policyReason,
+		timeout:               time.Duration(policy.TimeoutMinutes) * time.Minute,
+	})
 	if err != nil {
-		fmt.Printf("error creating approval environment: %v\n", err)
-		os.Exit(1)
+		fmt.Fprintf(log, "error creating approval environment: %v\n", err)
+		return 1
 	}
 
-	err = apprv.createApprovalIssue(ctx)
+	requestChannel, err := connection.newChannel(apprv)
 	if err != nil {
-		fmt.Printf("error creating issue: %v\n", err)
-		os.Exit(1)
+		fmt.Fprintf(log, "error creating approval channel: %v\n", err)
+		return 1
+	}
+	if len(roleApprovers) > 0 {
+		requestChannel = &roleCheckingChannel{
+			Channel:       requestChannel,
+			roleApprovers: roleApprovers,
+			permission:    connection.permission,
+			log:           log,
+		}
+	}
+
+	exitCode := runApproval(ctx, apprv, requestChannel, pollingInterval, interrupt)
+	if format == outputFormatJSON {
+		if err := printOutputs(stdout, apprv.outputs); err != nil {
+			fmt.Fprintf(log, "error printing outputs: %v\n", err)
+			exitCode = 1
+		}
+	}
+	return exitCode
+}
+
+// runApproval makes the approval request through requestChannel, waits for
+// it to be decided or interrupted, sets the action outputs and returns the
+// exit code.
+func runApproval(ctx context.Context, apprv *approvalEnvironment, requestChannel approval.Channel, pollingInterval time.Duration, interrupt <-chan os.Signal) int {
+	request := &approval.Request{
+		Channel:         requestChannel,
+		Evaluator:       apprv.evaluator,
+		PollingInterval: pollingInterval,
+		Logf: func(format string, args ...interface{}) {
+			fmt.Fprintf(apprv.log, format+"\n", args...)
+		},
+	}
+
+	if err := request.Open(ctx); err != nil {
+		fmt.Fprintf(apprv.log, "%v\n", err)
+		return 1
 	}
 
 	outputs := map[string]string{
 		"issue-number": fmt.Sprintf("%d", apprv.approvalIssueNumber),
 		"issue-url":    apprv.approvalIssue.GetHTMLURL(),
 	}
-	_, err = apprv.SetActionOutputs(outputs)
+	if apprv.policy != "" {
+		outputs["policy"] = apprv.policy
+		outputs["policy-reason"] = apprv.policyReason
+	}
+	_, err := apprv.SetActionOutputs(outputs)
 	if err != nil {
-		fmt.Printf("error saving output: %v\n", err)
-		os.Exit(1)
+		fmt.Fprintf(apprv.log, "error saving output: %v\n", err)
+		return 1
 	}
 
-	killSignalChannel := make(chan os.Signal, 1)
-	signal.Notify(killSignalChannel, os.Interrupt)
-
-	commentLoopChannel := newCommentLoopChannel(ctx, apprv, client, pollingInterval)
-
-	select {
-	case exitCode := <-commentLoopChannel:
-		approvalStatus := ""
-
-		if !failOnDenial && exitCode == 1 {
-			approvalStatus = "denied"
-			exitCode = 0
-		} else if exitCode == 1 {
-			approvalStatus = "denied"
-		} else {
-			approvalStatus = "approved"
+	// A policy's timeout bounds the wait, and an interrupt ends it.
+	var cancel context.CancelFunc
+	if apprv.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, apprv.timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+	go func() {
+		select {
+		case <-interrupt:
+			cancel()
+		case <-ctx.Done():
 		}
-		outputs := map[string]string{
-			"approval-status": approvalStatus,
+	}()
+
+	result, err := request.Wait(ctx)
+	apprv.decision = result.Decision
+	timedOut := false
+	if err != nil && ctx.Err() != nil {
+		// Wait returns ctx.Err() itself unless cancelling the request failed.
+		if err != ctx.Err() {
+			fmt.Fprintf(apprv.log, "%v\n", err)
 		}
-		if _, err := apprv.SetActionOutputs(outputs); err != nil {
-			fmt.Printf("error setting action output: %v\n", err)
-			exitCode = 1
+		if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return 1
 		}
-		os.Exit(exitCode)
-	case <-killSignalChannel:
-		handleInterrupt(ctx, client, apprv)
-		os.Exit(1)
+		fmt.Fprintf(apprv.log, "Approval timed out after %s\n", apprv.timeout)
+		timedOut = true
+	}
+
+	exitCode := 0
+	if timedOut {
+		exitCode = 1
+	} else if err != nil {
+		fmt.Fprintf(apprv.log, "%v\n", err)
+		exitCode = 1
+	} else if result.Approved() {
+		fmt.Fprintln(apprv.log, "Workflow manual approval completed")
+	} else {
+		exitCode = 1
+	}
+
+	approvalStatus := ""
+	if timedOut {
+		approvalStatus = "timed-out"
+	} else if !apprv.failOnDenial && exitCode == 1 {
+		approvalStatus = "denied"
+		exitCode = 0
+	} else if exitCode == 1 {
+		approvalStatus = "denied"
+	} else {
+		approvalStatus = "approved"
+	}
+	outputs = map[string]string{
+		"approval-status": approvalStatus,
+		"decision-reason": apprv.decision.Reasons(),
+	}
+	record, err := apprv.decisionRecord(approvalStatus).JSON()
+	if err != nil {
+		fmt.Fprintf(apprv.log, "error building decision record: %v\n", err)
+		exitCode = 1
+	} else {
+		fmt.Fprintf(apprv.log, "Decision record: %s\n", record)
+		outputs["decision-record"] = record
+	}
+	if _, err := apprv.SetActionOutputs(outputs); err != nil {
+		fmt.Fprintf(apprv.log, "error setting action output: %v\n", err)
+		exitCode = 1
 	}
+	return exitCode
 }
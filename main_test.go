@@ -0,0 +1,367 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v43/github"
+
+	"github.com/trstringer/manual-approval/pkg/approval"
+)
+
+// testComment is a comment on the approval issue, posted at createdAt.
+func testComment(user, body string, createdAt time.Time) *github.IssueComment {
+	return &github.IssueComment{
+		Body:      &body,
+		User:      &github.User{Login: &user},
+		CreatedAt: &createdAt,
+		UpdatedAt: &createdAt,
+	}
+}
+
+func TestRunApproval(t *testing.T) {
+	at := func(minutes int) time.Time {
+		return time.Date(2024, 1, 1, 12, minutes, 0, 0, time.UTC)
+	}
+
+	testCases := []struct {
+		name             string
+		polls            [][]*github.IssueComment
+		minimumApprovals int
+		failOnDenial     bool
+		interrupt        bool
+		timeout          time.Duration
+		expectedExitCode int
+		expectedOutputs  []string
+		expectedComment  string
+	}{
+		{
+			name:             "approved_over_several_polls",
+			polls:            [][]*github.IssueComment{nil, {testComment("login1", "approve", at(1))}, {testComment("login2", "Approved", at(2))}},
+			failOnDenial:     true,
+			expectedExitCode: 0,
+			expectedOutputs:  []string{"issue-number=1", "approval-status=approved", `"status":"approved"`},
+			expectedComment:  "The required number of approvals (0) has been met; continuing workflow and closing this issue.",
+		},
+		{
+			name:             "minimum_approvals_met",
+			polls:            [][]*github.IssueComment{{testComment("login3", "approve", at(1)), testComment("login1", "lgtm", at(2))}},
+			minimumApprovals: 1,
+			failOnDenial:     true,
+			expectedExitCode: 0,
+			expectedOutputs:  []string{"approval-status=approved"},
+			expectedComment:  "The required number of approvals (1) has been met; continuing workflow and closing this issue.",
+		},
+		{
+			name:             "denied_fails_workflow",
+			polls:            [][]*github.IssueComment{{testComment("login1", "approve", at(1))}, {testComment("login2", "deny", at(2))}},
+			failOnDenial:     true,
+			expectedExitCode: 1,
+			expectedOutputs:  []string{"approval-status=denied", `{"user":"login2","action":"deny","source":"comment"}`},
+			expectedComment:  "Request denied. Closing issue and failing workflow.",
+		},
+		{
+			name:             "denied_continues_workflow",
+			polls:            [][]*github.IssueComment{{testComment("login1", "no", at(1))}},
+			failOnDenial:     false,
+			expectedExitCode: 0,
+			expectedOutputs:  []string{"approval-status=denied"},
+			expectedComment:  "Request denied. Closing issue but continuing workflow.",
+		},
+		{
+			name:             "timed_out",
+			polls:            [][]*github.IssueComment{{testComment("login1", "approve", at(1))}},
+			failOnDenial:     false,
+			timeout:          20 * time.Millisecond,
+			expectedExitCode: 1,
+			expectedOutputs:  []string{"approval-status=timed-out", `"status":"timed-out"`},
+			expectedComment:  "Workflow cancelled, closing issue.",
+		},
+		{
+			name:             "interrupted",
+			failOnDenial:     true,
+			interrupt:        true,
+			expectedExitCode: 1,
+			expectedOutputs:  []string{"issue-number=1"},
+			expectedComment:  "Workflow cancelled, closing issue.",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			outputFile := filepath.Join(t.TempDir(), "output.txt")
+			t.Setenv("GITHUB_OUTPUT", outputFile)
+
+			apprv, err := newApprovalEnvironment(approvalOptions{
+				repoFullName:        "owner/repo",
+				repoOwner:           "owner",
+				runID:               1,
+				issueApprovers:      []string{"login1", "login2"},
+				minimumApprovals:    testCase.minimumApprovals,
+				targetRepoOwner:     "owner",
+				targetRepoName:      "repo",
+				failOnDenial:        testCase.failOnDenial,
+				editedCommentPolicy: editedCommentPolicyReevaluate,
+				commentSyntax:       approval.CommentSyntaxKeywords,
+				target:              approvalTargetIssue,
+				timeout:             testCase.timeout,
+			})
+			if err != nil {
+				t.Fatalf("error creating approval environment: %v", err)
+			}
+			issues := newMemoryIssues(testCase.polls...)
+
+			interrupt := make(chan os.Signal, 1)
+			if testCase.interrupt {
+				interrupt <- os.Interrupt
+			}
+
+			exitCode := runApproval(context.Background(), apprv, &issueChannel{apprv: apprv, backend: issues}, time.Millisecond, interrupt)
+			if exitCode != testCase.expectedExitCode {
+				t.Fatalf("exit code %d, expected %d", exitCode, testCase.expectedExitCode)
+			}
+
+			outputs, err := os.ReadFile(outputFile)
+			if err != nil {
+				t.Fatalf("error reading outputs: %v", err)
+			}
+			for _, expected := range testCase.expectedOutputs {
+				if !strings.Contains(string(outputs), expected) {
+					t.Fatalf("outputs %q don't contain %q", outputs, expected)
+				}
+			}
+
+			state, comments := issues.issueState(1)
+			if state != "closed" {
+				t.Fatalf("issue state %q, expected closed", state)
+			}
+			if last := comments[len(comments)-1]; last != testCase.expectedComment {
+				t.Fatalf("last comment %q, expected %q", last, testCase.expectedComment)
+			}
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	createdAt := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	edited := func(comment *github.IssueComment) *github.IssueComment {
+		updatedAt := comment.GetCreatedAt().Add(time.Minute)
+		comment.UpdatedAt = &updatedAt
+		return comment
+	}
+
+	testCases := []struct {
+		name              string
+		env               map[string]string
+		comments          func() []*github.IssueComment
+		expectedExitCode  int
+		expectedStatus    string
+		expectedAssignees []string
+	}{
+		{
+			name: "approved_with_additional_word",
+			env: map[string]string{
+				envVarApprovers:               "login1, login2",
+				envVarAdditionalApprovedWords: "ship it,",
+			},
+			comments: func() []*github.IssueComment {
+				return []*github.IssueComment{testComment("login1", "approve", createdAt), testComment("login2", "Ship it", createdAt)}
+			},
+			expectedExitCode:  0,
+			expectedStatus:    "approved",
+			expectedAssignees: []string{"login1", "login2"},
+		},
+		{
+			name: "workflow_initiator_excluded",
+			env: map[string]string{
+				envVarApprovers:                          "login1,login2,login3",
+				envVarExcludeWorkflowInitiatorAsApprover: "true",
+				envVarWorkflowInitiator:                  "login3",
+				envVarMinimumApprovals:                   "2",
+			},
+			comments: func() []*github.IssueComment {
+				return []*github.IssueComment{testComment("login3", "approve", createdAt), testComment("login1", "approve", createdAt), testComment("login2", "yes", createdAt)}
+			},
+			expectedExitCode:  0,
+			expectedStatus:    "approved",
+			expectedAssignees: []string{"login1", "login2"},
+		},
+		{
+			name: "edited_denial_reevaluated",
+			env: map[string]string{
+				envVarApprovers:        "login1,login2",
+				envVarMinimumApprovals: "1",
+			},
+			comments: func() []*github.IssueComment {
+				return []*github.IssueComment{edited(testComment("login1", "deny", createdAt)), testComment("login2", "approve", createdAt)}
+			},
+			expectedExitCode:  1,
+			expectedStatus:    "denied",
+			expectedAssignees: []string{"login1", "login2"},
+		},
+		{
+			name: "edited_denial_ignored",
+			env: map[string]string{
+				envVarApprovers:        "login1,login2",
+				envVarMinimumApprovals: "1",
+				envVarEditedComments:   "ignore",
+			},
+			comments: func() []*github.IssueComment {
+				return []*github.IssueComment{edited(testComment("login1", "deny", createdAt)), testComment("login2", "approve", createdAt)}
+			},
+			expectedExitCode:  0,
+			expectedStatus:    "approved",
+			expectedAssignees: []string{"login1", "login2"},
+		},
+		{
+			name: "slash_commands",
+			env: map[string]string{
+				envVarApprovers:     "login1",
+				envVarCommentSyntax: "commands",
+				envVarFailOnDenial:  "false",
+			},
+			comments: func() []*github.IssueComment {
+				return []*github.IssueComment{testComment("login1", "approve", createdAt), testComment("login1", "/deny not today", createdAt)}
+			},
+			expectedExitCode:  0,
+			expectedStatus:    "denied",
+			expectedAssignees: []string{"login1"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			outputFile := filepath.Join(t.TempDir(), "output.txt")
+			for envVar, value := range map[string]string{
+				"GITHUB_OUTPUT":         outputFile,
+				envVarBackend:           "github",
+				envVarRepoFullName:      "owner/repo",
+				envVarRepoOwner:         "owner",
+				envVarRunID:             "1234",
+				envVarToken:             "token",
+				envVarWorkspace:         t.TempDir(),
+				envVarEventPath:         "",
+				envVarWorkflowInitiator: "",
+			} {
+				t.Setenv(envVar, value)
+			}
+			for envVar, value := range testCase.env {
+				t.Setenv(envVar, value)
+			}
+
+			issues := newMemoryIssues(testCase.comments())
+			connect := func(ctx context.Context, in inputs, log io.Writer, selected backend, repoOwner, repoFullName string) (*backendConnection, error) {
+				return &backendConnection{
+					expandGroup: func(userOrTeam, workflowInitiator string, shouldExcludeWorkflowInitiator bool) []string {
+						if strings.EqualFold(userOrTeam, workflowInitiator) && shouldExcludeWorkflowInitiator {
+							return nil
+						}
+						return []string{userOrTeam}
+					},
+					newChannel: func(apprv *approvalEnvironment) (approval.Channel, error) {
+						return &issueChannel{apprv: apprv, backend: issues}, nil
+					},
+				}, nil
+			}
+
+			var stdout, log bytes.Buffer
+			exitCode := run(context.Background(), inputs{}, outputFormatJSON, &stdout, &log, make(chan os.Signal), connect)
+			if exitCode != testCase.expectedExitCode {
+				t.Fatalf("exit code %d, expected %d", exitCode, testCase.expectedExitCode)
+			}
+			if !strings.Contains(log.String(), "Decision record: ") {
+				t.Fatalf("expected the decision record in the log, got %q", log.String())
+			}
+
+			var outputs map[string]string
+			if err := json.Unmarshal(stdout.Bytes(), &outputs); err != nil {
+				t.Fatalf("error parsing outputs %q: %v", stdout.String(), err)
+			}
+			if outputs["approval-status"] != testCase.expectedStatus {
+				t.Fatalf("approval status %q, expected %q", outputs["approval-status"], testCase.expectedStatus)
+			}
+
+			if assignees := *issues.issues[0].request.Assignees; !reflect.DeepEqual(assignees, testCase.expectedAssignees) {
+				t.Fatalf("assignees %v, expected %v", assignees, testCase.expectedAssignees)
+			}
+			if state, _ := issues.issueState(1); state != "closed" {
+				t.Fatalf("issue state %q, expected closed", state)
+			}
+		})
+	}
+}
+
+func TestRunRejectsApproversWithoutExpansion(t *testing.T) {
+	for envVar, value := range map[string]string{
+		envVarBackend:      "github",
+		envVarRepoFullName: "owner/repo",
+		envVarRepoOwner:    "owner",
+		envVarRunID:        "1234",
+		envVarToken:        "token",
+		envVarWorkspace:    t.TempDir(),
+		envVarEventPath:    "",
+		envVarApprovers:    "login1",
+	} {
+		t.Setenv(envVar, value)
+	}
+	connect := func(ctx context.Context, in inputs, log io.Writer, selected backend, repoOwner, repoFullName string) (*backendConnection, error) {
+		return &backendConnection{
+			newChannel: func(apprv *approvalEnvironment) (approval.Channel, error) {
+				t.Fatalf("expected no request to be made")
+				return nil, nil
+			},
+		}, nil
+	}
+
+	if exitCode := run(context.Background(), inputs{}, outputFormatText, io.Discard, io.Discard, make(chan os.Signal), connect); exitCode != 1 {
+		t.Fatalf("exit code %d, expected 1", exitCode)
+	}
+}
+
+func TestSplitRepoFullName(t *testing.T) {
+	testCases := []struct {
+		name          string
+		repoFullName  string
+		expectedOwner string
+		expectedName  string
+		isSuccess     bool
+	}{
+		{name: "github", repoFullName: "owner/repo", expectedOwner: "owner", expectedName: "repo", isSuccess: true},
+		{name: "gitlab_subgroup", repoFullName: "group/subgroup/project", expectedOwner: "group/subgroup", expectedName: "project", isSuccess: true},
+		{name: "no_separator", repoFullName: "repo", isSuccess: false},
+		{name: "no_owner", repoFullName: "/repo", isSuccess: false},
+		{name: "no_name", repoFullName: "owner/", isSuccess: false},
+		{name: "empty", repoFullName: "", isSuccess: false},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			owner, name, err := splitRepoFullName(testCase.repoFullName)
+			if (err == nil) != testCase.isSuccess {
+				t.Fatalf("expected success %v, got error %v", testCase.isSuccess, err)
+			}
+			if owner != testCase.expectedOwner || name != testCase.expectedName {
+				t.Fatalf("got %q %q, expected %q %q", owner, name, testCase.expectedOwner, testCase.expectedName)
+			}
+		})
+	}
+}
+
+// evaluateVotes evaluates votes under a policy of approvers and
+// minimumApprovals.
+func evaluateVotes(t *testing.T, votes []approval.Vote, approvers []string, minimumApprovals int) approval.Decision {
+	t.Helper()
+	evaluator, err := approval.NewEvaluator(approval.Policy{Approvers: approvers, MinimumApprovals: minimumApprovals})
+	if err != nil {
+		t.Fatalf("error creating evaluator: %v", err)
+	}
+	return evaluator.Evaluate(votes)
+}
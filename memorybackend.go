@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v43/github"
+)
+
+// memoryBackendUser is the author of the issues and comments the memory
+// backend is asked to create.
+const memoryBackendUser = "manual-approval[bot]"
+
+// memoryIssues is an in-memory issue backend. Nothing is sent anywhere: the
+// issues, their comments and their state are kept in memory, and the comments
+// of approvers are played back from a script, one batch per listing. Votes are
+// still parsed from raw comments, so the whole approval flow runs as it would
+// against a real tracker, e.g. in tests.
+type memoryIssues struct {
+	mu            sync.Mutex
+	polls         [][]*github.IssueComment
+	issues        []*memoryIssue
+	lastCommentID int64
+}
+
+type memoryIssue struct {
+	request  *github.IssueRequest
+	state    string
+	comments []*github.IssueComment
+}
+
+// newMemoryIssues returns a memory backend that adds polls[i] to the comments
+// of an issue when they are listed for the i-th time.
+func newMemoryIssues(polls ...[]*github.IssueComment) *memoryIssues {
+	return &memoryIssues{polls: polls}
+}
+
+func (b *memoryIssues) CreateIssue(ctx context.Context, owner, repo string, request *github.IssueRequest) (*github.Issue, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.issues = append(b.issues, &memoryIssue{request: request, state: "open"})
+	number := len(b.issues)
+	return &github.Issue{
+		Number:  &number,
+		HTMLURL: github.String(fmt.Sprintf("memory://%s/%s/issues/%d", owner, repo, number)),
+		User:    &github.User{Login: github.String(memoryBackendUser)},
+		State:   github.String("open"),
+	}, nil
+}
+
+func (b *memoryIssues) GetIssue(ctx context.Context, owner, repo string, number int) (*github.Issue, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	issue, err := b.issue(number)
+	if err != nil {
+		return nil, err
+	}
+	return &github.Issue{
+		Number:  &number,
+		HTMLURL: github.String(fmt.Sprintf("memory://%s/%s/issues/%d", owner, repo, number)),
+		State:   github.String(issue.state),
+	}, nil
+}
+
+func (b *memoryIssues) ListComments(ctx context.Context, owner, repo string, number int) ([]*github.IssueComment, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	issue, err := b.issue(number)
+	if err != nil {
+		return nil, err
+	}
+	if len(b.polls) > 0 {
+		for _, comment := range b.polls[0] {
+			b.addComment(issue, comment)
+		}
+		b.polls = b.polls[1:]
+	}
+	return append([]*github.IssueComment(nil), issue.comments...), nil
+}
+
+func (b *memoryIssues) PostComment(ctx context.Context, owner, repo string, number int, body string) (*github.IssueComment, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	issue, err := b.issue(number)
+	if err != nil {
+		return nil, err
+	}
+	createdAt := time.Now()
+	comment := &github.IssueComment{
+		Body:      &body,
+		User:      &github.User{Login: github.String(memoryBackendUser)},
+		CreatedAt: &createdAt,
+		UpdatedAt: &createdAt,
+	}
+	b.addComment(issue, comment)
+	return comment, nil
+}
+
+// ListReactions returns no reactions, as comments are the only way to vote
+// on an issue in memory.
+func (b *memoryIssues) ListReactions(ctx context.Context, owner, repo string, number int) ([]issueReaction, error) {
+	return nil, nil
+}
+
+func (b *memoryIssues) Close(ctx context.Context, owner, repo string, number int, approved bool) error {
+	return b.setState(number, "closed")
+}
+
+func (b *memoryIssues) Reopen(ctx context.Context, owner, repo string, number int) error {
+	return b.setState(number, "open")
+}
+
+func (b *memoryIssues) setState(number int, state string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	issue, err := b.issue(number)
+	if err != nil {
+		return err
+	}
+	issue.state = state
+	return nil
+}
+
+// issueState returns the state of an issue, "open" or "closed", and the
+// bodies of its comments.
+func (b *memoryIssues) issueState(number int) (string, []string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	issue, err := b.issue(number)
+	if err != nil {
+		return "", nil
+	}
+	bodies := make([]string, 0, len(issue.comments))
+	for _, comment := range issue.comments {
+		bodies = append(bodies, comment.GetBody())
+	}
+	return issue.state, bodies
+}
+
+func (b *memoryIssues) issue(number int) (*memoryIssue, error) {
+	if number < 1 || number > len(b.issues) {
+		return nil, fmt.Errorf("issue %d not found", number)
+	}
+	return b.issues[number-1], nil
+}
+
+// addComment adds a comment to the issue, numbering it like the comments
+// before it.
+func (b *memoryIssues) addComment(issue *memoryIssue, comment *github.IssueComment) {
+	b.lastCommentID++
+	comment.ID = github.Int64(b.lastCommentID)
+	issue.comments = append(issue.comments, comment)
+}
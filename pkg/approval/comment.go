@@ -0,0 +1,95 @@
+package approval
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// CommentSyntax selects how comment bodies are turned into votes.
+type CommentSyntax string
+
+const (
+	// CommentSyntaxKeywords only recognizes comments that consist entirely
+	// of an approved or denied word.
+	CommentSyntaxKeywords CommentSyntax = "keywords"
+	// CommentSyntaxCommands only recognizes slash commands on the first line
+	// of a comment, with the rest of the comment taken as the reason.
+	CommentSyntaxCommands CommentSyntax = "commands"
+	// CommentSyntaxBoth recognizes slash commands and falls back to keywords.
+	CommentSyntaxBoth CommentSyntax = "both"
+)
+
+var commandActions = map[string]Action{
+	"/approve": ActionApprove,
+	"/deny":    ActionDeny,
+	"/hold":    ActionHold,
+	"/unhold":  ActionUnhold,
+	"/revoke":  ActionRevoke,
+}
+
+// ParseCommentSyntax parses a comment syntax, defaulting to
+// CommentSyntaxKeywords.
+func ParseCommentSyntax(raw string) (CommentSyntax, error) {
+	switch syntax := CommentSyntax(strings.ToLower(strings.TrimSpace(raw))); syntax {
+	case "":
+		return CommentSyntaxKeywords, nil
+	case CommentSyntaxKeywords, CommentSyntaxCommands, CommentSyntaxBoth:
+		return syntax, nil
+	default:
+		return "", fmt.Errorf("unknown comment syntax %q, expected %q, %q or %q", raw, CommentSyntaxKeywords, CommentSyntaxCommands, CommentSyntaxBoth)
+	}
+}
+
+// ParseCommand recognizes a slash command on the first line of a comment.
+// Everything after the command, including any following lines, is returned
+// as the reason.
+func ParseCommand(commentBody string) (Action, string, bool) {
+	body := strings.TrimLeft(commentBody, " \t\r\n")
+	command, reason, _ := strings.Cut(body, "\n")
+	command = strings.TrimSpace(command)
+
+	word, rest, _ := strings.Cut(command, " ")
+	action, ok := commandActions[strings.ToLower(strings.TrimSpace(word))]
+	if !ok {
+		return "", "", false
+	}
+
+	reason = strings.TrimSpace(strings.TrimSpace(rest) + "\n" + reason)
+	return action, reason, true
+}
+
+// ParseComment returns the vote expressed by a comment body, if any. Only the
+// commenter's own prose is considered: quotes, code and email reply trailers
+// are ignored. A nil keywords uses the default words.
+func ParseComment(commentBody string, syntax CommentSyntax, keywords *KeywordMatcher) (Action, string, bool) {
+	if keywords == nil {
+		keywords = defaultKeywords
+	}
+	commentBody = approverProse(commentBody)
+
+	if syntax == CommentSyntaxCommands || syntax == CommentSyntaxBoth {
+		if action, reason, ok := ParseCommand(commentBody); ok {
+			return action, reason, true
+		}
+		if syntax == CommentSyntaxCommands {
+			return "", "", false
+		}
+	}
+
+	if keywords.IsApproved(commentBody) {
+		return ActionApprove, "", true
+	}
+	if keywords.IsDenied(commentBody) {
+		return ActionDeny, "", true
+	}
+
+	return "", "", false
+}
+
+// Comment is a comment on the approval request.
+type Comment struct {
+	User      string
+	Body      string
+	CreatedAt time.Time
+}
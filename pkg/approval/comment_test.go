@@ -0,0 +1,111 @@
+package approval
+
+import (
+	"testing"
+)
+
+func TestParseCommand(t *testing.T) {
+	testCases := []struct {
+		name           string
+		commentBody    string
+		isCommand      bool
+		expectedAction Action
+		expectedReason string
+	}{
+		{
+			name:           "approve_without_reason",
+			commentBody:    "/approve",
+			isCommand:      true,
+			expectedAction: ActionApprove,
+		},
+		{
+			name:           "approve_with_reason_on_same_line",
+			commentBody:    "/approve smoke tests passed",
+			isCommand:      true,
+			expectedAction: ActionApprove,
+			expectedReason: "smoke tests passed",
+		},
+		{
+			name:           "deny_with_multiline_reason",
+			commentBody:    "/deny\nmigration has not been reviewed\nsee #12",
+			isCommand:      true,
+			expectedAction: ActionDeny,
+			expectedReason: "migration has not been reviewed\nsee #12",
+		},
+		{
+			name:           "uppercase_command",
+			commentBody:    "/HOLD waiting on DBA",
+			isCommand:      true,
+			expectedAction: ActionHold,
+			expectedReason: "waiting on DBA",
+		},
+		{
+			name:           "unhold",
+			commentBody:    "/unhold",
+			isCommand:      true,
+			expectedAction: ActionUnhold,
+		},
+		{
+			name:           "revoke",
+			commentBody:    "  /revoke wrong build",
+			isCommand:      true,
+			expectedAction: ActionRevoke,
+			expectedReason: "wrong build",
+		},
+		{
+			name:        "command_not_on_first_line",
+			commentBody: "looks fine\n/approve",
+			isCommand:   false,
+		},
+		{
+			name:        "command_prefix_of_word",
+			commentBody: "/approved",
+			isCommand:   false,
+		},
+		{
+			name:        "bare_keyword",
+			commentBody: "approve",
+			isCommand:   false,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			action, reason, ok := ParseCommand(testCase.commentBody)
+			if ok != testCase.isCommand {
+				t.Fatalf("expected command %v but got %v", testCase.isCommand, ok)
+			}
+			if action != testCase.expectedAction {
+				t.Fatalf("expected action %q but got %q", testCase.expectedAction, action)
+			}
+			if reason != testCase.expectedReason {
+				t.Fatalf("expected reason %q but got %q", testCase.expectedReason, reason)
+			}
+		})
+	}
+}
+
+func TestParseCommentSyntax(t *testing.T) {
+	testCases := []struct {
+		name        string
+		commentBody string
+		syntax      CommentSyntax
+		isVote      bool
+	}{
+		{name: "keywords_accepts_keyword", commentBody: "approve", syntax: CommentSyntaxKeywords, isVote: true},
+		{name: "keywords_ignores_command", commentBody: "/approve", syntax: CommentSyntaxKeywords, isVote: false},
+		{name: "commands_accepts_command", commentBody: "/approve", syntax: CommentSyntaxCommands, isVote: true},
+		{name: "commands_ignores_keyword", commentBody: "approve", syntax: CommentSyntaxCommands, isVote: false},
+		{name: "both_accepts_command", commentBody: "/deny", syntax: CommentSyntaxBoth, isVote: true},
+		{name: "both_accepts_keyword", commentBody: "deny", syntax: CommentSyntaxBoth, isVote: true},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			_, _, ok := ParseComment(testCase.commentBody, testCase.syntax, nil)
+			if ok != testCase.isVote {
+				t.Fatalf("expected vote %v but got %v", testCase.isVote, ok)
+			}
+		})
+	}
+}
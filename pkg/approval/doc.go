@@ -0,0 +1,15 @@
+// Package approval waits for a manual approval: it makes a request through a
+// Channel, such as an issue or a change request, collects the votes cast on
+// it and evaluates them against a Policy until the request is approved or
+// denied.
+//
+// The package has no channels of its own, and Policy.Approvers are taken as
+// final logins. The action's issue, discussion and tracker channels, and its
+// expansion of teams, groups and roles into approvers, aren't part of it:
+// callers implement Channel for wherever they make requests and resolve
+// their approvers themselves.
+//
+// The manual-approval action and command line are built on this package. Its
+// exported API follows the semantic versioning of the module's tags: it only
+// changes incompatibly in a new major version, so that callers can pin it.
+package approval
@@ -0,0 +1,169 @@
+package approval
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// regexKeywordPrefix marks a keyword as a regular expression rather than a
+// literal word, e.g. "regex:ship ?it".
+const regexKeywordPrefix = "regex:"
+
+// emojiShortcodes maps the canonical GitHub shortcode of an emoji to its
+// unicode form and any alternative shortcodes. GitHub stores some emoji as
+// shortcodes and others as unicode, so both comments and keywords are
+// normalized to the canonical shortcode before matching.
+var emojiShortcodes = []struct {
+	shortcode string
+	unicode   string
+	aliases   []string
+}{
+	{shortcode: ":+1:", unicode: "👍", aliases: []string{":thumbsup:"}},
+	{shortcode: ":-1:", unicode: "👎", aliases: []string{":thumbsdown:"}},
+	{shortcode: ":white_check_mark:", unicode: "✅"},
+	{shortcode: ":heavy_check_mark:", unicode: "✔"},
+	{shortcode: ":ballot_box_with_check:", unicode: "☑"},
+	{shortcode: ":x:", unicode: "❌"},
+	{shortcode: ":negative_squared_cross_mark:", unicode: "❎"},
+	{shortcode: ":no_entry:", unicode: "⛔"},
+	{shortcode: ":no_entry_sign:", unicode: "🚫"},
+	{shortcode: ":stop_sign:", unicode: "🛑"},
+	{shortcode: ":rocket:", unicode: "🚀"},
+	{shortcode: ":ship:", unicode: "🚢"},
+	{shortcode: ":tada:", unicode: "🎉"},
+	{shortcode: ":100:", unicode: "💯"},
+	{shortcode: ":ok:", unicode: "🆗"},
+	{shortcode: ":ok_hand:", unicode: "👌"},
+	{shortcode: ":green_circle:", unicode: "🟢"},
+	{shortcode: ":red_circle:", unicode: "🔴"},
+}
+
+var emojiReplacer = newEmojiReplacer()
+
+func newEmojiReplacer() *strings.Replacer {
+	var pairs []string
+	for _, emoji := range emojiShortcodes {
+		if emoji.unicode != "" {
+			pairs = append(pairs, emoji.unicode, emoji.shortcode)
+		}
+		for _, alias := range emoji.aliases {
+			pairs = append(pairs, alias, emoji.shortcode)
+		}
+	}
+	// Emoji presentation selectors don't change the meaning of the emoji.
+	pairs = append(pairs, "\uFE0F", "", "\uFE0E", "")
+	return strings.NewReplacer(pairs...)
+}
+
+// normalizeEmoji rewrites unicode emoji and alias shortcodes to their
+// canonical GitHub shortcode.
+func normalizeEmoji(s string) string {
+	return emojiReplacer.Replace(s)
+}
+
+// KeywordMatcher decides whether a comment consists of an approved or denied
+// keyword. The patterns are compiled once, when the matcher is created.
+type KeywordMatcher struct {
+	approved []*regexp.Regexp
+	denied   []*regexp.Regexp
+}
+
+// NewKeywordMatcher compiles the approved and denied keywords. Keywords are
+// literal words unless they start with "regex:", e.g. "regex:ship ?it".
+// Blank words are skipped, but an empty "regex:" is an error.
+func NewKeywordMatcher(approvedWords, deniedWords []string) (*KeywordMatcher, error) {
+	approvedWords = withoutBlankWords(approvedWords)
+	deniedWords = withoutBlankWords(deniedWords)
+	approved, err := compileKeywords(approvedWords)
+	if err != nil {
+		return nil, fmt.Errorf("invalid approved word: %w", err)
+	}
+	denied, err := compileKeywords(deniedWords)
+	if err != nil {
+		return nil, fmt.Errorf("invalid denied word: %w", err)
+	}
+
+	for _, approvedWord := range approvedWords {
+		for _, deniedWord := range deniedWords {
+			if strings.EqualFold(normalizeEmoji(approvedWord), normalizeEmoji(deniedWord)) {
+				return nil, fmt.Errorf("%q is both an approved and a denied word", approvedWord)
+			}
+		}
+	}
+
+	return &KeywordMatcher{
+		approved: approved,
+		denied:   denied,
+	}, nil
+}
+
+func withoutBlankWords(words []string) []string {
+	nonBlank := make([]string, 0, len(words))
+	for _, word := range words {
+		if strings.TrimSpace(word) != "" {
+			nonBlank = append(nonBlank, word)
+		}
+	}
+	return nonBlank
+}
+
+func compileKeywords(words []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(words))
+	for _, word := range words {
+		var pattern string
+		if strings.HasPrefix(word, regexKeywordPrefix) {
+			pattern = strings.TrimPrefix(word, regexKeywordPrefix)
+		} else {
+			pattern = regexp.QuoteMeta(normalizeEmoji(word))
+		}
+		if strings.TrimSpace(pattern) == "" {
+			return nil, fmt.Errorf("empty regex keyword %q", word)
+		}
+
+		re, err := regexp.Compile(fmt.Sprintf("(?i)^(?:%s)[.!]*\\s*$", pattern))
+		if err != nil {
+			return nil, fmt.Errorf("keyword %q: %w", word, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+var (
+	// DefaultApprovedWords are the words that approve a request.
+	DefaultApprovedWords = []string{"approved", "approve", "lgtm", "yes"}
+	// DefaultDeniedWords are the words that deny a request.
+	DefaultDeniedWords = []string{"denied", "deny", "no"}
+)
+
+// defaultKeywords is the matcher of policies that don't set their own.
+var defaultKeywords = mustNewKeywordMatcher(DefaultApprovedWords, DefaultDeniedWords)
+
+func mustNewKeywordMatcher(approvedWords, deniedWords []string) *KeywordMatcher {
+	matcher, err := NewKeywordMatcher(approvedWords, deniedWords)
+	if err != nil {
+		panic(err)
+	}
+	return matcher
+}
+
+// IsApproved reports whether the comment consists of an approved word.
+func (m *KeywordMatcher) IsApproved(commentBody string) bool {
+	return matchesAny(m.approved, commentBody)
+}
+
+// IsDenied reports whether the comment consists of a denied word.
+func (m *KeywordMatcher) IsDenied(commentBody string) bool {
+	return matchesAny(m.denied, commentBody)
+}
+
+func matchesAny(patterns []*regexp.Regexp, commentBody string) bool {
+	normalized := normalizeEmoji(commentBody)
+	for _, re := range patterns {
+		if re.MatchString(normalized) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package approval
+
+import (
+	"testing"
+)
+
+func TestNewKeywordMatcher(t *testing.T) {
+	testCases := []struct {
+		name          string
+		approvedWords []string
+		deniedWords   []string
+		isSuccess     bool
+	}{
+		{
+			name:          "defaults",
+			approvedWords: DefaultApprovedWords,
+			deniedWords:   DefaultDeniedWords,
+			isSuccess:     true,
+		},
+		{
+			name:          "literal_special_characters",
+			approvedWords: []string{"+1", "c++", "(ok)", "[x]"},
+			deniedWords:   []string{"-1"},
+			isSuccess:     true,
+		},
+		{
+			name:          "invalid_regex",
+			approvedWords: []string{"regex:ship(it"},
+			deniedWords:   DefaultDeniedWords,
+			isSuccess:     false,
+		},
+		{
+			name:          "blank_words_skipped",
+			approvedWords: []string{"approve", "", " "},
+			deniedWords:   []string{"deny", ""},
+			isSuccess:     true,
+		},
+		{
+			name:          "empty_regex",
+			approvedWords: []string{"regex: "},
+			deniedWords:   DefaultDeniedWords,
+			isSuccess:     false,
+		},
+		{
+			name:          "word_both_approved_and_denied",
+			approvedWords: []string{"approve", "maybe"},
+			deniedWords:   []string{"deny", "Maybe"},
+			isSuccess:     false,
+		},
+		{
+			name:          "emoji_both_approved_and_denied",
+			approvedWords: []string{"🚀"},
+			deniedWords:   []string{":rocket:"},
+			isSuccess:     false,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			_, err := NewKeywordMatcher(testCase.approvedWords, testCase.deniedWords)
+			if (err == nil) != testCase.isSuccess {
+				t.Fatalf("expected success %v but got error %v", testCase.isSuccess, err)
+			}
+		})
+	}
+}
+
+func TestNormalizeEmoji(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "unicode_to_shortcode", input: "🚀", expected: ":rocket:"},
+		{name: "alias_to_canonical", input: ":thumbsup:", expected: ":+1:"},
+		{name: "variation_selector_dropped", input: "✔️", expected: ":heavy_check_mark:"},
+		{name: "canonical_unchanged", input: ":shipit:", expected: ":shipit:"},
+		{name: "text_unchanged", input: "approve", expected: "approve"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			if actual := normalizeEmoji(testCase.input); actual != testCase.expected {
+				t.Fatalf("expected %q but got %q", testCase.expected, actual)
+			}
+		})
+	}
+}
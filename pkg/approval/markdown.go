@@ -0,0 +1,116 @@
+package approval
+
+import (
+	"regexp"
+	"strings"
+)
+
+const (
+	emailOriginalLine = "-----Original Message-----"
+	signatureLine     = "-- "
+)
+
+var (
+	htmlCommentRegex = regexp.MustCompile(`(?s)<!--.*?-->`)
+	emailReplyRegex  = regexp.MustCompile(`^On .+ wrote:$`)
+)
+
+// approverProse reduces a Markdown comment body to the text the commenter
+// wrote themselves, so that keyword and command matching only looks at that.
+// Block quotes, fenced and inline code, HTML comments and the trailers email
+// clients append to replies are all removed.
+func approverProse(commentBody string) string {
+	body := strings.ReplaceAll(commentBody, "\r\n", "\n")
+	body = htmlCommentRegex.ReplaceAllString(body, "")
+
+	var kept []string
+	fence := ""
+	for _, line := range strings.Split(body, "\n") {
+		trimmed := strings.TrimLeft(line, " ")
+		indent := len(line) - len(trimmed)
+
+		if fence != "" {
+			if indent < 4 && strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]+" \t") == "" {
+				fence = ""
+			}
+			continue
+		}
+		if indent < 4 {
+			if marker := codeFence(trimmed); marker != "" {
+				fence = marker
+				continue
+			}
+			if strings.HasPrefix(trimmed, ">") {
+				continue
+			}
+		}
+		if emailReplyRegex.MatchString(strings.TrimSpace(line)) || line == emailOriginalLine || line == signatureLine {
+			break
+		}
+
+		kept = append(kept, stripInlineCode(line))
+	}
+
+	return strings.TrimSpace(strings.Join(kept, "\n"))
+}
+
+// codeFence returns the opening fence of a fenced code block, or an empty
+// string if the line doesn't open one.
+func codeFence(line string) string {
+	for _, char := range []string{"`", "~"} {
+		if !strings.HasPrefix(line, char+char+char) {
+			continue
+		}
+		length := len(line) - len(strings.TrimLeft(line, char))
+		// A backtick fence can't have backticks in its info string.
+		if char == "`" && strings.Contains(line[length:], "`") {
+			return ""
+		}
+		return line[:length]
+	}
+	return ""
+}
+
+// stripInlineCode removes code spans. A span opened by a run of N backticks
+// is closed by the next run of exactly N backticks; an unclosed run is kept
+// as literal text.
+func stripInlineCode(line string) string {
+	var result strings.Builder
+	for i := 0; i < len(line); {
+		if line[i] != '`' {
+			result.WriteByte(line[i])
+			i++
+			continue
+		}
+
+		run := backtickRun(line, i)
+		closing := -1
+		for j := i + run; j < len(line); {
+			if line[j] != '`' {
+				j++
+				continue
+			}
+			n := backtickRun(line, j)
+			if n == run {
+				closing = j
+				break
+			}
+			j += n
+		}
+		if closing < 0 {
+			result.WriteString(line[i : i+run])
+			i += run
+			continue
+		}
+		i = closing + run
+	}
+	return result.String()
+}
+
+func backtickRun(line string, start int) int {
+	n := 0
+	for start+n < len(line) && line[start+n] == '`' {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,238 @@
+package approval
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Status is the state of an approval request.
+type Status string
+
+const (
+	StatusPending  Status = "Pending"
+	StatusApproved Status = "Approved"
+	StatusDenied   Status = "Denied"
+)
+
+// Decision is the outcome of evaluating a set of votes. Votes holds the votes
+// that the outcome rests on: the approvals counted so far, or the single
+// denial. Holds are the outstanding holds.
+type Decision struct {
+	Status Status
+	Votes  []Vote
+	Holds  []Vote
+}
+
+// Reasons formats the reasons given with the votes a decision rests on, one
+// per line.
+func (d Decision) Reasons() string {
+	var lines []string
+	for _, v := range d.Votes {
+		if v.Reason == "" {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s: %s", v.User, v.Reason))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Policy is who can approve a request and how many approvals it needs.
+type Policy struct {
+	// Approvers are the users whose votes count, compared case-insensitively.
+	Approvers []string
+	// MinimumApprovals is the number of approvals needed. Zero requires an
+	// approval from every approver.
+	MinimumApprovals int
+	// RequiredApprovers are approvers whose approval is needed in addition
+	// to MinimumApprovals. Each of them must be one of Approvers.
+	RequiredApprovers []string
+	// Areas are groups of approvers that each need an approval from at
+	// least one of their members, in addition to MinimumApprovals, such as
+	// the code owners of each changed path.
+	Areas []Area
+	// CommentSyntax is how comments are turned into votes. Empty means
+	// CommentSyntaxKeywords.
+	CommentSyntax CommentSyntax
+	// Keywords matches approved and denied words in comments. Nil means
+	// DefaultApprovedWords and DefaultDeniedWords.
+	Keywords *KeywordMatcher
+}
+
+// Area is a named group of approvers.
+type Area struct {
+	Name      string
+	Approvers []string
+}
+
+// Evaluator decides requests under a validated Policy.
+type Evaluator struct {
+	policy Policy
+}
+
+// NewEvaluator validates the policy and returns an evaluator for it.
+func NewEvaluator(policy Policy) (*Evaluator, error) {
+	if policy.MinimumApprovals < 0 {
+		return nil, fmt.Errorf("minimum required approvals (%d) can't be negative", policy.MinimumApprovals)
+	}
+	if policy.MinimumApprovals > len(policy.Approvers) {
+		return nil, fmt.Errorf("minimum required approvals (%d) is greater than the total number of approvers (%d)", policy.MinimumApprovals, len(policy.Approvers))
+	}
+	for _, required := range policy.RequiredApprovers {
+		if !containsFold(policy.Approvers, required) {
+			return nil, fmt.Errorf("required approver %q is not one of the approvers", required)
+		}
+	}
+	for _, area := range policy.Areas {
+		if len(area.Approvers) == 0 {
+			return nil, fmt.Errorf("area %q has no approvers", area.Name)
+		}
+		for _, approver := range area.Approvers {
+			if !containsFold(policy.Approvers, approver) {
+				return nil, fmt.Errorf("approver %q of area %q is not one of the approvers", approver, area.Name)
+			}
+		}
+	}
+	if policy.CommentSyntax == "" {
+		policy.CommentSyntax = CommentSyntaxKeywords
+	}
+	if _, err := ParseCommentSyntax(string(policy.CommentSyntax)); err != nil {
+		return nil, err
+	}
+	if policy.Keywords == nil {
+		policy.Keywords = defaultKeywords
+	}
+	return &Evaluator{policy: policy}, nil
+}
+
+// Policy returns the policy the evaluator decides under.
+func (e *Evaluator) Policy() Policy {
+	return e.policy
+}
+
+// VotesFromComments returns the votes expressed by comments, in the order of
+// the comments.
+func (e *Evaluator) VotesFromComments(comments []Comment) []Vote {
+	var votes []Vote
+	for _, comment := range comments {
+		action, reason, ok := ParseComment(comment.Body, e.policy.CommentSyntax, e.policy.Keywords)
+		if !ok {
+			continue
+		}
+		votes = append(votes, Vote{
+			User:      comment.User,
+			Action:    action,
+			Reason:    reason,
+			Source:    "comment",
+			CreatedAt: comment.CreatedAt,
+		})
+	}
+	return votes
+}
+
+// Evaluate evaluates votes in the order they were cast. Votes of users who
+// aren't approvers are ignored. An approver whose approval has been counted
+// can only revoke or hold afterwards; a revoked approval allows them to vote
+// again. Any outstanding hold keeps the request pending until the approver
+// who placed it lifts it.
+func (e *Evaluator) Evaluate(votes []Vote) Decision {
+	minimumApprovals := e.policy.MinimumApprovals
+	if minimumApprovals == 0 {
+		minimumApprovals = len(e.policy.Approvers)
+	}
+
+	var approvals []Vote
+	var holds []Vote
+
+	approvedIndex := func(user string) int {
+		for idx, approval := range approvals {
+			if strings.EqualFold(approval.User, user) {
+				return idx
+			}
+		}
+		return -1
+	}
+	holdIndex := func(user string) int {
+		for idx, hold := range holds {
+			if strings.EqualFold(hold.User, user) {
+				return idx
+			}
+		}
+		return -1
+	}
+	isMet := func() bool {
+		if len(approvals) < minimumApprovals || len(holds) > 0 {
+			return false
+		}
+		for _, required := range e.policy.RequiredApprovers {
+			if approvedIndex(required) < 0 {
+				return false
+			}
+		}
+		for _, area := range e.policy.Areas {
+			covered := false
+			for _, approver := range area.Approvers {
+				if approvedIndex(approver) >= 0 {
+					covered = true
+					break
+				}
+			}
+			if !covered {
+				return false
+			}
+		}
+		return true
+	}
+
+	for _, v := range votes {
+		if !e.IsApprover(v.User) {
+			continue
+		}
+
+		switch v.Action {
+		case ActionApprove:
+			if approvedIndex(v.User) >= 0 {
+				continue
+			}
+			approvals = append(approvals, v)
+			if isMet() {
+				return Decision{Status: StatusApproved, Votes: approvals}
+			}
+		case ActionDeny:
+			if approvedIndex(v.User) >= 0 {
+				continue
+			}
+			return Decision{Status: StatusDenied, Votes: []Vote{v}, Holds: holds}
+		case ActionRevoke:
+			if idx := approvedIndex(v.User); idx >= 0 {
+				approvals = append(approvals[:idx], approvals[idx+1:]...)
+			}
+		case ActionHold:
+			if holdIndex(v.User) < 0 {
+				holds = append(holds, v)
+			}
+		case ActionUnhold:
+			if idx := holdIndex(v.User); idx >= 0 {
+				holds = append(holds[:idx], holds[idx+1:]...)
+			}
+			if isMet() {
+				return Decision{Status: StatusApproved, Votes: approvals}
+			}
+		}
+	}
+
+	return Decision{Status: StatusPending, Votes: approvals, Holds: holds}
+}
+
+// IsApprover reports whether user is one of the policy's approvers.
+func (e *Evaluator) IsApprover(user string) bool {
+	return containsFold(e.policy.Approvers, user)
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
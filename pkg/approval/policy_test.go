@@ -0,0 +1,190 @@
+package approval
+
+import (
+	"testing"
+)
+
+func TestEvaluate(t *testing.T) {
+	testCases := []struct {
+		name              string
+		votes             []Vote
+		approvers         []string
+		minimumApprovals  int
+		requiredApprovers []string
+		areas             []Area
+		expectedStatus    Status
+		expectedReasons   string
+	}{
+		{
+			name: "approve_with_reason",
+			votes: []Vote{
+				{User: "login1", Action: ActionApprove, Reason: "tested in staging"},
+			},
+			approvers:       []string{"login1"},
+			expectedStatus:  StatusApproved,
+			expectedReasons: "login1: tested in staging",
+		},
+		{
+			name: "deny_with_reason",
+			votes: []Vote{
+				{User: "login1", Action: ActionApprove, Reason: "fine by me"},
+				{User: "login2", Action: ActionDeny, Reason: "freeze in effect"},
+			},
+			approvers:       []string{"login1", "login2"},
+			expectedStatus:  StatusDenied,
+			expectedReasons: "login2: freeze in effect",
+		},
+		{
+			name: "hold_blocks_approval",
+			votes: []Vote{
+				{User: "login2", Action: ActionHold},
+				{User: "login1", Action: ActionApprove},
+			},
+			approvers:        []string{"login1", "login2"},
+			minimumApprovals: 1,
+			expectedStatus:   StatusPending,
+		},
+		{
+			name: "unhold_releases_approval",
+			votes: []Vote{
+				{User: "login2", Action: ActionHold},
+				{User: "login1", Action: ActionApprove, Reason: "go"},
+				{User: "login2", Action: ActionUnhold},
+			},
+			approvers:        []string{"login1", "login2"},
+			minimumApprovals: 1,
+			expectedStatus:   StatusApproved,
+			expectedReasons:  "login1: go",
+		},
+		{
+			name: "unhold_by_other_approver_does_not_release",
+			votes: []Vote{
+				{User: "login2", Action: ActionHold},
+				{User: "login1", Action: ActionApprove},
+				{User: "login1", Action: ActionUnhold},
+			},
+			approvers:        []string{"login1", "login2"},
+			minimumApprovals: 1,
+			expectedStatus:   StatusPending,
+		},
+		{
+			name: "revoke_withdraws_approval",
+			votes: []Vote{
+				{User: "login1", Action: ActionApprove},
+				{User: "login1", Action: ActionRevoke},
+				{User: "login2", Action: ActionApprove},
+			},
+			approvers:      []string{"login1", "login2"},
+			expectedStatus: StatusPending,
+		},
+		{
+			name: "revoke_then_deny",
+			votes: []Vote{
+				{User: "login1", Action: ActionApprove},
+				{User: "login1", Action: ActionRevoke},
+				{User: "login1", Action: ActionDeny},
+			},
+			approvers:      []string{"login1", "login2"},
+			expectedStatus: StatusDenied,
+		},
+		{
+			name: "non_approver_ignored",
+			votes: []Vote{
+				{User: "login3", Action: ActionDeny},
+				{User: "login1", Action: ActionApprove},
+			},
+			approvers:      []string{"login1"},
+			expectedStatus: StatusApproved,
+		},
+		{
+			name: "required_approver_missing",
+			votes: []Vote{
+				{User: "login1", Action: ActionApprove},
+				{User: "login2", Action: ActionApprove},
+			},
+			approvers:         []string{"login1", "login2", "login3"},
+			minimumApprovals:  2,
+			requiredApprovers: []string{"login3"},
+			expectedStatus:    StatusPending,
+		},
+		{
+			name: "required_approver_approves_last",
+			votes: []Vote{
+				{User: "login1", Action: ActionApprove},
+				{User: "login2", Action: ActionApprove},
+				{User: "LOGIN3", Action: ActionApprove, Reason: "owner"},
+			},
+			approvers:         []string{"login1", "login2", "login3"},
+			minimumApprovals:  1,
+			requiredApprovers: []string{"login3"},
+			expectedStatus:    StatusApproved,
+			expectedReasons:   "LOGIN3: owner",
+		},
+		{
+			name: "area_not_covered",
+			votes: []Vote{
+				{User: "login1", Action: ActionApprove},
+				{User: "login2", Action: ActionApprove},
+			},
+			approvers:        []string{"login1", "login2", "login3"},
+			minimumApprovals: 1,
+			areas:            []Area{{Name: "/docs/", Approvers: []string{"login1", "login2"}}, {Name: "*.go", Approvers: []string{"login3"}}},
+			expectedStatus:   StatusPending,
+		},
+		{
+			name: "every_area_covered",
+			votes: []Vote{
+				{User: "login2", Action: ActionApprove},
+				{User: "login3", Action: ActionApprove},
+			},
+			approvers:        []string{"login1", "login2", "login3"},
+			minimumApprovals: 1,
+			areas:            []Area{{Name: "/docs/", Approvers: []string{"login1", "login2"}}, {Name: "*.go", Approvers: []string{"login3"}}},
+			expectedStatus:   StatusApproved,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			evaluator, err := NewEvaluator(Policy{Approvers: testCase.approvers, MinimumApprovals: testCase.minimumApprovals, RequiredApprovers: testCase.requiredApprovers, Areas: testCase.areas})
+			if err != nil {
+				t.Fatalf("error creating evaluator: %v", err)
+			}
+			actual := evaluator.Evaluate(testCase.votes)
+			if actual.Status != testCase.expectedStatus {
+				t.Fatalf("actual %s, expected %s", actual.Status, testCase.expectedStatus)
+			}
+			if actual.Reasons() != testCase.expectedReasons {
+				t.Fatalf("expected reasons %q but got %q", testCase.expectedReasons, actual.Reasons())
+			}
+		})
+	}
+}
+
+func TestNewEvaluator(t *testing.T) {
+	testCases := []struct {
+		name      string
+		policy    Policy
+		isSuccess bool
+	}{
+		{name: "all_approvers", policy: Policy{Approvers: []string{"login1", "login2"}}, isSuccess: true},
+		{name: "minimum_approvals", policy: Policy{Approvers: []string{"login1", "login2"}, MinimumApprovals: 2}, isSuccess: true},
+		{name: "too_many_approvals", policy: Policy{Approvers: []string{"login1"}, MinimumApprovals: 2}, isSuccess: false},
+		{name: "negative_approvals", policy: Policy{Approvers: []string{"login1"}, MinimumApprovals: -1}, isSuccess: false},
+		{name: "required_approver", policy: Policy{Approvers: []string{"login1", "login2"}, RequiredApprovers: []string{"Login2"}}, isSuccess: true},
+		{name: "required_not_approver", policy: Policy{Approvers: []string{"login1"}, RequiredApprovers: []string{"login2"}}, isSuccess: false},
+		{name: "area", policy: Policy{Approvers: []string{"login1", "login2"}, Areas: []Area{{Name: "*.go", Approvers: []string{"LOGIN2"}}}}, isSuccess: true},
+		{name: "area_not_approver", policy: Policy{Approvers: []string{"login1"}, Areas: []Area{{Name: "*.go", Approvers: []string{"login2"}}}}, isSuccess: false},
+		{name: "empty_area", policy: Policy{Approvers: []string{"login1"}, Areas: []Area{{Name: "*.go"}}}, isSuccess: false},
+		{name: "unknown_syntax", policy: Policy{Approvers: []string{"login1"}, CommentSyntax: "emoji"}, isSuccess: false},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			_, err := NewEvaluator(testCase.policy)
+			if (err == nil) != testCase.isSuccess {
+				t.Fatalf("expected success %v but got error %v", testCase.isSuccess, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package approval
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DefaultPollingInterval is how often a request is polled for votes when
+// Request.PollingInterval isn't set.
+const DefaultPollingInterval = 10 * time.Second
+
+// Channel is where an approval request is made and its votes are collected,
+// e.g. an issue or a pull request's reviews.
+type Channel interface {
+	// CreateRequest opens the approval request.
+	CreateRequest(ctx context.Context) error
+	// ListVotes returns every vote cast on the request so far, in the order
+	// they were cast.
+	ListVotes(ctx context.Context) ([]Vote, error)
+	// Review gives the channel a chance to adjust the decision made from the
+	// votes, e.g. to keep it pending until a checklist is complete.
+	Review(ctx context.Context, decision Decision) (Decision, error)
+	// Finish reports an approved or denied decision on the request and
+	// closes it where that applies.
+	Finish(ctx context.Context, decision Decision) error
+	// Cancel reports that the caller stopped waiting for a decision.
+	Cancel(ctx context.Context) error
+}
+
+// Request is an approval request made through a channel and decided by an
+// evaluator.
+type Request struct {
+	Channel   Channel
+	Evaluator *Evaluator
+	// PollingInterval is the time between polls of the channel. Zero means
+	// DefaultPollingInterval.
+	PollingInterval time.Duration
+	// Logf, if set, is called with the status after every poll.
+	Logf func(format string, args ...interface{})
+}
+
+// Result is the outcome of waiting for a request.
+type Result struct {
+	// Status is StatusApproved or StatusDenied once the request is decided.
+	// It is StatusPending if waiting stopped before a decision.
+	Status   Status
+	Decision Decision
+}
+
+// Approved reports whether the request was approved.
+func (r Result) Approved() bool {
+	return r.Status == StatusApproved
+}
+
+// Open makes the request through the channel.
+func (r *Request) Open(ctx context.Context) error {
+	if err := r.Channel.CreateRequest(ctx); err != nil {
+		return fmt.Errorf("error creating approval request: %w", err)
+	}
+	return nil
+}
+
+// Wait polls the request until it is approved or denied, and reports the
+// decision through the channel's Finish. If reporting the decision fails,
+// Wait returns the result together with the error. If ctx is done first,
+// Wait cancels the request through the channel's Cancel and returns an error
+// that wraps ctx.Err(). On errors, the result holds the last decision made.
+func (r *Request) Wait(ctx context.Context) (Result, error) {
+	pollingInterval := r.PollingInterval
+	if pollingInterval <= 0 {
+		pollingInterval = DefaultPollingInterval
+	}
+
+	var result Result
+	for {
+		if ctx.Err() != nil {
+			return result, r.cancel(ctx)
+		}
+
+		votes, err := r.Channel.ListVotes(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return result, r.cancel(ctx)
+			}
+			return result, err
+		}
+		decision, err := r.Channel.Review(ctx, r.Evaluator.Evaluate(votes))
+		if err != nil {
+			if ctx.Err() != nil {
+				return result, r.cancel(ctx)
+			}
+			return result, err
+		}
+		result = Result{Status: decision.Status, Decision: decision}
+		r.logf("Workflow status: %s", decision.Status)
+		if len(decision.Holds) > 0 {
+			r.logf("Approval is on hold by %d approver(s)", len(decision.Holds))
+		}
+
+		if decision.Status != StatusPending {
+			return result, r.Channel.Finish(ctx, decision)
+		}
+
+		timer := time.NewTimer(pollingInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// cancel cancels the request after ctx is done. The channel is given a
+// context that isn't cancelled, so that it can still report the
+// cancellation.
+func (r *Request) cancel(ctx context.Context) error {
+	if err := r.Channel.Cancel(context.WithoutCancel(ctx)); err != nil {
+		return errors.Join(ctx.Err(), err)
+	}
+	return ctx.Err()
+}
+
+func (r *Request) logf(format string, args ...interface{}) {
+	if r.Logf != nil {
+		r.Logf(format, args...)
+	}
+}
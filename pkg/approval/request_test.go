@@ -0,0 +1,115 @@
+package approval
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// scriptedChannel returns polls[i] as the votes cast on the request when it
+// is polled for the i-th time, and records how the request ended.
+type scriptedChannel struct {
+	polls    [][]Vote
+	votes    []Vote
+	finished *Decision
+	canceled bool
+}
+
+func (c *scriptedChannel) CreateRequest(ctx context.Context) error {
+	return nil
+}
+
+func (c *scriptedChannel) ListVotes(ctx context.Context) ([]Vote, error) {
+	if len(c.polls) > 0 {
+		c.votes = append(c.votes, c.polls[0]...)
+		c.polls = c.polls[1:]
+	}
+	return c.votes, nil
+}
+
+func (c *scriptedChannel) Review(ctx context.Context, decision Decision) (Decision, error) {
+	return decision, nil
+}
+
+func (c *scriptedChannel) Finish(ctx context.Context, decision Decision) error {
+	c.finished = &decision
+	return nil
+}
+
+func (c *scriptedChannel) Cancel(ctx context.Context) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	c.canceled = true
+	return nil
+}
+
+func TestRequestWait(t *testing.T) {
+	testCases := []struct {
+		name           string
+		polls          [][]Vote
+		expectedStatus Status
+	}{
+		{
+			name:           "approved",
+			polls:          [][]Vote{nil, {{User: "login1", Action: ActionApprove}}, {{User: "login2", Action: ActionApprove}}},
+			expectedStatus: StatusApproved,
+		},
+		{
+			name:           "denied",
+			polls:          [][]Vote{{{User: "login1", Action: ActionApprove}}, {{User: "login2", Action: ActionDeny, Reason: "not today"}}},
+			expectedStatus: StatusDenied,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			evaluator, err := NewEvaluator(Policy{Approvers: []string{"login1", "login2"}})
+			if err != nil {
+				t.Fatalf("error creating evaluator: %v", err)
+			}
+			channel := &scriptedChannel{polls: testCase.polls}
+			request := &Request{Channel: channel, Evaluator: evaluator, PollingInterval: time.Millisecond}
+			if err := request.Open(context.Background()); err != nil {
+				t.Fatalf("error opening request: %v", err)
+			}
+
+			result, err := request.Wait(context.Background())
+			if err != nil {
+				t.Fatalf("error waiting: %v", err)
+			}
+			if result.Status != testCase.expectedStatus {
+				t.Fatalf("status %s, expected %s", result.Status, testCase.expectedStatus)
+			}
+			if channel.finished == nil || channel.finished.Status != testCase.expectedStatus {
+				t.Fatalf("finished with %v, expected %s", channel.finished, testCase.expectedStatus)
+			}
+		})
+	}
+}
+
+func TestRequestWaitCanceled(t *testing.T) {
+	evaluator, err := NewEvaluator(Policy{Approvers: []string{"login1"}})
+	if err != nil {
+		t.Fatalf("error creating evaluator: %v", err)
+	}
+	channel := &scriptedChannel{}
+	request := &Request{Channel: channel, Evaluator: evaluator, PollingInterval: time.Hour}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	result, err := request.Wait(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if result.Status != StatusPending || result.Approved() {
+		t.Fatalf("status %s, expected %s", result.Status, StatusPending)
+	}
+	if !channel.canceled {
+		t.Fatalf("expected the request to be cancelled through the channel")
+	}
+	if channel.finished != nil {
+		t.Fatalf("expected the request not to be finished")
+	}
+}
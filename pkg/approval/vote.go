@@ -0,0 +1,52 @@
+package approval
+
+import (
+	"sort"
+	"time"
+)
+
+// Action is what a vote asks for.
+type Action string
+
+const (
+	ActionApprove Action = "approve"
+	ActionDeny    Action = "deny"
+	ActionHold    Action = "hold"
+	ActionUnhold  Action = "unhold"
+	ActionRevoke  Action = "revoke"
+)
+
+// Vote is a single approver action, regardless of where it came from.
+type Vote struct {
+	User   string
+	Action Action
+	Reason string
+	// Source names where the vote came from, e.g. "comment" or "reaction".
+	Source    string
+	CreatedAt time.Time
+}
+
+// MergeVotes combines votes from several sources into the order they were
+// cast in.
+func MergeVotes(voteSets ...[]Vote) []Vote {
+	var merged []Vote
+	for _, votes := range voteSets {
+		merged = append(merged, votes...)
+	}
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].CreatedAt.Before(merged[j].CreatedAt)
+	})
+	return merged
+}
+
+// VotesAfter returns the votes cast at or after t, e.g. the ones cast on an
+// existing issue after the approval was requested on it.
+func VotesAfter(votes []Vote, t time.Time) []Vote {
+	var after []Vote
+	for _, v := range votes {
+		if !v.CreatedAt.Before(t) {
+			after = append(after, v)
+		}
+	}
+	return after
+}
@@ -0,0 +1,43 @@
+package approval
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMergeVotes(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	comments := []Vote{
+		{User: "login1", Action: ActionApprove, Source: "comment", CreatedAt: start},
+		{User: "login2", Action: ActionDeny, Source: "comment", CreatedAt: start.Add(2 * time.Minute)},
+	}
+	reactions := []Vote{
+		{User: "login3", Action: ActionApprove, Source: "reaction", CreatedAt: start.Add(time.Minute)},
+	}
+
+	actual := MergeVotes(comments, reactions)
+	expected := []Vote{comments[0], reactions[0], comments[1]}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("actual %v, expected %v", actual, expected)
+	}
+}
+
+func TestVotesAfter(t *testing.T) {
+	marker := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	votes := []Vote{
+		{User: "login1", Action: ActionApprove, CreatedAt: marker.Add(-time.Minute)},
+		{User: "login2", Action: ActionApprove, CreatedAt: marker},
+		{User: "login3", Action: ActionDeny, CreatedAt: marker.Add(time.Minute)},
+	}
+
+	actual := VotesAfter(votes, marker)
+	expected := votes[1:]
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("actual %v, expected %v", actual, expected)
+	}
+
+	if actual := VotesAfter(votes, time.Time{}); !reflect.DeepEqual(actual, votes) {
+		t.Fatalf("actual %v, expected all votes with zero time", actual)
+	}
+}
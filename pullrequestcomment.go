@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-github/v43/github"
+
+	"github.com/trstringer/manual-approval/pkg/approval"
+)
+
+// pullRequestCommentChannel posts the approval prompt as a comment on the pull
+// request that triggered the workflow, instead of creating an issue. Votes
+// are read from the pull request comments made after the prompt, and the
+// prompt is edited with the final status once the request is decided.
+type pullRequestCommentChannel struct {
+	apprv  *approvalEnvironment
+	client *github.Client
+
+	promptID   int64
+	promptBody string
+}
+
+func (c *pullRequestCommentChannel) CreateRequest(ctx context.Context) error {
+	a := c.apprv
+	pullRequest, err := readEventPullRequest()
+	if err != nil {
+		return err
+	}
+	a.approvalIssueNumber = pullRequest.Number
+
+	c.promptBody = fmt.Sprintf("## %s\n\n%s", a.approvalRequestTitle(), a.approvalRequestBody())
+	fmt.Fprintf(a.log, "Posting approval request on pull request %s:\n%s\n", pullRequest.HTMLURL, c.promptBody)
+	prompt, _, err := c.client.Issues.CreateComment(ctx, a.repoOwner, a.repo, pullRequest.Number, &github.IssueComment{
+		Body: &c.promptBody,
+	})
+	if err != nil {
+		return fmt.Errorf("error commenting on pull request: %w", err)
+	}
+	c.promptID = prompt.GetID()
+	a.issueAuthor = prompt.GetUser().GetLogin()
+	a.approvalIssue = &github.Issue{
+		Number:  &pullRequest.Number,
+		HTMLURL: github.String(prompt.GetHTMLURL()),
+	}
+
+	for _, chunk := range splitLongString(a.issueBody) {
+		chunk := chunk
+		_, _, err := c.client.Issues.CreateComment(ctx, a.repoOwner, a.repo, pullRequest.Number, &github.IssueComment{
+			Body: &chunk,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to add comment chunk to pull request: %w", err)
+		}
+	}
+	return nil
+}
+
+func (c *pullRequestCommentChannel) ListVotes(ctx context.Context) ([]approval.Vote, error) {
+	a := c.apprv
+	comments, err := listIssueComments(ctx, c.client, a.repoOwner, a.repo, a.approvalIssueNumber)
+	if err != nil {
+		return nil, fmt.Errorf("error getting comments: %w", err)
+	}
+
+	comments = commentsAfter(comments, c.promptID)
+	comments, a.ignoredCommentIDs = filterComments(comments, a.editedCommentPolicy)
+	if len(a.ignoredCommentIDs) > 0 {
+		fmt.Fprintf(a.log, "Ignoring %d edited comment(s): %v\n", len(a.ignoredCommentIDs), a.ignoredCommentIDs)
+	}
+	return a.evaluator.VotesFromComments(approvalComments(comments)), nil
+}
+
+func (c *pullRequestCommentChannel) Review(ctx context.Context, decision approval.Decision) (approval.Decision, error) {
+	return decision, nil
+}
+
+func (c *pullRequestCommentChannel) Finish(ctx context.Context, decision approval.Decision) error {
+	var status string
+	if decision.Status == approval.StatusApproved {
+		status = fmt.Sprintf("✅ **Approved.** The required number of approvals (%d) has been met; continuing workflow.", c.apprv.minimumApprovals)
+	} else {
+		status = fmt.Sprintf("❌ **Denied.** Request denied %s", denialSuffix(c.apprv.failOnDenial))
+	}
+	return c.updatePrompt(ctx, status)
+}
+
+func (c *pullRequestCommentChannel) Cancel(ctx context.Context) error {
+	status := "⚠️ **Cancelled.** The workflow was cancelled while waiting for approval."
+	fmt.Fprintln(c.apprv.log, status)
+	return c.updatePrompt(ctx, status)
+}
+
+// updatePrompt replaces the prompt comment with the original prompt followed
+// by the final status.
+func (c *pullRequestCommentChannel) updatePrompt(ctx context.Context, status string) error {
+	a := c.apprv
+	body := fmt.Sprintf("%s\n\n---\n\n%s", c.promptBody, status)
+	_, _, err := c.client.Issues.EditComment(ctx, a.repoOwner, a.repo, c.promptID, &github.IssueComment{
+		Body: &body,
+	})
+	if err != nil {
+		return fmt.Errorf("error updating approval request comment: %w", err)
+	}
+	return nil
+}
+
+// listIssueComments lists all comments on an issue or pull request.
+func listIssueComments(ctx context.Context, client *github.Client, owner, repo string, number int) ([]*github.IssueComment, error) {
+	var comments []*github.IssueComment
+	opts := &github.IssueListCommentsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		page, resp, err := client.Issues.ListComments(ctx, owner, repo, number, opts)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, page...)
+		if resp.NextPage == 0 {
+			return comments, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// commentsAfter returns the comments made after the comment with the given
+// ID. Comment IDs only ever increase, so they are used rather than
+// timestamps.
+func commentsAfter(comments []*github.IssueComment, id int64) []*github.IssueComment {
+	var after []*github.IssueComment
+	for _, comment := range comments {
+		if comment.GetID() > id {
+			after = append(after, comment)
+		}
+	}
+	return after
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-github/v43/github"
+
+	"github.com/trstringer/manual-approval/pkg/approval"
+)
+
+func TestApprovalFromCommentsAfterPrompt(t *testing.T) {
+	comment := func(id int64, login, body string) *github.IssueComment {
+		return &github.IssueComment{
+			ID:   github.Int64(id),
+			User: &github.User{Login: github.String(login)},
+			Body: github.String(body),
+		}
+	}
+
+	testCases := []struct {
+		name           string
+		comments       []*github.IssueComment
+		promptID       int64
+		expectedStatus approval.Status
+	}{
+		{
+			name:           "approved_after_prompt",
+			comments:       []*github.IssueComment{comment(10, "", "prompt"), comment(11, "login1", "approved")},
+			promptID:       10,
+			expectedStatus: approval.StatusApproved,
+		},
+		{
+			name:           "approved_before_prompt",
+			comments:       []*github.IssueComment{comment(9, "login1", "approved"), comment(10, "", "prompt")},
+			promptID:       10,
+			expectedStatus: approval.StatusPending,
+		},
+		{
+			name:           "denied_before_prompt_approved_after",
+			comments:       []*github.IssueComment{comment(9, "login1", "denied"), comment(10, "", "prompt"), comment(11, "login1", "lgtm")},
+			promptID:       10,
+			expectedStatus: approval.StatusApproved,
+		},
+		{
+			name:           "denied_after_prompt",
+			comments:       []*github.IssueComment{comment(10, "", "prompt"), comment(12, "login1", "deny")},
+			promptID:       10,
+			expectedStatus: approval.StatusDenied,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			comments := commentsAfter(testCase.comments, testCase.promptID)
+			evaluator, err := approval.NewEvaluator(approval.Policy{
+				Approvers:        []string{"login1"},
+				MinimumApprovals: 1,
+			})
+			if err != nil {
+				t.Fatalf("error creating evaluator: %v", err)
+			}
+			actual := evaluator.Evaluate(evaluator.VotesFromComments(approvalComments(comments)))
+			if actual.Status != testCase.expectedStatus {
+				t.Fatalf("actual %s, expected %s", actual.Status, testCase.expectedStatus)
+			}
+		})
+	}
+}
+
+func TestNewPullRequestCommentChannelRejectsIssueOnlyInputs(t *testing.T) {
+	for name, apprv := range issueOnlyInputs() {
+		t.Run(name, func(t *testing.T) {
+			if _, err := newApprovalChannel(approvalTargetPullRequest, apprv, nil); err == nil {
+				t.Fatalf("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v43/github"
+
+	"github.com/trstringer/manual-approval/pkg/approval"
+)
+
+const (
+	reviewStateApproved         string = "APPROVED"
+	reviewStateChangesRequested string = "CHANGES_REQUESTED"
+	reviewStateDismissed        string = "DISMISSED"
+)
+
+// pullRequestReviewChannel requests reviews from the approvers on the pull
+// request that triggered the workflow. An approving review counts as an
+// approval and a review requesting changes as a denial.
+type pullRequestReviewChannel struct {
+	apprv  *approvalEnvironment
+	client *github.Client
+
+	requestedAt time.Time
+}
+
+func (c *pullRequestReviewChannel) CreateRequest(ctx context.Context) error {
+	a := c.apprv
+	pullRequest, err := readEventPullRequest()
+	if err != nil {
+		return err
+	}
+
+	// GitHub rejects review requests for the author of the pull request.
+	var reviewers []string
+	for _, approver := range a.issueApprovers {
+		if !strings.EqualFold(approver, pullRequest.User.Login) {
+			reviewers = append(reviewers, approver)
+		}
+	}
+
+	a.approvalIssueNumber = pullRequest.Number
+	a.approvalIssue = &github.Issue{
+		Number:  &pullRequest.Number,
+		HTMLURL: &pullRequest.HTMLURL,
+	}
+
+	fmt.Fprintf(a.log, "Requesting reviews on pull request %s from %v\n", pullRequest.HTMLURL, reviewers)
+	if len(reviewers) > 0 {
+		_, _, err = c.client.PullRequests.RequestReviewers(ctx, a.repoOwner, a.repo, pullRequest.Number, github.ReviewersRequest{
+			Reviewers: reviewers,
+		})
+		if err != nil {
+			return fmt.Errorf("error requesting reviews: %w", err)
+		}
+	}
+
+	prompt := fmt.Sprintf("## %s\n\n%s", a.approvalRequestTitle(), a.approvalRequestBody())
+	created, err := c.comment(ctx, prompt)
+	if err != nil {
+		return fmt.Errorf("error commenting on pull request: %w", err)
+	}
+	// Only reviews submitted after the request was made count, so that an
+	// approval left on the pull request earlier doesn't approve this run.
+	c.requestedAt = created.GetCreatedAt()
+
+	for _, chunk := range splitLongString(a.issueBody) {
+		if _, err := c.comment(ctx, chunk); err != nil {
+			return fmt.Errorf("failed to add comment chunk to pull request: %w", err)
+		}
+	}
+	return nil
+}
+
+func (c *pullRequestReviewChannel) comment(ctx context.Context, body string) (*github.IssueComment, error) {
+	a := c.apprv
+	created, _, err := c.client.Issues.CreateComment(ctx, a.repoOwner, a.repo, a.approvalIssueNumber, &github.IssueComment{
+		Body: &body,
+	})
+	return created, err
+}
+
+func (c *pullRequestReviewChannel) ListVotes(ctx context.Context) ([]approval.Vote, error) {
+	a := c.apprv
+	var reviews []*github.PullRequestReview
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		page, resp, err := c.client.PullRequests.ListReviews(ctx, a.repoOwner, a.repo, a.approvalIssueNumber, opts)
+		if err != nil {
+			return nil, fmt.Errorf("error getting reviews: %w", err)
+		}
+		reviews = append(reviews, page...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	return votesFromReviews(reviews, c.requestedAt), nil
+}
+
+// votesFromReviews turns the reviews submitted after requestedAt into votes.
+// As on GitHub itself, only each reviewer's latest approving, change
+// requesting or dismissed review counts, so a reviewer can change their mind
+// and a dismissed review no longer counts.
+func votesFromReviews(reviews []*github.PullRequestReview, requestedAt time.Time) []approval.Vote {
+	latest := map[string]*github.PullRequestReview{}
+	var reviewers []string
+	for _, review := range reviews {
+		if review.GetSubmittedAt().Before(requestedAt) {
+			continue
+		}
+		switch review.GetState() {
+		case reviewStateApproved, reviewStateChangesRequested, reviewStateDismissed:
+		default:
+			continue
+		}
+
+		login := strings.ToLower(review.GetUser().GetLogin())
+		previous, ok := latest[login]
+		if !ok {
+			reviewers = append(reviewers, login)
+		}
+		if !ok || !review.GetSubmittedAt().Before(previous.GetSubmittedAt()) {
+			latest[login] = review
+		}
+	}
+
+	var votes []approval.Vote
+	for _, login := range reviewers {
+		review := latest[login]
+		var action approval.Action
+		switch review.GetState() {
+		case reviewStateApproved:
+			action = approval.ActionApprove
+		case reviewStateChangesRequested:
+			action = approval.ActionDeny
+		default:
+			continue
+		}
+		votes = append(votes, approval.Vote{
+			User:      review.GetUser().GetLogin(),
+			Action:    action,
+			Reason:    strings.TrimSpace(review.GetBody()),
+			Source:    "review",
+			CreatedAt: review.GetSubmittedAt(),
+		})
+	}
+	sort.SliceStable(votes, func(i, j int) bool {
+		return votes[i].CreatedAt.Before(votes[j].CreatedAt)
+	})
+	return votes
+}
+
+func (c *pullRequestReviewChannel) Review(ctx context.Context, decision approval.Decision) (approval.Decision, error) {
+	return decision, nil
+}
+
+func (c *pullRequestReviewChannel) Finish(ctx context.Context, decision approval.Decision) error {
+	var body string
+	if decision.Status == approval.StatusApproved {
+		body = fmt.Sprintf("The required number of approvals (%d) has been met; continuing workflow.", c.apprv.minimumApprovals)
+	} else {
+		body = fmt.Sprintf("Changes were requested. Request denied %s", denialSuffix(c.apprv.failOnDenial))
+	}
+	if _, err := c.comment(ctx, body); err != nil {
+		return fmt.Errorf("error commenting on pull request: %w", err)
+	}
+	return nil
+}
+
+func (c *pullRequestReviewChannel) Cancel(ctx context.Context) error {
+	body := "Workflow cancelled, no longer waiting for reviews."
+	fmt.Fprintln(c.apprv.log, body)
+	if _, err := c.comment(ctx, body); err != nil {
+		return fmt.Errorf("error commenting on pull request: %w", err)
+	}
+	return nil
+}
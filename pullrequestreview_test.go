@@ -0,0 +1,152 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v43/github"
+
+	"github.com/trstringer/manual-approval/pkg/approval"
+)
+
+func TestApprovalFromReviews(t *testing.T) {
+	requestedAt := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	review := func(login, state string, offset time.Duration) *github.PullRequestReview {
+		submittedAt := requestedAt.Add(offset)
+		return &github.PullRequestReview{
+			User:        &github.User{Login: github.String(login)},
+			State:       github.String(state),
+			Body:        github.String(""),
+			SubmittedAt: &submittedAt,
+		}
+	}
+
+	testCases := []struct {
+		name             string
+		reviews          []*github.PullRequestReview
+		approvers        []string
+		minimumApprovals int
+		expectedStatus   approval.Status
+	}{
+		{
+			name:           "approved",
+			reviews:        []*github.PullRequestReview{review("login1", reviewStateApproved, time.Minute)},
+			approvers:      []string{"login1"},
+			expectedStatus: approval.StatusApproved,
+		},
+		{
+			name:           "changes_requested",
+			reviews:        []*github.PullRequestReview{review("login1", reviewStateChangesRequested, time.Minute)},
+			approvers:      []string{"login1"},
+			expectedStatus: approval.StatusDenied,
+		},
+		{
+			name:           "approval_before_request_ignored",
+			reviews:        []*github.PullRequestReview{review("login1", reviewStateApproved, -time.Minute)},
+			approvers:      []string{"login1"},
+			expectedStatus: approval.StatusPending,
+		},
+		{
+			name:           "comment_review_ignored",
+			reviews:        []*github.PullRequestReview{review("login1", "COMMENTED", time.Minute)},
+			approvers:      []string{"login1"},
+			expectedStatus: approval.StatusPending,
+		},
+		{
+			name: "latest_review_wins",
+			reviews: []*github.PullRequestReview{
+				review("login1", reviewStateChangesRequested, time.Minute),
+				review("login1", reviewStateApproved, 2*time.Minute),
+			},
+			approvers:      []string{"login1"},
+			expectedStatus: approval.StatusApproved,
+		},
+		{
+			name: "dismissed_review_no_longer_counts",
+			reviews: []*github.PullRequestReview{
+				review("login1", reviewStateDismissed, time.Minute),
+			},
+			approvers:      []string{"login1"},
+			expectedStatus: approval.StatusPending,
+		},
+		{
+			name: "minimum_approvals",
+			reviews: []*github.PullRequestReview{
+				review("login1", reviewStateApproved, time.Minute),
+				review("login3", reviewStateApproved, 2*time.Minute),
+			},
+			approvers:        []string{"login1", "login2", "login3"},
+			minimumApprovals: 2,
+			expectedStatus:   approval.StatusApproved,
+		},
+		{
+			name: "non_approver_review_ignored",
+			reviews: []*github.PullRequestReview{
+				review("outsider", reviewStateChangesRequested, time.Minute),
+			},
+			approvers:      []string{"login1"},
+			expectedStatus: approval.StatusPending,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			votes := votesFromReviews(testCase.reviews, requestedAt)
+			actual := evaluateVotes(t, votes, testCase.approvers, testCase.minimumApprovals)
+			if actual.Status != testCase.expectedStatus {
+				t.Fatalf("actual %s, expected %s", actual.Status, testCase.expectedStatus)
+			}
+		})
+	}
+}
+
+func TestReadEventPullRequest(t *testing.T) {
+	testCases := []struct {
+		name           string
+		payload        string
+		expectedNumber int
+		isSuccess      bool
+	}{
+		{
+			name:           "pull_request_event",
+			payload:        `{"action":"opened","pull_request":{"number":42,"html_url":"https://github.com/o/r/pull/42","user":{"login":"author"}}}`,
+			expectedNumber: 42,
+			isSuccess:      true,
+		},
+		{
+			name:      "push_event",
+			payload:   `{"ref":"refs/heads/main"}`,
+			isSuccess: false,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			eventPath := filepath.Join(t.TempDir(), "event.json")
+			if err := os.WriteFile(eventPath, []byte(testCase.payload), 0600); err != nil {
+				t.Fatalf("error writing event payload: %v", err)
+			}
+			t.Setenv(envVarEventPath, eventPath)
+
+			actual, err := readEventPullRequest()
+			if (err == nil) != testCase.isSuccess {
+				t.Fatalf("expected success %v but got error %v", testCase.isSuccess, err)
+			}
+			if actual.Number != testCase.expectedNumber {
+				t.Fatalf("expected number %d but got %d", testCase.expectedNumber, actual.Number)
+			}
+		})
+	}
+}
+
+func TestNewPullRequestReviewChannelRejectsIssueOnlyInputs(t *testing.T) {
+	for name, apprv := range issueOnlyInputs() {
+		t.Run(name, func(t *testing.T) {
+			if _, err := newApprovalChannel(approvalTargetPullRequestReview, apprv, nil); err == nil {
+				t.Fatalf("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v43/github"
+
+	"github.com/trstringer/manual-approval/pkg/approval"
+)
+
+// reactionContents are the reactions GitHub supports on issues.
+var reactionContents = []string{"+1", "-1", "laugh", "confused", "heart", "hooray", "rocket", "eyes"}
+
+// issueReaction is a reaction on the approval issue. go-github's Reaction
+// doesn't carry created_at, which is needed to order reactions among
+// comments, so the reactions endpoint is decoded into this struct instead.
+type issueReaction struct {
+	ID   int64 `json:"id"`
+	User struct {
+		Login string `json:"login"`
+	} `json:"user"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// parseReactionMapping builds the reaction content to vote mapping from the
+// comma separated approval and denial reaction inputs.
+func parseReactionMapping(approvalReactionsRaw, denialReactionsRaw string) (map[string]approval.Action, error) {
+	mapping := map[string]approval.Action{}
+
+	add := func(raw string, action approval.Action) error {
+		for _, content := range strings.Split(raw, ",") {
+			content = strings.TrimSpace(content)
+			if content == "" {
+				continue
+			}
+			if !isReactionContent(content) {
+				return fmt.Errorf("unknown reaction %q, expected one of %v", content, reactionContents)
+			}
+			if existing, ok := mapping[content]; ok && existing != action {
+				return fmt.Errorf("reaction %q is both an approval and a denial reaction", content)
+			}
+			mapping[content] = action
+		}
+		return nil
+	}
+
+	if err := add(approvalReactionsRaw, approval.ActionApprove); err != nil {
+		return nil, err
+	}
+	if err := add(denialReactionsRaw, approval.ActionDeny); err != nil {
+		return nil, err
+	}
+	return mapping, nil
+}
+
+func isReactionContent(content string) bool {
+	for _, known := range reactionContents {
+		if content == known {
+			return true
+		}
+	}
+	return false
+}
+
+func listIssueReactions(ctx context.Context, client *github.Client, owner, repo string, number int) ([]issueReaction, error) {
+	var reactions []issueReaction
+	page := 1
+	for page != 0 {
+		req, err := client.NewRequest("GET",
+			fmt.Sprintf("repos/%s/%s/issues/%d/reactions?per_page=100&page=%d", owner, repo, number, page),
+			nil,
+		)
+		if err != nil {
+			return nil, err
+		}
+		// The reactions API used to require a preview media type, which
+		// older GitHub Enterprise Server versions still enforce.
+		req.Header.Set("Accept", "application/vnd.github.squirrel-girl-preview+json")
+
+		var pageReactions []issueReaction
+		resp, err := client.Do(ctx, req, &pageReactions)
+		if err != nil {
+			return nil, err
+		}
+		reactions = append(reactions, pageReactions...)
+		page = resp.NextPage
+	}
+	return reactions, nil
+}
+
+// votesFromReactions turns reactions into votes using the mapping. Reactions
+// by ignoredUser, which is the account that opened the approval issue, never
+// count.
+func votesFromReactions(reactions []issueReaction, mapping map[string]approval.Action, ignoredUser string) []approval.Vote {
+	var votes []approval.Vote
+	for _, reaction := range reactions {
+		if ignoredUser != "" && strings.EqualFold(reaction.User.Login, ignoredUser) {
+			continue
+		}
+		action, ok := mapping[reaction.Content]
+		if !ok {
+			continue
+		}
+		votes = append(votes, approval.Vote{
+			User:      reaction.User.Login,
+			Action:    action,
+			Source:    "reaction",
+			CreatedAt: reaction.CreatedAt,
+		})
+	}
+	return votes
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/trstringer/manual-approval/pkg/approval"
+)
+
+func TestParseReactionMapping(t *testing.T) {
+	testCases := []struct {
+		name      string
+		approval  string
+		denial    string
+		expected  map[string]approval.Action
+		isSuccess bool
+	}{
+		{
+			name:     "defaults",
+			approval: defaultApprovalReactions,
+			denial:   defaultDenialReactions,
+			expected: map[string]approval.Action{
+				"+1":       approval.ActionApprove,
+				"rocket":   approval.ActionApprove,
+				"-1":       approval.ActionDeny,
+				"confused": approval.ActionDeny,
+			},
+			isSuccess: true,
+		},
+		{
+			name:      "whitespace_and_empty_entries",
+			approval:  " heart , ",
+			denial:    "",
+			expected:  map[string]approval.Action{"heart": approval.ActionApprove},
+			isSuccess: true,
+		},
+		{
+			name:      "unknown_reaction",
+			approval:  "thumbsup",
+			isSuccess: false,
+		},
+		{
+			name:      "reaction_in_both",
+			approval:  "+1",
+			denial:    "+1",
+			isSuccess: false,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			actual, err := parseReactionMapping(testCase.approval, testCase.denial)
+			if (err == nil) != testCase.isSuccess {
+				t.Fatalf("expected success %v but got error %v", testCase.isSuccess, err)
+			}
+			if testCase.isSuccess && !reflect.DeepEqual(actual, testCase.expected) {
+				t.Fatalf("expected %v but got %v", testCase.expected, actual)
+			}
+		})
+	}
+}
+
+func TestApprovalFromReactionsAndComments(t *testing.T) {
+	mapping, err := parseReactionMapping(defaultApprovalReactions, defaultDenialReactions)
+	if err != nil {
+		t.Fatalf("error parsing reaction mapping: %v", err)
+	}
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	reaction := func(login, content string, offset time.Duration) issueReaction {
+		r := issueReaction{Content: content, CreatedAt: start.Add(offset)}
+		r.User.Login = login
+		return r
+	}
+
+	testCases := []struct {
+		name           string
+		commentVotes   []approval.Vote
+		reactions      []issueReaction
+		approvers      []string
+		expectedStatus approval.Status
+	}{
+		{
+			name:           "reaction_approves",
+			reactions:      []issueReaction{reaction("login1", "+1", 0)},
+			approvers:      []string{"login1"},
+			expectedStatus: approval.StatusApproved,
+		},
+		{
+			name:           "reaction_denies",
+			reactions:      []issueReaction{reaction("login1", "confused", 0)},
+			approvers:      []string{"login1"},
+			expectedStatus: approval.StatusDenied,
+		},
+		{
+			name:           "unmapped_reaction_ignored",
+			reactions:      []issueReaction{reaction("login1", "eyes", 0)},
+			approvers:      []string{"login1"},
+			expectedStatus: approval.StatusPending,
+		},
+		{
+			name:           "bot_reaction_ignored",
+			reactions:      []issueReaction{reaction("github-actions[bot]", "+1", 0)},
+			approvers:      []string{"github-actions[bot]"},
+			expectedStatus: approval.StatusPending,
+		},
+		{
+			name: "reaction_and_comment_combine",
+			commentVotes: []approval.Vote{
+				{User: "login2", Action: approval.ActionApprove, CreatedAt: start.Add(time.Minute)},
+			},
+			reactions:      []issueReaction{reaction("login1", "rocket", 0)},
+			approvers:      []string{"login1", "login2"},
+			expectedStatus: approval.StatusApproved,
+		},
+		{
+			name: "earlier_reaction_approval_ignores_later_comment_denial",
+			commentVotes: []approval.Vote{
+				{User: "login1", Action: approval.ActionDeny, CreatedAt: start.Add(time.Minute)},
+			},
+			reactions:      []issueReaction{reaction("login1", "+1", 0)},
+			approvers:      []string{"login1", "login2"},
+			expectedStatus: approval.StatusPending,
+		},
+		{
+			name: "earlier_comment_denial_wins_over_later_reaction",
+			commentVotes: []approval.Vote{
+				{User: "login1", Action: approval.ActionDeny, CreatedAt: start},
+			},
+			reactions:      []issueReaction{reaction("login2", "+1", time.Minute)},
+			approvers:      []string{"login1", "login2"},
+			expectedStatus: approval.StatusDenied,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			votes := approval.MergeVotes(testCase.commentVotes, votesFromReactions(testCase.reactions, mapping, "github-actions[bot]"))
+			actual := evaluateVotes(t, votes, testCase.approvers, 0)
+			if actual.Status != testCase.expectedStatus {
+				t.Fatalf("actual %s, expected %s", actual.Status, testCase.expectedStatus)
+			}
+		})
+	}
+}
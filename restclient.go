@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// restClient is a minimal client for the JSON REST APIs of the backends that
+// go-github doesn't cover.
+type restClient struct {
+	// api names the API in errors, e.g. "gitlab".
+	api     string
+	baseURL string
+	// authorize adds the credentials to every request.
+	authorize  func(req *http.Request)
+	httpClient *http.Client
+}
+
+func newRESTClient(api, baseURL string, authorize func(req *http.Request)) restClient {
+	return restClient{
+		api:        api,
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		authorize:  authorize,
+		httpClient: http.DefaultClient,
+	}
+}
+
+// restError is returned for non-2xx responses.
+type restError struct {
+	API        string
+	StatusCode int
+	Message    string
+}
+
+func (e *restError) Error() string {
+	return fmt.Sprintf("%s: %d %s", e.API, e.StatusCode, e.Message)
+}
+
+// do sends a JSON request to path, relative to the base URL, and decodes the
+// JSON response into result if it isn't nil.
+func (c *restClient) do(ctx context.Context, method, path string, body, result interface{}) error {
+	_, err := c.send(ctx, method, path, "application/json", body, result)
+	return err
+}
+
+// send is do for requests whose body has to be sent as another content type,
+// or whose response headers are needed.
+func (c *restClient) send(ctx context.Context, method, path, contentType string, body, result interface{}) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(raw)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+"/"+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if c.authorize != nil {
+		c.authorize(req)
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close() // Nothing to handle if closing the body fails.
+	}()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return resp, &restError{API: c.api, StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(message))}
+	}
+	if result != nil {
+		if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+			return resp, err
+		}
+	}
+	return resp, nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/google/go-github/v43/github"
+
+	"github.com/trstringer/manual-approval/pkg/approval"
+)
+
+// repositoryRole is the lowest repository permission an approver selected by
+// a role:<role> approver needs, e.g. role:maintain.
+type repositoryRole string
+
+const (
+	roleAdmin    repositoryRole = "admin"
+	roleMaintain repositoryRole = "maintain"
+	roleWrite    repositoryRole = "write"
+)
+
+const rolePrefix = "role:"
+
+// roleRanks orders repository permissions. The collaborators API names them
+// pull, push etc. and the permission API read, write etc., so both are
+// ranked.
+var roleRanks = map[string]int{
+	"read":     1,
+	"pull":     1,
+	"triage":   2,
+	"write":    3,
+	"push":     3,
+	"maintain": 4,
+	"admin":    5,
+}
+
+// parseRoleSelector parses a role:<role> approver. It reports false if the
+// approver isn't a role selector.
+func parseRoleSelector(approver string) (repositoryRole, bool, error) {
+	raw, isRole := strings.CutPrefix(strings.ToLower(approver), rolePrefix)
+	if !isRole {
+		return "", false, nil
+	}
+	switch role := repositoryRole(raw); role {
+	case roleAdmin, roleMaintain, roleWrite:
+		return role, true, nil
+	default:
+		return "", true, fmt.Errorf("unknown role in approver %q, expected %s%s, %s%s or %s%s", approver, rolePrefix, roleAdmin, rolePrefix, roleMaintain, rolePrefix, roleWrite)
+	}
+}
+
+// allows reports whether a user with the permission has the role.
+func (r repositoryRole) allows(permission string) bool {
+	return roleRanks[strings.ToLower(permission)] >= roleRanks[string(r)]
+}
+
+// apiPermission is the name of the role in the collaborators API.
+func (r repositoryRole) apiPermission() string {
+	if r == roleWrite {
+		return "push"
+	}
+	return string(r)
+}
+
+// roleExpander returns the users that have a role on the repository.
+type roleExpander func(role repositoryRole, workflowInitiator string, shouldExcludeWorkflowInitiator bool) ([]string, error)
+
+// collaboratorsWithRole lists the collaborators of the repository that have
+// the role, directly or through a team or the org.
+func collaboratorsWithRole(ctx context.Context, log io.Writer, client *github.Client, owner, repo string, role repositoryRole, workflowInitiator string, shouldExcludeWorkflowInitiator bool) ([]string, error) {
+	fmt.Fprintf(log, "Listing collaborators of %s/%s with the %s role\n", owner, repo, role)
+
+	userNames := []string{}
+	page := 1
+	for page != 0 {
+		req, err := client.NewRequest("GET", fmt.Sprintf("repos/%s/%s/collaborators?affiliation=all&permission=%s&per_page=100&page=%d", owner, repo, url.QueryEscape(role.apiPermission()), page), nil)
+		if err != nil {
+			return nil, err
+		}
+		var users []*github.User
+		resp, err := client.Do(ctx, req, &users)
+		if err != nil {
+			return nil, fmt.Errorf("error listing collaborators of %s/%s: %w", owner, repo, err)
+		}
+		for _, user := range users {
+			if !hasRole(user.Permissions, role) {
+				continue
+			}
+			userName := user.GetLogin()
+			if strings.EqualFold(userName, workflowInitiator) && shouldExcludeWorkflowInitiator {
+				fmt.Fprintf(log, "Not adding user '%s' with the %s role as an approver as they are the workflow initiator\n", userName, role)
+				continue
+			}
+			userNames = append(userNames, userName)
+		}
+		page = resp.NextPage
+	}
+	return userNames, nil
+}
+
+// hasRole reports whether the permissions of a collaborator include the
+// role. Servers that don't filter by permission still return them.
+func hasRole(permissions map[string]bool, role repositoryRole) bool {
+	for permission, granted := range permissions {
+		if granted && role.allows(permission) {
+			return true
+		}
+	}
+	return false
+}
+
+// collaboratorPermission returns the current permission of a user on the
+// repository. The role name tells maintain and triage apart from write and
+// read, but custom roles only have their base permission.
+func collaboratorPermission(ctx context.Context, client *github.Client, owner, repo, user string) (string, error) {
+	req, err := client.NewRequest("GET", fmt.Sprintf("repos/%s/%s/collaborators/%s/permission", owner, repo, url.PathEscape(user)), nil)
+	if err != nil {
+		return "", err
+	}
+	var level struct {
+		Permission string `json:"permission"`
+		RoleName   string `json:"role_name"`
+	}
+	if _, err := client.Do(ctx, req, &level); err != nil {
+		return "", err
+	}
+	if _, ok := roleRanks[level.RoleName]; ok {
+		return level.RoleName, nil
+	}
+	return level.Permission, nil
+}
+
+// roleCheckingChannel re-checks the repository permission of voters who are
+// approvers only through a role, every time the votes are listed, so that a
+// permission lowered while waiting stops counting.
+type roleCheckingChannel struct {
+	approval.Channel
+	// roleApprovers maps the lowercased logins of those approvers to the
+	// role they were selected by.
+	roleApprovers map[string]repositoryRole
+	permission    func(ctx context.Context, user string) (string, error)
+	log           io.Writer
+}
+
+func (c *roleCheckingChannel) ListVotes(ctx context.Context) ([]approval.Vote, error) {
+	votes, err := c.Channel.ListVotes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed := map[string]bool{}
+	checked := make([]approval.Vote, 0, len(votes))
+	for _, v := range votes {
+		user := strings.ToLower(v.User)
+		role, ok := c.roleApprovers[user]
+		if !ok {
+			checked = append(checked, v)
+			continue
+		}
+		isAllowed, isChecked := allowed[user]
+		if !isChecked {
+			permission, err := c.permission(ctx, v.User)
+			if err != nil {
+				return nil, fmt.Errorf("error checking the permission of %s: %w", v.User, err)
+			}
+			isAllowed = role.allows(permission)
+			if !isAllowed {
+				fmt.Fprintf(c.log, "Ignoring votes of %s, whose permission is now %q instead of %s\n", v.User, permission, role)
+			}
+			allowed[user] = isAllowed
+		}
+		if isAllowed {
+			checked = append(checked, v)
+		}
+	}
+	return checked, nil
+}
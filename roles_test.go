@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v43/github"
+
+	"github.com/trstringer/manual-approval/pkg/approval"
+)
+
+func TestParseRoleSelector(t *testing.T) {
+	testCases := []struct {
+		approver     string
+		expectedRole repositoryRole
+		isRole       bool
+		isSuccess    bool
+	}{
+		{approver: "role:admin", expectedRole: roleAdmin, isRole: true, isSuccess: true},
+		{approver: "Role:Maintain", expectedRole: roleMaintain, isRole: true, isSuccess: true},
+		{approver: "role:write", expectedRole: roleWrite, isRole: true, isSuccess: true},
+		{approver: "role:owner", isRole: true, isSuccess: false},
+		{approver: "login1", isRole: false, isSuccess: true},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.approver, func(t *testing.T) {
+			role, isRole, err := parseRoleSelector(testCase.approver)
+			if (err == nil) != testCase.isSuccess {
+				t.Fatalf("expected success %v, got error %v", testCase.isSuccess, err)
+			}
+			if role != testCase.expectedRole || isRole != testCase.isRole {
+				t.Fatalf("got %q %v, expected %q %v", role, isRole, testCase.expectedRole, testCase.isRole)
+			}
+		})
+	}
+}
+
+func TestRepositoryRoleAllows(t *testing.T) {
+	testCases := []struct {
+		role       repositoryRole
+		permission string
+		isAllowed  bool
+	}{
+		{role: roleWrite, permission: "admin", isAllowed: true},
+		{role: roleWrite, permission: "write", isAllowed: true},
+		{role: roleWrite, permission: "triage", isAllowed: false},
+		{role: roleMaintain, permission: "write", isAllowed: false},
+		{role: roleMaintain, permission: "maintain", isAllowed: true},
+		{role: roleAdmin, permission: "maintain", isAllowed: false},
+		{role: roleAdmin, permission: "none", isAllowed: false},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(string(testCase.role)+"_"+testCase.permission, func(t *testing.T) {
+			if actual := testCase.role.allows(testCase.permission); actual != testCase.isAllowed {
+				t.Fatalf("actual %v, expected %v", actual, testCase.isAllowed)
+			}
+		})
+	}
+}
+
+func newTestRolesClient(t *testing.T) *github.Client {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/owner/repo/collaborators", func(w http.ResponseWriter, r *http.Request) {
+		if permission := r.URL.Query().Get("permission"); permission != "maintain" {
+			t.Errorf("permission %q, expected maintain", permission)
+		}
+		collaborators := []map[string]interface{}{
+			{"login": "login1", "permissions": map[string]bool{"admin": true, "maintain": true, "push": true, "pull": true}},
+			{"login": "login2", "permissions": map[string]bool{"maintain": true, "push": true, "pull": true}},
+			{"login": "login3", "permissions": map[string]bool{"push": true, "pull": true}},
+		}
+		if err := json.NewEncoder(w).Encode(collaborators); err != nil {
+			t.Errorf("error encoding response: %v", err)
+		}
+	})
+	mux.HandleFunc("/repos/owner/repo/collaborators/login2/permission", func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewEncoder(w).Encode(map[string]string{"permission": "write", "role_name": "maintain"}); err != nil {
+			t.Errorf("error encoding response: %v", err)
+		}
+	})
+	mux.HandleFunc("/repos/owner/repo/collaborators/login4/permission", func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewEncoder(w).Encode(map[string]string{"permission": "write", "role_name": "deployer"}); err != nil {
+			t.Errorf("error encoding response: %v", err)
+		}
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	client := github.NewClient(nil)
+	baseURL, err := url.Parse(server.URL + "/")
+	if err != nil {
+		t.Fatalf("error parsing URL: %v", err)
+	}
+	client.BaseURL = baseURL
+	return client
+}
+
+func TestCollaboratorsWithRole(t *testing.T) {
+	client := newTestRolesClient(t)
+
+	users, err := collaboratorsWithRole(context.Background(), io.Discard, client, "owner", "repo", roleMaintain, "login1", true)
+	if err != nil {
+		t.Fatalf("error listing collaborators: %v", err)
+	}
+	if expected := []string{"login2"}; !reflect.DeepEqual(users, expected) {
+		t.Fatalf("actual %v, expected %v", users, expected)
+	}
+}
+
+func TestCollaboratorPermission(t *testing.T) {
+	client := newTestRolesClient(t)
+
+	for user, expected := range map[string]string{"login2": "maintain", "login4": "write"} {
+		permission, err := collaboratorPermission(context.Background(), client, "owner", "repo", user)
+		if err != nil {
+			t.Fatalf("error getting permission: %v", err)
+		}
+		if permission != expected {
+			t.Fatalf("permission of %s %q, expected %q", user, permission, expected)
+		}
+	}
+}
+
+func TestRoleCheckingChannel(t *testing.T) {
+	permissions := map[string]string{"login2": "write", "login3": "maintain"}
+	checks := 0
+	apprv, err := newApprovalEnvironment(approvalOptions{
+		repoFullName:        "owner/repo",
+		repoOwner:           "owner",
+		runID:               1,
+		issueApprovers:      []string{"login1", "login2", "login3"},
+		targetRepoOwner:     "owner",
+		targetRepoName:      "repo",
+		failOnDenial:        true,
+		editedCommentPolicy: editedCommentPolicyReevaluate,
+		commentSyntax:       approval.CommentSyntaxCommands,
+		target:              approvalTargetIssue,
+	})
+	if err != nil {
+		t.Fatalf("error creating approval environment: %v", err)
+	}
+	createdAt := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	issues := newMemoryIssues([]*github.IssueComment{
+		testComment("login1", "/approve", createdAt),
+		testComment("Login2", "/approve", createdAt),
+		testComment("login3", "/approve", createdAt),
+		testComment("login2", "/revoke", createdAt),
+	})
+	channel := &roleCheckingChannel{
+		Channel:       &issueChannel{apprv: apprv, backend: issues},
+		roleApprovers: map[string]repositoryRole{"login2": roleMaintain, "login3": roleMaintain},
+		permission: func(ctx context.Context, user string) (string, error) {
+			checks++
+			return permissions[user], nil
+		},
+		log: io.Discard,
+	}
+	if err := channel.CreateRequest(context.Background()); err != nil {
+		t.Fatalf("error creating request: %v", err)
+	}
+
+	votes, err := channel.ListVotes(context.Background())
+	if err != nil {
+		t.Fatalf("error listing votes: %v", err)
+	}
+	users := []string{}
+	for _, v := range votes {
+		users = append(users, v.User)
+	}
+	if expected := []string{"login1", "login3"}; !reflect.DeepEqual(users, expected) {
+		t.Fatalf("votes of %v, expected %v", users, expected)
+	}
+	if checks != 2 {
+		t.Fatalf("%d permission checks, expected one per role approver", checks)
+	}
+}
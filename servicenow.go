@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/v43/github"
+
+	"github.com/trstringer/manual-approval/pkg/approval"
+)
+
+const (
+	serviceNowChangeTypeNormal   string = "normal"
+	serviceNowChangeTypeStandard string = "standard"
+
+	// serviceNowStateCanceled is the change_request state value of a
+	// cancelled change in the default change model.
+	serviceNowStateCanceled string = "4"
+)
+
+// serviceNowClient is a minimal client for the ServiceNow Table API.
+type serviceNowClient struct {
+	restClient
+}
+
+// newServiceNowClient connects to the instance at servicenow-instance-url
+// with basic authentication.
+func newServiceNowClient(in inputs) *serviceNowClient {
+	user, password := in.get(envVarServiceNowUser), in.get(envVarServiceNowPassword)
+	return &serviceNowClient{
+		restClient: newRESTClient("servicenow", in.get(envVarServiceNowInstanceURL), func(req *http.Request) {
+			req.SetBasicAuth(user, password)
+		}),
+	}
+}
+
+// validateServiceNowInput checks the inputs of the ServiceNow backend. The
+// change's approvers are set in ServiceNow, so neither approvers nor a
+// GitHub token are needed.
+func validateServiceNowInput(in inputs) error {
+	missingEnvVars := []string{}
+	for _, envVar := range []string{envVarRepoFullName, envVarRunID, envVarRepoOwner, envVarServiceNowInstanceURL, envVarServiceNowUser, envVarServiceNowPassword} {
+		if in.get(envVar) == "" {
+			missingEnvVars = append(missingEnvVars, envVar)
+		}
+	}
+
+	if len(missingEnvVars) > 0 {
+		return fmt.Errorf("missing env vars: %v", missingEnvVars)
+	}
+	return nil
+}
+
+func parseServiceNowChangeType(raw string) (string, error) {
+	switch changeType := strings.ToLower(strings.TrimSpace(raw)); changeType {
+	case "":
+		return serviceNowChangeTypeNormal, nil
+	case serviceNowChangeTypeNormal, serviceNowChangeTypeStandard:
+		return changeType, nil
+	default:
+		return "", fmt.Errorf("unknown change type %q, expected %q or %q", raw, serviceNowChangeTypeNormal, serviceNowChangeTypeStandard)
+	}
+}
+
+type serviceNowChange struct {
+	SysID    string `json:"sys_id"`
+	Number   string `json:"number"`
+	State    string `json:"state"`
+	Approval string `json:"approval"`
+}
+
+// serviceNowChangeChannel makes the approval request as a ServiceNow change
+// request. The change is approved or rejected in ServiceNow, so there are no
+// votes to count: the decision follows the change's approval and state.
+type serviceNowChangeChannel struct {
+	apprv           *approvalEnvironment
+	client          *serviceNowClient
+	changeType      string
+	template        string
+	assignmentGroup string
+
+	change serviceNowChange
+}
+
+func newServiceNowChannel(target approvalTarget, apprv *approvalEnvironment, client *serviceNowClient, changeType, template, assignmentGroup string) (approval.Channel, error) {
+	if target != approvalTargetIssue {
+		return nil, fmt.Errorf("target %q is not supported with the %s backend", target, backendServiceNow)
+	}
+	if apprv.existingIssueNumber > 0 {
+		return nil, fmt.Errorf("issue-number is not supported with the %s backend", backendServiceNow)
+	}
+	if apprv.reactionMapping != nil {
+		return nil, fmt.Errorf("allow-reactions is not supported with the %s backend", backendServiceNow)
+	}
+	if err := checkIssueOnlyInputs(apprv, fmt.Sprintf("the %s backend", backendServiceNow)); err != nil {
+		return nil, err
+	}
+	if changeType == serviceNowChangeTypeStandard && template == "" {
+		return nil, fmt.Errorf("servicenow-standard-change-template is required for standard changes")
+	}
+	return &serviceNowChangeChannel{
+		apprv:           apprv,
+		client:          client,
+		changeType:      changeType,
+		template:        template,
+		assignmentGroup: assignmentGroup,
+	}, nil
+}
+
+// changeDescription is the change's description. ServiceNow shows it as
+// plain text, so it leaves out the Markdown of the issue body.
+func (c *serviceNowChangeChannel) changeDescription() string {
+	a := c.apprv
+	description := fmt.Sprintf("Workflow is pending manual review.\nURL: %s", a.runURL())
+	if a.issueBody != "" {
+		description = fmt.Sprintf("%s\n\n%s", description, a.issueBody)
+	}
+	return description
+}
+
+func (c *serviceNowChangeChannel) CreateRequest(ctx context.Context) error {
+	a := c.apprv
+	title := a.approvalRequestTitle()
+	description := c.changeDescription()
+
+	fmt.Fprintf(
+		a.log,
+		"Creating %s change request with the following content:\nShort description: %s\nDescription:\n%s\n",
+		c.changeType,
+		title,
+		description,
+	)
+
+	fields := map[string]string{
+		"type":              c.changeType,
+		"short_description": title,
+		"description":       description,
+	}
+	if c.template != "" {
+		fields["std_change_producer_version"] = c.template
+	}
+	if c.assignmentGroup != "" {
+		fields["assignment_group"] = c.assignmentGroup
+	}
+
+	var created struct {
+		Result serviceNowChange `json:"result"`
+	}
+	if err := c.client.do(ctx, "POST", "api/now/table/change_request", fields, &created); err != nil {
+		return err
+	}
+	c.change = created.Result
+
+	changeURL := fmt.Sprintf("%s/change_request.do?sys_id=%s", c.client.baseURL, url.QueryEscape(c.change.SysID))
+	// Change numbers have a prefix and leading zeros, e.g. CHG0030001.
+	changeNumber, err := strconv.Atoi(strings.TrimLeft(c.change.Number, "ABCDEFGHIJKLMNOPQRSTUVWXYZ"))
+	if err != nil {
+		return fmt.Errorf("error parsing change number %s: %w", c.change.Number, err)
+	}
+	a.approvalIssueNumber = changeNumber
+	a.approvalIssue = &github.Issue{
+		Number:  &changeNumber,
+		HTMLURL: &changeURL,
+	}
+	if _, err := a.SetActionOutputs(map[string]string{"change-number": c.change.Number}); err != nil {
+		return fmt.Errorf("error setting change number output: %w", err)
+	}
+
+	fmt.Fprintf(a.log, "Change request created: %s (%s)\n", c.change.Number, changeURL)
+	return nil
+}
+
+// ListVotes polls the change's approval and state. The change is decided in
+// ServiceNow, so it never returns votes; Review maps the change to a
+// decision.
+func (c *serviceNowChangeChannel) ListVotes(ctx context.Context) ([]approval.Vote, error) {
+	var change struct {
+		Result serviceNowChange `json:"result"`
+	}
+	path := fmt.Sprintf("api/now/table/change_request/%s?sysparm_fields=sys_id,number,state,approval", url.PathEscape(c.change.SysID))
+	if err := c.client.do(ctx, "GET", path, nil, &change); err != nil {
+		return nil, fmt.Errorf("error getting change request: %w", err)
+	}
+	c.change = change.Result
+	fmt.Fprintf(c.apprv.log, "Change %s approval: %s, state: %s\n", c.change.Number, c.change.Approval, c.change.State)
+	return nil, nil
+}
+
+// Review decides the request from the change: an approved change approves
+// it, and a rejected or cancelled change denies it.
+func (c *serviceNowChangeChannel) Review(ctx context.Context, decision approval.Decision) (approval.Decision, error) {
+	v := approval.Vote{
+		User:   "servicenow",
+		Reason: fmt.Sprintf("change %s approval %s, state %s", c.change.Number, c.change.Approval, c.change.State),
+		Source: "change-request",
+	}
+	switch {
+	case c.change.Approval == "approved":
+		v.Action = approval.ActionApprove
+		return approval.Decision{Status: approval.StatusApproved, Votes: []approval.Vote{v}}, nil
+	case c.change.Approval == "rejected" || c.change.State == serviceNowStateCanceled:
+		v.Action = approval.ActionDeny
+		return approval.Decision{Status: approval.StatusDenied, Votes: []approval.Vote{v}}, nil
+	default:
+		return approval.Decision{Status: approval.StatusPending}, nil
+	}
+}
+
+func (c *serviceNowChangeChannel) Finish(ctx context.Context, decision approval.Decision) error {
+	a := c.apprv
+	if decision.Status == approval.StatusApproved {
+		return c.workNote(ctx, "The change has been approved; continuing workflow.")
+	}
+	return c.workNote(ctx, fmt.Sprintf("The change has been rejected or cancelled %s", denialSuffix(a.failOnDenial)))
+}
+
+// Cancel leaves a work note on the change. The change itself is left as it
+// is, as the change model may not allow cancelling it through the Table API.
+func (c *serviceNowChangeChannel) Cancel(ctx context.Context) error {
+	closeComment := "Workflow cancelled, it is no longer waiting for this change."
+	fmt.Fprintln(c.apprv.log, closeComment)
+	return c.workNote(ctx, closeComment)
+}
+
+func (c *serviceNowChangeChannel) workNote(ctx context.Context, note string) error {
+	path := fmt.Sprintf("api/now/table/change_request/%s", url.PathEscape(c.change.SysID))
+	if err := c.client.do(ctx, "PATCH", path, map[string]string{"work_notes": note}, nil); err != nil {
+		return fmt.Errorf("error adding work note to change %s: %w", c.change.Number, err)
+	}
+	return nil
+}
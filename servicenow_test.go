@@ -0,0 +1,221 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/trstringer/manual-approval/pkg/approval"
+)
+
+// fakeServiceNow is an in-memory fake of the change_request table of the
+// ServiceNow Table API. Each poll of the change moves it to the next of
+// states.
+type fakeServiceNow struct {
+	fakeAPI
+
+	states    []serviceNowChange
+	created   map[string]string
+	workNotes []string
+}
+
+func (f *fakeServiceNow) route(w http.ResponseWriter, r *http.Request) bool {
+	change := serviceNowChange{SysID: "abc123", Number: "CHG0030001", State: "-5", Approval: "not requested"}
+	switch r.Method + " " + r.URL.Path {
+	case "POST /api/now/table/change_request":
+		f.readJSON(r, &f.created)
+		w.WriteHeader(http.StatusCreated)
+	case "GET /api/now/table/change_request/abc123":
+		if len(f.states) > 0 {
+			change.State, change.Approval = f.states[0].State, f.states[0].Approval
+			if len(f.states) > 1 {
+				f.states = f.states[1:]
+			}
+		}
+	case "PATCH /api/now/table/change_request/abc123":
+		var update struct {
+			WorkNotes string `json:"work_notes"`
+		}
+		f.readJSON(r, &update)
+		f.workNotes = append(f.workNotes, update.WorkNotes)
+	default:
+		return false
+	}
+	f.writeJSON(w, map[string]serviceNowChange{"result": change})
+	return true
+}
+
+func TestParseServiceNowChangeType(t *testing.T) {
+	testCases := []struct {
+		raw         string
+		expected    string
+		expectError bool
+	}{
+		{raw: "", expected: serviceNowChangeTypeNormal},
+		{raw: "Standard", expected: serviceNowChangeTypeStandard},
+		{raw: " normal ", expected: serviceNowChangeTypeNormal},
+		{raw: "emergency", expectError: true},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.raw, func(t *testing.T) {
+			actual, err := parseServiceNowChangeType(testCase.raw)
+			if testCase.expectError {
+				if err == nil {
+					t.Fatalf("expected an error for %q", testCase.raw)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if actual != testCase.expected {
+				t.Fatalf("actual %q, expected %q", actual, testCase.expected)
+			}
+		})
+	}
+}
+
+func TestServiceNowRunApproval(t *testing.T) {
+	testCases := []struct {
+		name             string
+		changeType       string
+		template         string
+		states           []serviceNowChange
+		expectedExitCode int
+		expectedStatus   string
+	}{
+		{
+			name:       "approved",
+			changeType: serviceNowChangeTypeNormal,
+			states: []serviceNowChange{
+				{State: "-5", Approval: "not requested"},
+				{State: "-3", Approval: "requested"},
+				{State: "-2", Approval: "approved"},
+			},
+			expectedExitCode: 0,
+			expectedStatus:   "approval-status=approved",
+		},
+		{
+			name:       "rejected",
+			changeType: serviceNowChangeTypeNormal,
+			states: []serviceNowChange{
+				{State: "-3", Approval: "requested"},
+				{State: "-5", Approval: "rejected"},
+			},
+			expectedExitCode: 1,
+			expectedStatus:   "approval-status=denied",
+		},
+		{
+			name:       "cancelled",
+			changeType: serviceNowChangeTypeNormal,
+			states: []serviceNowChange{
+				{State: "4", Approval: "requested"},
+			},
+			expectedExitCode: 1,
+			expectedStatus:   "approval-status=denied",
+		},
+		{
+			name:       "standard_change_preapproved",
+			changeType: serviceNowChangeTypeStandard,
+			template:   "tmpl789",
+			states: []serviceNowChange{
+				{State: "-2", Approval: "approved"},
+			},
+			expectedExitCode: 0,
+			expectedStatus:   "approval-status=approved",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			fake := &fakeServiceNow{states: testCase.states}
+			serverURL := fake.serve(t, func(r *http.Request) bool {
+				user, password, ok := r.BasicAuth()
+				return ok && user == "ci" && password == "secret"
+			}, fake.route)
+			t.Setenv(envVarServiceNowInstanceURL, serverURL+"/")
+			t.Setenv(envVarServiceNowUser, "ci")
+			t.Setenv(envVarServiceNowPassword, "secret")
+			t.Setenv(envVarServerURL, "")
+
+			apprv, err := newApprovalEnvironment(approvalOptions{
+				repoFullName:        "owner/repo",
+				repoOwner:           "owner",
+				runID:               1234,
+				issueTitle:          "Deploy to production",
+				issueBody:           "Release v1.2.3",
+				targetRepoOwner:     "owner",
+				targetRepoName:      "repo",
+				failOnDenial:        true,
+				editedCommentPolicy: editedCommentPolicyReevaluate,
+				commentSyntax:       approval.CommentSyntaxKeywords,
+				target:              approvalTargetIssue,
+			})
+			if err != nil {
+				t.Fatalf("error creating approval environment: %v", err)
+			}
+			requestChannel, err := newServiceNowChannel(approvalTargetIssue, apprv, newServiceNowClient(inputs{}), testCase.changeType, testCase.template, "")
+			if err != nil {
+				t.Fatalf("error creating channel: %v", err)
+			}
+
+			runTestApproval(t, apprv, requestChannel, testCase.expectedExitCode,
+				testCase.expectedStatus,
+				"change-number=CHG0030001",
+				"issue-number=30001",
+				"issue-url="+serverURL+"/change_request.do?sys_id=abc123",
+				"decision-reason=servicenow: change CHG0030001 approval",
+			)
+
+			fake.mu.Lock()
+			defer fake.mu.Unlock()
+			if fake.created["type"] != testCase.changeType {
+				t.Fatalf("type %q, expected %q", fake.created["type"], testCase.changeType)
+			}
+			if fake.created["std_change_producer_version"] != testCase.template {
+				t.Fatalf("template %q, expected %q", fake.created["std_change_producer_version"], testCase.template)
+			}
+			if fake.created["short_description"] != "Deploy to production" {
+				t.Fatalf("short description %q", fake.created["short_description"])
+			}
+			description := fake.created["description"]
+			if !strings.Contains(description, "https://github.com/owner/repo/actions/runs/1234") || !strings.Contains(description, "Release v1.2.3") {
+				t.Fatalf("description %q doesn't contain the run URL and issue body", description)
+			}
+			if len(fake.workNotes) != 1 {
+				t.Fatalf("got work notes %q, expected one", fake.workNotes)
+			}
+		})
+	}
+}
+
+func TestNewServiceNowChannelRequiresTemplateForStandardChanges(t *testing.T) {
+	apprv, err := newApprovalEnvironment(approvalOptions{
+		repoFullName:        "owner/repo",
+		repoOwner:           "owner",
+		runID:               1234,
+		targetRepoOwner:     "owner",
+		targetRepoName:      "repo",
+		failOnDenial:        true,
+		editedCommentPolicy: editedCommentPolicyReevaluate,
+		commentSyntax:       approval.CommentSyntaxKeywords,
+		target:              approvalTargetIssue,
+	})
+	if err != nil {
+		t.Fatalf("error creating approval environment: %v", err)
+	}
+	if _, err := newServiceNowChannel(approvalTargetIssue, apprv, &serviceNowClient{}, serviceNowChangeTypeStandard, "", ""); err == nil {
+		t.Fatalf("expected an error for a standard change without a template")
+	}
+}
+
+func TestNewServiceNowChannelRejectsIssueOnlyInputs(t *testing.T) {
+	for name, apprv := range issueOnlyInputs() {
+		t.Run(name, func(t *testing.T) {
+			if _, err := newServiceNowChannel(approvalTargetIssue, apprv, &serviceNowClient{}, serviceNowChangeTypeNormal, "", ""); err == nil {
+				t.Fatalf("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/google/go-github/v43/github"
+)
+
+const (
+	userPrefix = "user:"
+	// teamExpansionWorkers bounds the number of teams listed at once.
+	teamExpansionWorkers = 4
+)
+
+// teamRef names a team of an org, as given in an @org/team approver.
+type teamRef struct {
+	org  string
+	name string
+}
+
+func (t teamRef) String() string {
+	return fmt.Sprintf("@%s/%s", t.org, t.name)
+}
+
+// slug is the team's slug on GitHub, which replaces periods in the name with
+// hyphens.
+func (t teamRef) slug() string {
+	return strings.ReplaceAll(t.name, ".", "-")
+}
+
+// parseTeamRef parses an @org/team approver. It reports false if the approver
+// isn't one. Org and team names are case-insensitive, so they are lowercased
+// for a team to be listed once however it is spelled.
+func parseTeamRef(approver string) (teamRef, bool, error) {
+	name, isTeam := strings.CutPrefix(approver, "@")
+	if !isTeam {
+		return teamRef{}, false, nil
+	}
+	org, team, found := strings.Cut(name, "/")
+	if !found || org == "" || team == "" || strings.Contains(team, "/") {
+		return teamRef{}, true, fmt.Errorf("invalid team approver %q, expected @org/team", approver)
+	}
+	return teamRef{org: strings.ToLower(org), name: strings.ToLower(team)}, true, nil
+}
+
+// cutUserPrefix returns the login of a user:<login> approver. It reports false
+// if the approver doesn't have the prefix.
+func cutUserPrefix(approver string) (string, bool) {
+	if len(approver) < len(userPrefix) || !strings.EqualFold(approver[:len(userPrefix)], userPrefix) {
+		return approver, false
+	}
+	return approver[len(userPrefix):], true
+}
+
+// teamsExpander returns the members of each of the teams. A team that doesn't
+// exist is an error, as it was named explicitly.
+type teamsExpander func(teams []teamRef) (map[teamRef][]string, error)
+
+// expandGitHubTeams expands GitHub teams into their members. GitHub lists the
+// members of child teams at any depth with those of their parent, so child
+// teams aren't walked. Teams are listed concurrently by up to
+// teamExpansionWorkers workers, and each team is listed once, however it is
+// spelled.
+func expandGitHubTeams(ctx context.Context, log io.Writer, client *github.Client, teams []teamRef) (map[teamRef][]string, error) {
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		members = make(map[teamRef][]string, len(teams))
+		errs    []error
+	)
+	workers := make(chan struct{}, teamExpansionWorkers)
+
+	listed := map[teamRef]bool{}
+	for _, team := range teams {
+		if listed[team] {
+			continue
+		}
+		listed[team] = true
+
+		wg.Add(1)
+		go func(team teamRef) {
+			defer wg.Done()
+			workers <- struct{}{}
+			fmt.Fprintf(log, "Expanding team %s\n", team)
+			logins, err := listGitHubTeamMembers(ctx, client, team.org, team.slug())
+			<-workers
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("error listing members of team %s: %w", team, err))
+				return
+			}
+			members[team] = deduplicateUsers(logins)
+		}(team)
+	}
+	wg.Wait()
+	if len(errs) > 0 {
+		return nil, errs[0]
+	}
+	return members, nil
+}
+
+// listGitHubTeamMembers lists every page of the members of a GitHub team,
+// including those of its child teams.
+func listGitHubTeamMembers(ctx context.Context, client *github.Client, org, slug string) ([]string, error) {
+	var logins []string
+	opts := &github.TeamListTeamMembersOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		users, resp, err := client.Teams.ListTeamMembersBySlug(ctx, org, slug, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, user := range users {
+			logins = append(logins, user.GetLogin())
+		}
+		if resp.NextPage == 0 {
+			return logins, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/go-github/v43/github"
+)
+
+func TestParseTeamRef(t *testing.T) {
+	testCases := []struct {
+		approver     string
+		expectedTeam teamRef
+		isTeam       bool
+		isSuccess    bool
+	}{
+		{approver: "@org/team", expectedTeam: teamRef{org: "org", name: "team"}, isTeam: true, isSuccess: true},
+		{approver: "@Org/Team.Name", expectedTeam: teamRef{org: "org", name: "team.name"}, isTeam: true, isSuccess: true},
+		{approver: "@team", isTeam: true, isSuccess: false},
+		{approver: "@org/", isTeam: true, isSuccess: false},
+		{approver: "@org/team/child", isTeam: true, isSuccess: false},
+		{approver: "team", isTeam: false, isSuccess: true},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.approver, func(t *testing.T) {
+			team, isTeam, err := parseTeamRef(testCase.approver)
+			if (err == nil) != testCase.isSuccess {
+				t.Fatalf("expected success %v, got error %v", testCase.isSuccess, err)
+			}
+			if team != testCase.expectedTeam || isTeam != testCase.isTeam {
+				t.Fatalf("got %v %v, expected %v %v", team, isTeam, testCase.expectedTeam, testCase.isTeam)
+			}
+		})
+	}
+}
+
+func TestCutUserPrefix(t *testing.T) {
+	for approver, expected := range map[string]string{"user:login1": "login1", "User:Login1": "Login1"} {
+		if login, isUser := cutUserPrefix(approver); !isUser || login != expected {
+			t.Fatalf("got %q %v for %q, expected %q", login, isUser, approver, expected)
+		}
+	}
+	if _, isUser := cutUserPrefix("login1"); isUser {
+		t.Fatalf("expected login1 not to have the user prefix")
+	}
+}
+
+// newTestTeamsClient serves the members of GitHub teams of org, one member
+// per page, and counts how often each team is listed.
+func newTestTeamsClient(t *testing.T, members map[string][]string, listings *int32) *github.Client {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/orgs/org/teams/", func(w http.ResponseWriter, r *http.Request) {
+		slug, found := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/orgs/org/teams/"), "/members")
+		if !found {
+			t.Errorf("unexpected path %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		logins, ok := members[slug]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		page := 1
+		if raw := r.URL.Query().Get("page"); raw != "" {
+			page, _ = strconv.Atoi(raw)
+		}
+		if page == 1 {
+			atomic.AddInt32(listings, 1)
+		}
+		if page < len(logins) {
+			w.Header().Set("Link", fmt.Sprintf(`<%s?page=%d>; rel="next"`, r.URL.Path, page+1))
+		}
+		if err := json.NewEncoder(w).Encode([]map[string]string{{"login": logins[page-1]}}); err != nil {
+			t.Errorf("error encoding response: %v", err)
+		}
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	client := github.NewClient(nil)
+	baseURL, err := url.Parse(server.URL + "/")
+	if err != nil {
+		t.Fatalf("error parsing URL: %v", err)
+	}
+	client.BaseURL = baseURL
+	return client
+}
+
+func TestExpandGitHubTeams(t *testing.T) {
+	// GitHub lists the members of child teams with their parent's, so the
+	// child teams of parent aren't listed on their own.
+	members := map[string][]string{
+		"parent": {"login1", "login2", "login3"},
+		"child":  {"login2", "login1"},
+	}
+	var listings int32
+	client := newTestTeamsClient(t, members, &listings)
+
+	parent := teamRef{org: "org", name: "parent"}
+	child := teamRef{org: "org", name: "child"}
+	expanded, err := expandGitHubTeams(context.Background(), io.Discard, client, []teamRef{parent, child, parent})
+	if err != nil {
+		t.Fatalf("error expanding teams: %v", err)
+	}
+	for team, expected := range map[teamRef][]string{parent: {"login1", "login2", "login3"}, child: {"login1", "login2"}} {
+		actual := append([]string(nil), expanded[team]...)
+		sort.Strings(actual)
+		if !reflect.DeepEqual(actual, expected) {
+			t.Fatalf("members of %s %v, expected %v", team, actual, expected)
+		}
+	}
+	if listings != 2 {
+		t.Fatalf("%d teams listed, expected each of the 2 teams once", listings)
+	}
+
+	if _, err := expandGitHubTeams(context.Background(), io.Discard, client, []teamRef{{org: "org", name: "missing"}}); err == nil {
+		t.Fatalf("expected an error for a missing team")
+	}
+}
+
+func TestExpandGroupFromUserPaginates(t *testing.T) {
+	var listings int32
+	client := newTestTeamsClient(t, map[string][]string{"sre": {"login1", "login2", "login3"}}, &listings)
+
+	actual := expandGroupFromUser(io.Discard, client, "org", "sre", "login2", true)
+	if expected := []string{"login1", "login3"}; !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("members %v, expected %v", actual, expected)
+	}
+}